@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const (
+	apiKeyPrefix       = "gtd_"
+	apiKeyPrefixLength = len(apiKeyPrefix) + 8
+)
+
+// NewAPIKey returns a new random API key along with the prefix that
+// identifies it once only its hash is kept.
+func NewAPIKey() (key, prefix string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:apiKeyPrefixLength], nil
+}
+
+// HashAPIKey returns the hash an API key is stored and looked up by. Keys
+// are long and random, so a fast unsalted hash is enough to keep them from
+// being recovered from the database.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// keySet is a JSON Web Key Set kept in a file. The file is read again
+// whenever it changes, so keys can be rotated without a restart. A file
+// that fails to parse after a change is ignored in favor of the keys read
+// before, so that a half-written file does not lock everybody out.
+type keySet struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	cached  map[string]*rsa.PublicKey
+}
+
+// keys returns the RSA signing keys of the set by key ID.
+func (s *keySet) keys() (map[string]*rsa.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		if s.cached != nil {
+			return s.cached, nil
+		}
+		return nil, fmt.Errorf("failed to read key set: %w", err)
+	}
+	if s.cached != nil && info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return s.cached, nil
+	}
+	b, err := os.ReadFile(s.path)
+	if err == nil {
+		var keys map[string]*rsa.PublicKey
+		if keys, err = parseKeySet(b); err == nil {
+			s.cached, s.modTime, s.size = keys, info.ModTime(), info.Size()
+		}
+	}
+	if s.cached == nil {
+		return nil, fmt.Errorf("failed to read key set: %w", err)
+	}
+	return s.cached, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// parseKeySet returns the RSA signing keys with a key ID in a JSON Web Key
+// Set. Other keys are skipped.
+func parseKeySet(b []byte) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("invalid key set: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || k.Kid == "" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus of key %q: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid exponent of key %q", k.Kid)
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestToken(t *testing.T) {
+	secret := []byte("secret")
+	verifier, err := NewVerifier(KeyConfig{Secret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		token, err := NewToken(secret, 42, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		principal, err := verifier.Verify(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if principal.UserID != 42 {
+			t.Errorf("expected user 42, got %d", principal.UserID)
+		}
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		token, _ := NewToken([]byte("other"), 42, time.Hour)
+		if _, err := verifier.Verify(token); err != ErrInvalidToken {
+			t.Errorf("expected ErrInvalidToken, got %v", err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		token, _ := NewToken(secret, 42, -time.Minute)
+		if _, err := verifier.Verify(token); err != ErrTokenExpired {
+			t.Errorf("expected ErrTokenExpired, got %v", err)
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		if _, err := verifier.Verify("not-a-token"); err != ErrInvalidToken {
+			t.Errorf("expected ErrInvalidToken, got %v", err)
+		}
+	})
+}
+
+func TestVerifierRS256(t *testing.T) {
+	dir := t.TempDir()
+	first, second := mustRSAKey(t), mustRSAKey(t)
+
+	der, err := x509.MarshalPKIXPublicKey(&first.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyFile := filepath.Join(dir, "public.pem")
+	if err := os.WriteFile(publicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	jwksFile := filepath.Join(dir, "jwks.json")
+	writeKeySet(t, jwksFile, map[string]*rsa.PrivateKey{"first": first})
+
+	verifier, err := NewVerifier(KeyConfig{PublicKeyFile: publicKeyFile, JWKSFile: jwksFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("public key", func(t *testing.T) {
+		principal, err := verifier.Verify(signRS256(t, first, "", 7))
+		if err != nil || principal.UserID != 7 {
+			t.Errorf("expected user 7, got %d, %v", principal.UserID, err)
+		}
+	})
+
+	t.Run("key set", func(t *testing.T) {
+		principal, err := verifier.Verify(signRS256(t, first, "first", 7))
+		if err != nil || principal.UserID != 7 {
+			t.Errorf("expected user 7, got %d, %v", principal.UserID, err)
+		}
+		if _, err := verifier.Verify(signRS256(t, second, "first", 7)); err != ErrInvalidToken {
+			t.Errorf("expected ErrInvalidToken for a token signed with another key, got %v", err)
+		}
+		if _, err := verifier.Verify(signRS256(t, second, "second", 7)); err != ErrInvalidToken {
+			t.Errorf("expected ErrInvalidToken for an unknown key ID, got %v", err)
+		}
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		writeKeySet(t, jwksFile, map[string]*rsa.PrivateKey{"second": second})
+		// Make sure the change is seen even on file systems with coarse
+		// modification times.
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(jwksFile, later, later); err != nil {
+			t.Fatal(err)
+		}
+
+		principal, err := verifier.Verify(signRS256(t, second, "second", 7))
+		if err != nil || principal.UserID != 7 {
+			t.Errorf("expected user 7 with the rotated key, got %d, %v", principal.UserID, err)
+		}
+		if _, err := verifier.Verify(signRS256(t, first, "first", 7)); err != ErrInvalidToken {
+			t.Errorf("expected ErrInvalidToken for a retired key, got %v", err)
+		}
+	})
+
+	t.Run("algorithm confusion", func(t *testing.T) {
+		// An HS256 token using the public key as secret must not verify
+		// when no secret is configured.
+		token, _ := NewToken(der, 7, time.Hour)
+		if _, err := verifier.Verify(token); err != ErrInvalidToken {
+			t.Errorf("expected ErrInvalidToken, got %v", err)
+		}
+	})
+}
+
+func TestNewVerifier(t *testing.T) {
+	if _, err := NewVerifier(KeyConfig{}); err == nil {
+		t.Error("expected an error without keys")
+	}
+	if _, err := NewVerifier(KeyConfig{JWKSFile: filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Error("expected an error for a missing key set")
+	}
+}
+
+func mustRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, userID int) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{
+		Subject:   strconv.Itoa(userID),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func writeKeySet(t *testing.T, path string, keys map[string]*rsa.PrivateKey) {
+	t.Helper()
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	for kid, key := range keys {
+		set.Keys = append(set.Keys, jsonWebKey{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	b, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/cmgchess/gotodo/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrInvalidToken is returned for tokens that are malformed or not
+	// signed with any of the keys a Verifier accepts.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired is returned for tokens that are past their expiry.
+	ErrTokenExpired = errors.New("token has expired")
+)
+
+// Principal is the user a request is made for, and what it may do. A
+// principal authenticated with an API key carries its ID and scope; one
+// authenticated with a token may do everything.
+type Principal struct {
+	UserID   int
+	APIKeyID int
+	Scope    string
+}
+
+// KeyConfig holds the keys a Verifier accepts. Secret verifies HS256 tokens
+// such as those NewToken makes. PublicKeyFile, a PEM encoded RSA public key,
+// and JWKSFile, a JSON Web Key Set, verify RS256 tokens: tokens naming a key
+// ID in their header are checked against that key of the set, others
+// against the public key. Empty fields are not used.
+type KeyConfig struct {
+	Secret        []byte
+	PublicKeyFile string
+	JWKSFile      string
+}
+
+// Verifier checks the signature and expiry of bearer tokens.
+type Verifier struct {
+	secret    []byte
+	publicKey *rsa.PublicKey
+	keySet    *keySet
+	methods   []string
+}
+
+// NewVerifier loads the keys in cfg. It fails if a key file cannot be read
+// or parsed, or if cfg holds no key at all.
+func NewVerifier(cfg KeyConfig) (*Verifier, error) {
+	v := &Verifier{secret: cfg.Secret}
+	if len(v.secret) > 0 {
+		v.methods = append(v.methods, jwt.SigningMethodHS256.Alg())
+	}
+	if cfg.PublicKeyFile != "" {
+		b, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key: %w", err)
+		}
+		if v.publicKey, err = jwt.ParseRSAPublicKeyFromPEM(b); err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+	}
+	if cfg.JWKSFile != "" {
+		v.keySet = &keySet{path: cfg.JWKSFile}
+		if _, err := v.keySet.keys(); err != nil {
+			return nil, err
+		}
+	}
+	if v.publicKey != nil || v.keySet != nil {
+		v.methods = append(v.methods, jwt.SigningMethodRS256.Alg())
+	}
+	if len(v.methods) == 0 {
+		return nil, errors.New("no key to verify tokens with")
+	}
+	return v, nil
+}
+
+// Verify checks a token and returns the principal its subject names, which
+// must be a user ID.
+func (v *Verifier) Verify(token string) (Principal, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, v.key, jwt.WithValidMethods(v.methods), jwt.WithExpirationRequired())
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return Principal{}, ErrTokenExpired
+		}
+		return Principal{}, ErrInvalidToken
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil || userID < 1 {
+		return Principal{}, ErrInvalidToken
+	}
+	return Principal{UserID: userID, Scope: models.ScopeReadWrite}, nil
+}
+
+// key returns the key to check the signature of token with. The parser has
+// already made sure its algorithm is one of v.methods.
+func (v *Verifier) key(token *jwt.Token) (any, error) {
+	if token.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+		return v.secret, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if v.publicKey == nil {
+			return nil, errors.New("token names no key ID")
+		}
+		return v.publicKey, nil
+	}
+	if v.keySet == nil {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	keys, err := v.keySet.keys()
+	if err != nil {
+		return nil, err
+	}
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	return key, nil
+}
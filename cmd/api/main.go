@@ -5,29 +5,78 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/cmgchess/gotodo/auth"
 	"github.com/cmgchess/gotodo/configs"
 	"github.com/cmgchess/gotodo/db"
 	"github.com/cmgchess/gotodo/router"
+	"github.com/cmgchess/gotodo/storage"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func main() {
 	ctx := context.Background()
 
-	db, err := db.NewPostgreSQLStorage(configs.Envs.DSN)
+	store := newStorage(ctx)
+	go purgeTrash(ctx, store)
+
+	verifier, err := auth.NewVerifier(auth.KeyConfig{
+		Secret:        configs.Envs.JWTSecret,
+		PublicKeyFile: configs.Envs.JWTPublicKeyFile,
+		JWKSFile:      configs.Envs.JWTJWKSFile,
+	})
 	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
+		log.Fatalf("failed to load token keys: %v", err)
 	}
 
-	initStorage(ctx, db)
-
-	r := router.SetupRouter(db)
+	r := router.SetupRouter(store, verifier)
 
 	log.Printf("Server running on port %s", configs.Envs.Port)
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", configs.Envs.Port), r))
 }
 
+func newStorage(ctx context.Context) storage.Store {
+	switch configs.Envs.Storage {
+	case "memory":
+		log.Println("Storage: using in-memory storage")
+		return storage.NewMemoryStorage()
+	case "postgres":
+		db, err := db.NewPostgreSQLStorage(configs.Envs.DSN)
+		if err != nil {
+			log.Fatalf("failed to connect to database: %v", err)
+		}
+
+		initStorage(ctx, db)
+
+		return storage.NewPostgresStorage(db)
+	default:
+		log.Fatalf("unknown storage %q, expected \"postgres\" or \"memory\"", configs.Envs.Storage)
+		return nil
+	}
+}
+
+// purgeTrash deletes todos that have been in the trash for longer than the
+// configured retention, once every purge interval.
+func purgeTrash(ctx context.Context, store storage.Store) {
+	ticker := time.NewTicker(configs.Envs.TrashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := store.PurgeTrash(ctx, time.Now().Add(-configs.Envs.TrashRetention))
+			if err != nil {
+				log.Printf("failed to purge trash: %v", err)
+			} else if n > 0 {
+				log.Printf("Trash: purged %d todos", n)
+			}
+		}
+	}
+}
+
 func initStorage(ctx context.Context, db *pgxpool.Pool) {
 	err := db.Ping(ctx)
 	if err != nil {
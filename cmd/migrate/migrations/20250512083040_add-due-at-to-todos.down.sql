@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS todos_due_at_idx;
+
+ALTER TABLE todos DROP COLUMN IF EXISTS due_at;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS priority TEXT NOT NULL DEFAULT 'none'
+    CONSTRAINT todos_priority_check CHECK (priority IN ('none', 'low', 'medium', 'high', 'urgent'));
\ No newline at end of file
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS lists (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS lists_default_idx ON lists (is_default) WHERE is_default;
+
+INSERT INTO lists (name, is_default, created_at, updated_at)
+SELECT 'Inbox', TRUE, NOW() AT TIME ZONE 'UTC', NOW() AT TIME ZONE 'UTC'
+WHERE NOT EXISTS (SELECT 1 FROM lists WHERE is_default);
+
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS list_id INTEGER REFERENCES lists (id) ON DELETE CASCADE;
+UPDATE todos SET list_id = (SELECT id FROM lists WHERE is_default) WHERE list_id IS NULL;
+ALTER TABLE todos ALTER COLUMN list_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS todos_list_id_idx ON todos (list_id);
\ No newline at end of file
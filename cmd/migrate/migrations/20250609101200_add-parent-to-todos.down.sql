@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS todos_parent_id_idx;
+ALTER TABLE todos DROP COLUMN IF EXISTS auto_complete;
+ALTER TABLE todos DROP COLUMN IF EXISTS parent_id;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS todo_dependencies;
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS todo_dependencies (
+    todo_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    blocked_by_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    PRIMARY KEY (todo_id, blocked_by_id),
+    CONSTRAINT todo_dependencies_self_check CHECK (todo_id <> blocked_by_id)
+);
+
+CREATE INDEX IF NOT EXISTS todo_dependencies_blocked_by_id_idx ON todo_dependencies (blocked_by_id);
\ No newline at end of file
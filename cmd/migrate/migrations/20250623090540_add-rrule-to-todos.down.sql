@@ -0,0 +1 @@
+ALTER TABLE todos DROP COLUMN IF EXISTS rrule;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS rrule TEXT NOT NULL DEFAULT '';
\ No newline at end of file
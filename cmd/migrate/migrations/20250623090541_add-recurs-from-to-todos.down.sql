@@ -0,0 +1 @@
+ALTER TABLE todos DROP COLUMN IF EXISTS recurs_from;
\ No newline at end of file
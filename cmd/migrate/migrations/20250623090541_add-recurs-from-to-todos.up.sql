@@ -0,0 +1,3 @@
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS recurs_from INTEGER REFERENCES todos (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS todos_recurs_from_idx ON todos (recurs_from);
\ No newline at end of file
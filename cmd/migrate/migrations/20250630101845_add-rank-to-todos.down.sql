@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS todos_rank_idx;
+ALTER TABLE todos DROP COLUMN IF EXISTS rank;
\ No newline at end of file
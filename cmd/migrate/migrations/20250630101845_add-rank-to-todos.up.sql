@@ -0,0 +1,7 @@
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS rank TEXT COLLATE "C" NOT NULL DEFAULT '';
+
+UPDATE todos SET rank = ranked.rank FROM (SELECT id, lpad(row_number() OVER (ORDER BY created_at, id)::text, 10, '0') || 'V' AS rank FROM todos) ranked WHERE todos.id = ranked.id;
+
+ALTER TABLE todos ALTER COLUMN rank DROP DEFAULT;
+
+CREATE INDEX IF NOT EXISTS todos_rank_idx ON todos (rank, id);
\ No newline at end of file
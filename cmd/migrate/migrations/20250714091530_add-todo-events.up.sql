@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS todo_events (
+    id SERIAL PRIMARY KEY,
+    todo_id INTEGER NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    before JSONB NOT NULL,
+    after JSONB NOT NULL,
+    version INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS todo_events_todo_id_idx ON todo_events (todo_id, id);
\ No newline at end of file
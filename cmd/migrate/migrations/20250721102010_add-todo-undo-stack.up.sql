@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS todo_undo_stack (
+    id SERIAL PRIMARY KEY,
+    event_id INTEGER NOT NULL REFERENCES todo_events (id) ON DELETE CASCADE,
+    undone BOOLEAN NOT NULL DEFAULT FALSE
+);
\ No newline at end of file
@@ -0,0 +1,15 @@
+ALTER TABLE tags DROP CONSTRAINT IF EXISTS tags_owner_id_name_key;
+ALTER TABLE tags ADD CONSTRAINT tags_name_key UNIQUE (name);
+
+DROP INDEX IF EXISTS lists_owner_default_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS lists_default_idx ON lists (is_default) WHERE is_default;
+
+DROP INDEX IF EXISTS lists_owner_id_idx;
+DROP INDEX IF EXISTS todos_owner_id_idx;
+
+ALTER TABLE todo_events DROP COLUMN IF EXISTS owner_id;
+ALTER TABLE tags DROP COLUMN IF EXISTS owner_id;
+ALTER TABLE lists DROP COLUMN IF EXISTS owner_id;
+ALTER TABLE todos DROP COLUMN IF EXISTS owner_id;
+
+DROP TABLE IF EXISTS users;
\ No newline at end of file
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    email TEXT NOT NULL CONSTRAINT users_email_key UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS owner_id INTEGER REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE lists ADD COLUMN IF NOT EXISTS owner_id INTEGER REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS owner_id INTEGER REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE todo_events ADD COLUMN IF NOT EXISTS owner_id INTEGER REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS todos_owner_id_idx ON todos (owner_id);
+CREATE INDEX IF NOT EXISTS lists_owner_id_idx ON lists (owner_id);
+
+DROP INDEX IF EXISTS lists_default_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS lists_owner_default_idx ON lists (owner_id) WHERE is_default;
+
+ALTER TABLE tags DROP CONSTRAINT IF EXISTS tags_name_key;
+ALTER TABLE tags ADD CONSTRAINT tags_owner_id_name_key UNIQUE (owner_id, name);
\ No newline at end of file
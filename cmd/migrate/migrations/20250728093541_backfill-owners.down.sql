@@ -0,0 +1,19 @@
+-- The data stays with the user it was given to. Tag names and the default
+-- list become global again once the users migration is rolled back, so each
+-- tag name keeps its lowest tag ID, which takes over the todos of the others,
+-- and only the oldest default list stays the default.
+INSERT INTO todo_tags (todo_id, tag_id)
+SELECT todo_tags.todo_id, keep.id
+FROM todo_tags
+JOIN tags ON tags.id = todo_tags.tag_id
+JOIN (SELECT name, MIN(id) AS id FROM tags GROUP BY name) keep ON keep.name = tags.name
+WHERE tags.id <> keep.id
+ON CONFLICT DO NOTHING;
+DELETE FROM tags WHERE id NOT IN (SELECT MIN(id) FROM tags GROUP BY name);
+
+UPDATE lists SET is_default = FALSE WHERE is_default AND id <> (SELECT MIN(id) FROM lists WHERE is_default);
+
+ALTER TABLE todo_events ALTER COLUMN owner_id DROP NOT NULL;
+ALTER TABLE tags ALTER COLUMN owner_id DROP NOT NULL;
+ALTER TABLE lists ALTER COLUMN owner_id DROP NOT NULL;
+ALTER TABLE todos ALTER COLUMN owner_id DROP NOT NULL;
\ No newline at end of file
@@ -0,0 +1,25 @@
+-- Data from before users existed has no owner and would be seen by nobody.
+-- It goes to a user of its own, migrated@localhost, whose empty password hash
+-- matches no password. An operator claims the account by giving it a real
+-- email and the bcrypt hash of a password, e.g. one from
+-- htpasswd -bnBC 10 "" <password> | tr -d ':\n':
+--
+--   UPDATE users SET email = 'me@example.com', password_hash = '$2y$10$...'
+--   WHERE email = 'migrated@localhost';
+INSERT INTO users (email, password_hash, created_at)
+SELECT 'migrated@localhost', '', NOW() AT TIME ZONE 'UTC'
+WHERE EXISTS (SELECT 1 FROM todos WHERE owner_id IS NULL)
+    OR EXISTS (SELECT 1 FROM lists WHERE owner_id IS NULL)
+    OR EXISTS (SELECT 1 FROM tags WHERE owner_id IS NULL)
+    OR EXISTS (SELECT 1 FROM todo_events WHERE owner_id IS NULL)
+ON CONFLICT (email) DO NOTHING;
+
+UPDATE todos SET owner_id = (SELECT id FROM users WHERE email = 'migrated@localhost') WHERE owner_id IS NULL;
+UPDATE lists SET owner_id = (SELECT id FROM users WHERE email = 'migrated@localhost') WHERE owner_id IS NULL;
+UPDATE tags SET owner_id = (SELECT id FROM users WHERE email = 'migrated@localhost') WHERE owner_id IS NULL;
+UPDATE todo_events SET owner_id = (SELECT id FROM users WHERE email = 'migrated@localhost') WHERE owner_id IS NULL;
+
+ALTER TABLE todos ALTER COLUMN owner_id SET NOT NULL;
+ALTER TABLE lists ALTER COLUMN owner_id SET NOT NULL;
+ALTER TABLE tags ALTER COLUMN owner_id SET NOT NULL;
+ALTER TABLE todo_events ALTER COLUMN owner_id SET NOT NULL;
\ No newline at end of file
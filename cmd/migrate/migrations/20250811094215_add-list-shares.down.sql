@@ -0,0 +1 @@
+DROP TABLE IF EXISTS list_shares;
\ No newline at end of file
@@ -0,0 +1,2 @@
+-- Subtasks are not moved back to the lists they were in before.
+SELECT 1;
\ No newline at end of file
@@ -0,0 +1,8 @@
+WITH RECURSIVE tree AS (
+    SELECT id, list_id FROM todos WHERE parent_id IS NULL
+    UNION ALL
+    SELECT todos.id, tree.list_id FROM todos JOIN tree ON todos.parent_id = tree.id
+)
+UPDATE todos SET list_id = tree.list_id, version = todos.version + 1
+FROM tree
+WHERE todos.id = tree.id AND todos.list_id <> tree.list_id;
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS todo_events_actor_id_idx;
+ALTER TABLE todo_events DROP COLUMN IF EXISTS actor_id;
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE todo_events ADD COLUMN IF NOT EXISTS actor_id INTEGER REFERENCES users (id) ON DELETE CASCADE;
+UPDATE todo_events SET actor_id = owner_id WHERE actor_id IS NULL;
+ALTER TABLE todo_events ALTER COLUMN actor_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS todo_events_actor_id_idx ON todo_events (actor_id);
\ No newline at end of file
@@ -1,14 +1,32 @@
 package configs
 
 import (
+	"crypto/rand"
+	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Port string
-	DSN  string
+	Port           string
+	DSN            string
+	Storage        string
+	IdempotencyTTL time.Duration
+	// TrashRetention is how long deleted todos stay in the trash before
+	// they are purged, which is checked every TrashPurgeInterval.
+	TrashRetention     time.Duration
+	TrashPurgeInterval time.Duration
+	// JWTSecret signs the tokens handed out at login, which stay valid for
+	// TokenTTL, and verifies HS256 tokens. JWTPublicKeyFile and JWTJWKSFile
+	// optionally point to a PEM encoded RSA public key and a JSON Web Key
+	// Set verifying RS256 tokens issued elsewhere; the key set is read again
+	// when it changes, so its keys can be rotated.
+	JWTSecret        []byte
+	TokenTTL         time.Duration
+	JWTPublicKeyFile string
+	JWTJWKSFile      string
 }
 
 var Envs = initConfig()
@@ -17,8 +35,16 @@ func initConfig() Config {
 	godotenv.Load()
 
 	return Config{
-		Port: getEnv("PORT", "8080"),
-		DSN:  getEnv("DSN", "postgres://postgres:@localhost:5432/todo"),
+		Port:               getEnv("PORT", "8080"),
+		DSN:                getEnv("DSN", "postgres://postgres:@localhost:5432/todo"),
+		Storage:            getEnv("STORAGE", "postgres"),
+		IdempotencyTTL:     getDurationEnv("IDEMPOTENCY_TTL", 24*time.Hour),
+		TrashRetention:     getDurationEnv("TRASH_RETENTION", 30*24*time.Hour),
+		TrashPurgeInterval: getDurationEnv("TRASH_PURGE_INTERVAL", time.Hour),
+		JWTSecret:          getSecretEnv("JWT_SECRET"),
+		TokenTTL:           getDurationEnv("TOKEN_TTL", 24*time.Hour),
+		JWTPublicKeyFile:   getEnv("JWT_PUBLIC_KEY_FILE", ""),
+		JWTJWKSFile:        getEnv("JWT_JWKS_FILE", ""),
 	}
 }
 
@@ -28,3 +54,27 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	if value, ok := os.LookupEnv(key); ok {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+		log.Printf("invalid duration %q for %s, using %s", value, key, fallback)
+	}
+	return fallback
+}
+
+// getSecretEnv returns the secret in key, or a random one if it is not set,
+// in which case tokens do not survive a restart.
+func getSecretEnv(key string) []byte {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return []byte(value)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("failed to generate %s: %v", key, err)
+	}
+	log.Printf("%s is not set, using a random secret", key)
+	return secret
+}
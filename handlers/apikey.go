@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cmgchess/gotodo/auth"
+	"github.com/cmgchess/gotodo/models"
+	"github.com/cmgchess/gotodo/storage"
+	"github.com/cmgchess/gotodo/utils"
+)
+
+type APIKeyHandler struct {
+	store storage.APIKeyStorage
+}
+
+func NewAPIKeyHandler(store storage.APIKeyStorage) *APIKeyHandler {
+	return &APIKeyHandler{store: store}
+}
+
+func (h *APIKeyHandler) GetAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	keys, err := h.store.GetAPIKeys(ctx)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusOK, keys)
+}
+
+// AddAPIKeyHandler creates an API key. The response is the only place the
+// key itself ever appears.
+func (h *APIKeyHandler) AddAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var keyRequest models.APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&keyRequest); err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid request payload"))
+		return
+	}
+	if err := utils.ValidateStruct(keyRequest); err != nil {
+		utils.ValidationError(w, r, err)
+		return
+	}
+	if keyRequest.ExpiresAt != nil && !keyRequest.ExpiresAt.After(time.Now()) {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("expires_at must be in the future"))
+		return
+	}
+
+	secret, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		log.Printf("failed to generate API key: %v", err)
+		utils.Error(w, r, http.StatusInternalServerError, errors.New("internal server error"))
+		return
+	}
+	key := models.APIKey{Name: keyRequest.Name, Prefix: prefix, Scope: keyRequest.Scope}
+	if keyRequest.ExpiresAt != nil {
+		expiresAt := keyRequest.ExpiresAt.UTC()
+		key.ExpiresAt = &expiresAt
+	}
+	key, err = h.store.AddAPIKey(ctx, key, auth.HashAPIKey(secret))
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusCreated, models.NewAPIKey{APIKey: key, Key: secret})
+}
+
+// DeleteAPIKeyHandler revokes an API key.
+func (h *APIKeyHandler) DeleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	i, err := utils.ParseIntVarFromRequest(r, "id")
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid API key ID"))
+		return
+	}
+	if err := h.store.DeleteAPIKey(ctx, i); err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmgchess/gotodo/auth"
+	"github.com/cmgchess/gotodo/models"
+	"github.com/cmgchess/gotodo/storage"
+	"github.com/gorilla/mux"
+)
+
+func TestAPIKeyHandlers(t *testing.T) {
+	t.Run("should return 200 with the API keys of the user", func(t *testing.T) {
+		apiKeyHandler := NewAPIKeyHandler(&mockAPIKeyStore{
+			GetAPIKeysFunc: func(ctx context.Context) ([]models.APIKey, error) {
+				return []models.APIKey{{ID: 1, Name: "backup", Prefix: "gtd_abcdefgh", Scope: models.ScopeRead}}, nil
+			},
+		})
+
+		req, err := http.NewRequest(http.MethodGet, "/api-keys", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/api-keys", apiKeyHandler.GetAPIKeysHandler).Methods(http.MethodGet)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 201 with the key only once if API key created successfully", func(t *testing.T) {
+		var storedHash string
+		var stored models.APIKey
+		apiKeyHandler := NewAPIKeyHandler(&mockAPIKeyStore{
+			AddAPIKeyFunc: func(ctx context.Context, key models.APIKey, hash string) (models.APIKey, error) {
+				key.ID = 1
+				stored, storedHash = key, hash
+				return key, nil
+			},
+		})
+
+		req, err := http.NewRequest(http.MethodPost, "/api-keys", strings.NewReader(`{"name": "backup", "scope": "read"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/api-keys", apiKeyHandler.AddAPIKeyHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code 201, got %d", rr.Code)
+		}
+		var created models.NewAPIKey
+		if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+		if created.Key == "" || auth.HashAPIKey(created.Key) != storedHash || !strings.HasPrefix(created.Key, stored.Prefix) {
+			t.Errorf("expected the key matching the stored hash and prefix, got %+v", created)
+		}
+		if created.Scope != models.ScopeRead || created.Name != "backup" {
+			t.Errorf("unexpected API key %+v", created)
+		}
+	})
+
+	t.Run("should return 400 if scope is unknown when creating API key", func(t *testing.T) {
+		apiKeyHandler := NewAPIKeyHandler(&mockAPIKeyStore{})
+
+		req, err := http.NewRequest(http.MethodPost, "/api-keys", strings.NewReader(`{"name": "backup", "scope": "admin"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/api-keys", apiKeyHandler.AddAPIKeyHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 400 if expiry is in the past when creating API key", func(t *testing.T) {
+		apiKeyHandler := NewAPIKeyHandler(&mockAPIKeyStore{})
+		body := `{"name": "backup", "scope": "read", "expires_at": "` + time.Now().Add(-time.Hour).Format(time.RFC3339) + `"}`
+
+		req, err := http.NewRequest(http.MethodPost, "/api-keys", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/api-keys", apiKeyHandler.AddAPIKeyHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 204 if API key revoked successfully", func(t *testing.T) {
+		apiKeyHandler := NewAPIKeyHandler(&mockAPIKeyStore{
+			DeleteAPIKeyFunc: func(ctx context.Context, id int) error {
+				return nil
+			},
+		})
+
+		req, err := http.NewRequest(http.MethodDelete, "/api-keys/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/api-keys/{id}", apiKeyHandler.DeleteAPIKeyHandler).Methods(http.MethodDelete)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("expected status code 204, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 404 if API key is not found when revoking", func(t *testing.T) {
+		apiKeyHandler := NewAPIKeyHandler(&mockAPIKeyStore{
+			DeleteAPIKeyFunc: func(ctx context.Context, id int) error {
+				return storage.ErrNotFound
+			},
+		})
+
+		req, err := http.NewRequest(http.MethodDelete, "/api-keys/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/api-keys/{id}", apiKeyHandler.DeleteAPIKeyHandler).Methods(http.MethodDelete)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code 404, got %d", rr.Code)
+		}
+	})
+}
+
+type mockAPIKeyStore struct {
+	GetAPIKeysFunc   func(ctx context.Context) ([]models.APIKey, error)
+	AddAPIKeyFunc    func(ctx context.Context, key models.APIKey, hash string) (models.APIKey, error)
+	DeleteAPIKeyFunc func(ctx context.Context, id int) error
+	UseAPIKeyFunc    func(ctx context.Context, hash string, now time.Time) (*models.APIKey, error)
+}
+
+func (m *mockAPIKeyStore) GetAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	return m.GetAPIKeysFunc(ctx)
+}
+
+func (m *mockAPIKeyStore) AddAPIKey(ctx context.Context, key models.APIKey, hash string) (models.APIKey, error) {
+	return m.AddAPIKeyFunc(ctx, key, hash)
+}
+
+func (m *mockAPIKeyStore) DeleteAPIKey(ctx context.Context, id int) error {
+	return m.DeleteAPIKeyFunc(ctx, id)
+}
+
+func (m *mockAPIKeyStore) UseAPIKey(ctx context.Context, hash string, now time.Time) (*models.APIKey, error) {
+	return m.UseAPIKeyFunc(ctx, hash, now)
+}
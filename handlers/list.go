@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cmgchess/gotodo/models"
+	"github.com/cmgchess/gotodo/storage"
+	"github.com/cmgchess/gotodo/utils"
+	"github.com/gorilla/mux"
+)
+
+type ListHandler struct {
+	store  storage.ListStorage
+	shares storage.ShareStorage
+}
+
+func NewListHandler(store storage.ListStorage, shares storage.ShareStorage) *ListHandler {
+	return &ListHandler{store: store, shares: shares}
+}
+
+// GetListsHandler returns the lists of the user, followed by the lists
+// shared with them.
+func (h *ListHandler) GetListsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	lists, err := h.store.GetLists(ctx)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	for i := range lists {
+		lists[i].Role = models.RoleOwner
+	}
+	shared, err := h.shares.GetSharedLists(ctx)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusOK, append(lists, shared...))
+}
+
+// GetListByIDHandler returns a list of the user or shared with them.
+func (h *ListHandler) GetListByIDHandler(w http.ResponseWriter, r *http.Request) {
+	i, err := utils.ParseIntVarFromRequest(r, "listID")
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid list ID"))
+		return
+	}
+	access, err := h.shares.ListAccess(r.Context(), i)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	ctx, err := withAccess(r.Context(), access, models.RoleViewer)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	list, err := h.store.GetListByID(ctx, i)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	list.Role = access.Role
+	utils.JSON(w, http.StatusOK, list)
+}
+
+func (h *ListHandler) AddListHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var listRequest models.ListRequest
+	if err := json.NewDecoder(r.Body).Decode(&listRequest); err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid request payload"))
+		return
+	}
+	if err := utils.ValidateStruct(listRequest); err != nil {
+		utils.ValidationError(w, r, err)
+		return
+	}
+
+	list, err := h.store.AddList(ctx, listRequest)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	list.Role = models.RoleOwner
+	utils.JSON(w, http.StatusCreated, list)
+}
+
+func (h *ListHandler) UpdateListHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	i, err := utils.ParseIntVarFromRequest(r, "listID")
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid list ID"))
+		return
+	}
+	var listRequest models.ListRequest
+	if err := json.NewDecoder(r.Body).Decode(&listRequest); err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid request payload"))
+		return
+	}
+	if err := utils.ValidateStruct(listRequest); err != nil {
+		utils.ValidationError(w, r, err)
+		return
+	}
+
+	list, err := h.store.UpdateList(ctx, i, listRequest)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	list.Role = models.RoleOwner
+	utils.JSON(w, http.StatusOK, list)
+}
+
+// DeleteListHandler deletes a list along with its todos.
+func (h *ListHandler) DeleteListHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	i, err := utils.ParseIntVarFromRequest(r, "listID")
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid list ID"))
+		return
+	}
+	if err := h.store.DeleteList(ctx, i); err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listIDFromPath returns the {listID} route variable of todo routes nested
+// under /lists/{listID}, and whether the route has one.
+func listIDFromPath(r *http.Request) (int, bool, error) {
+	v, ok := mux.Vars(r)["listID"]
+	if !ok {
+		return 0, false, nil
+	}
+	id, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, true, errors.New("invalid list ID")
+	}
+	return id, true, nil
+}
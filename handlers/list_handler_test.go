@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cmgchess/gotodo/models"
+	"github.com/cmgchess/gotodo/storage"
+	"github.com/gorilla/mux"
+)
+
+func TestListHandlers(t *testing.T) {
+	t.Run("should return 200 if lists return successfully", func(t *testing.T) {
+		listHandler := NewListHandler(&mockListStore{
+			GetListsFunc: func(ctx context.Context) ([]models.List, error) {
+				return []models.List{{ID: 1, Name: "Inbox", Default: true}}, nil
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/lists", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/lists", listHandler.GetListsHandler).Methods(http.MethodGet)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 400 if invalid id passed when get list by ID", func(t *testing.T) {
+		listHandler := NewListHandler(&mockListStore{}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/lists/abc", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/lists/{listID}", listHandler.GetListByIDHandler).Methods(http.MethodGet)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 201 if list added successfully", func(t *testing.T) {
+		listHandler := NewListHandler(&mockListStore{
+			AddListFunc: func(ctx context.Context, listRequest models.ListRequest) (models.List, error) {
+				return models.List{ID: 2, Name: listRequest.Name}, nil
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPost, "/lists", strings.NewReader(`{"name": "Sprint"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/lists", listHandler.AddListHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Errorf("expected status code 201, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 400 if model validation failed when adding list", func(t *testing.T) {
+		listHandler := NewListHandler(&mockListStore{}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPost, "/lists", strings.NewReader(`{"description": "no name"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/lists", listHandler.AddListHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 404 if list not found when updating list", func(t *testing.T) {
+		listHandler := NewListHandler(&mockListStore{
+			UpdateListFunc: func(ctx context.Context, id int, listRequest models.ListRequest) (*models.List, error) {
+				return nil, storage.ErrNotFound
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPut, "/lists/9", strings.NewReader(`{"name": "Sprint"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/lists/{listID}", listHandler.UpdateListHandler).Methods(http.MethodPut)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code 404, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 409 if default list is deleted", func(t *testing.T) {
+		listHandler := NewListHandler(&mockListStore{
+			DeleteListFunc: func(ctx context.Context, id int) error { return storage.ErrConflict },
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodDelete, "/lists/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/lists/{listID}", listHandler.DeleteListHandler).Methods(http.MethodDelete)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code 409, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 204 if list deleted successfully", func(t *testing.T) {
+		listHandler := NewListHandler(&mockListStore{
+			DeleteListFunc: func(ctx context.Context, id int) error { return nil },
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodDelete, "/lists/2", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/lists/{listID}", listHandler.DeleteListHandler).Methods(http.MethodDelete)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("expected status code 204, got %d", rr.Code)
+		}
+	})
+}
+
+type mockListStore struct {
+	GetListsFunc    func(ctx context.Context) ([]models.List, error)
+	GetListByIDFunc func(ctx context.Context, id int) (*models.List, error)
+	AddListFunc     func(ctx context.Context, listRequest models.ListRequest) (models.List, error)
+	UpdateListFunc  func(ctx context.Context, id int, listRequest models.ListRequest) (*models.List, error)
+	DeleteListFunc  func(ctx context.Context, id int) error
+}
+
+func (m *mockListStore) GetLists(ctx context.Context) ([]models.List, error) {
+	return m.GetListsFunc(ctx)
+}
+
+func (m *mockListStore) GetListByID(ctx context.Context, id int) (*models.List, error) {
+	return m.GetListByIDFunc(ctx, id)
+}
+
+func (m *mockListStore) AddList(ctx context.Context, listRequest models.ListRequest) (models.List, error) {
+	return m.AddListFunc(ctx, listRequest)
+}
+
+func (m *mockListStore) UpdateList(ctx context.Context, id int, listRequest models.ListRequest) (*models.List, error) {
+	return m.UpdateListFunc(ctx, id, listRequest)
+}
+
+func (m *mockListStore) DeleteList(ctx context.Context, id int) error {
+	return m.DeleteListFunc(ctx, id)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cmgchess/gotodo/storage"
+)
+
+// parseTodoQuery reads the list options of GET /todos from the query string:
+// limit, cursor, sort (prefix with "-" for descending), completed, enabled,
+// created_after, created_before, due_after, due_before, tag (repeatable) and
+// tag_match ("any" or "all"). On routes nested under /lists/{listID} the
+// query is restricted to that list.
+func parseTodoQuery(r *http.Request) (storage.TodoQuery, error) {
+	values := r.URL.Query()
+	var query storage.TodoQuery
+
+	listID, _, err := listIDFromPath(r)
+	if err != nil {
+		return query, err
+	}
+	query.ListID = listID
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > storage.MaxTodoLimit {
+			return query, fmt.Errorf("limit must be between 1 and %d", storage.MaxTodoLimit)
+		}
+		query.Limit = limit
+	}
+
+	query.Cursor = values.Get("cursor")
+
+	if v := values.Get("sort"); v != "" {
+		query.Desc = strings.HasPrefix(v, "-")
+		query.Sort = storage.TodoSort(strings.TrimPrefix(v, "-"))
+		if !query.Sort.Valid() {
+			return query, fmt.Errorf("sort must be one of priority, rank, created_at, updated_at, name")
+		}
+	}
+
+	if query.Completed, err = parseBoolParam(values.Get("completed"), "completed"); err != nil {
+		return query, err
+	}
+	if query.Enabled, err = parseBoolParam(values.Get("enabled"), "enabled"); err != nil {
+		return query, err
+	}
+	if query.CreatedAfter, err = parseTimeParam(values.Get("created_after"), "created_after"); err != nil {
+		return query, err
+	}
+	if query.CreatedBefore, err = parseTimeParam(values.Get("created_before"), "created_before"); err != nil {
+		return query, err
+	}
+	if query.DueAfter, err = parseTimeParam(values.Get("due_after"), "due_after"); err != nil {
+		return query, err
+	}
+	if query.DueBefore, err = parseTimeParam(values.Get("due_before"), "due_before"); err != nil {
+		return query, err
+	}
+
+	for _, tag := range values["tag"] {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			query.Tags = append(query.Tags, tag)
+		}
+	}
+	switch values.Get("tag_match") {
+	case "", "any":
+	case "all":
+		query.MatchAllTags = true
+	default:
+		return query, fmt.Errorf("tag_match must be any or all")
+	}
+
+	return query, nil
+}
+
+func parseBoolParam(v, name string) (*bool, error) {
+	if v == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", name)
+	}
+	return &b, nil
+}
+
+func parseTimeParam(v, name string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+	}
+	return &t, nil
+}
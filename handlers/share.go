@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/cmgchess/gotodo/models"
+	"github.com/cmgchess/gotodo/storage"
+	"github.com/cmgchess/gotodo/utils"
+)
+
+// errSharedTodoMoved is returned when a user a todo is shared with tries to
+// move it to another list, which only its owner may do.
+var errSharedTodoMoved = fmt.Errorf("only the owner of a shared todo can move it to another list: %w", storage.ErrForbidden)
+
+// errParentOwner is returned when a todo is given a parent that belongs to
+// another user.
+var errParentOwner = fmt.Errorf("a subtask must belong to the owner of its parent: %w", storage.ErrConflict)
+
+type ShareHandler struct {
+	store storage.ShareStorage
+}
+
+func NewShareHandler(store storage.ShareStorage) *ShareHandler {
+	return &ShareHandler{store: store}
+}
+
+// GetSharesHandler lists the users a list is shared with. Anyone the list is
+// shared with can see them.
+func (h *ShareHandler) GetSharesHandler(w http.ResponseWriter, r *http.Request) {
+	i, err := utils.ParseIntVarFromRequest(r, "listID")
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid list ID"))
+		return
+	}
+	ctx, err := listContext(r, h.store, i, models.RoleViewer)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	shares, err := h.store.GetShares(ctx, i)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusOK, shares)
+}
+
+// ShareListHandler shares a list with the user with the given email, or
+// changes their role. It takes the owner role on the list.
+func (h *ShareHandler) ShareListHandler(w http.ResponseWriter, r *http.Request) {
+	i, err := utils.ParseIntVarFromRequest(r, "listID")
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid list ID"))
+		return
+	}
+	var shareRequest models.ShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&shareRequest); err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid request payload"))
+		return
+	}
+	if err := utils.ValidateStruct(shareRequest); err != nil {
+		utils.ValidationError(w, r, err)
+		return
+	}
+	ctx, err := listContext(r, h.store, i, models.RoleOwner)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+
+	share, err := h.store.ShareList(ctx, i, shareRequest.Email, shareRequest.Role)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusOK, share)
+}
+
+// UnshareListHandler revokes the access of the user {userID} to a list. It
+// takes the owner role on the list, except for users leaving a list shared
+// with them.
+func (h *ShareHandler) UnshareListHandler(w http.ResponseWriter, r *http.Request) {
+	i, err := utils.ParseIntVarFromRequest(r, "listID")
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid list ID"))
+		return
+	}
+	userID, err := utils.ParseIntVarFromRequest(r, "userID")
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid user ID"))
+		return
+	}
+	role := models.RoleOwner
+	if self, _ := storage.OwnerFromContext(r.Context()); self == userID {
+		role = models.RoleViewer
+	}
+	ctx, err := listContext(r, h.store, i, role)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	if err := h.store.UnshareList(ctx, i, userID); err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listContext returns a context acting for the owner of the list listID if
+// the user of r has at least the given role on it. Lists the user has no
+// access to are not found rather than forbidden, so that a 403 never
+// reveals a list the user cannot see.
+func listContext(r *http.Request, shares storage.ShareStorage, listID int, role string) (context.Context, error) {
+	access, err := shares.ListAccess(r.Context(), listID)
+	if err != nil {
+		return nil, err
+	}
+	return withAccess(r.Context(), access, role)
+}
+
+// todoContext is listContext for the todo todoID.
+func todoContext(r *http.Request, shares storage.ShareStorage, todoID int, role string) (context.Context, error) {
+	access, err := shares.TodoAccess(r.Context(), todoID)
+	if err != nil {
+		return nil, err
+	}
+	return withAccess(r.Context(), access, role)
+}
+
+// withAccess returns a context acting for the owner of what access is to,
+// in which the user of ctx stays the actor.
+func withAccess(ctx context.Context, access models.Access, role string) (context.Context, error) {
+	if !access.Allows(role) {
+		return nil, fmt.Errorf("%s role required, have %s: %w", role, access.Role, storage.ErrForbidden)
+	}
+	userID, _ := storage.OwnerFromContext(ctx)
+	return storage.WithOwner(storage.WithActor(ctx, userID), access.OwnerID), nil
+}
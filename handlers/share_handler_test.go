@@ -0,0 +1,508 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cmgchess/gotodo/models"
+	"github.com/cmgchess/gotodo/storage"
+	"github.com/gorilla/mux"
+)
+
+func TestShareHandlers(t *testing.T) {
+	const alice, bob = 1, 2
+	serve := func(shareHandler *ShareHandler, method, path, route, body string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(storage.WithOwner(req.Context(), bob))
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc(route, handler).Methods(method)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	shareStore := func(role string) *mockShareStore {
+		return &mockShareStore{
+			ListAccessFunc: func(ctx context.Context, listID int) (models.Access, error) {
+				if role == "" {
+					return models.Access{}, storage.ErrNotFound
+				}
+				return models.Access{OwnerID: alice, Role: role}, nil
+			},
+			GetSharesFunc: func(ctx context.Context, listID int) ([]models.Share, error) {
+				return []models.Share{{ListID: listID, UserID: bob, Role: role}}, nil
+			},
+			ShareListFunc: func(ctx context.Context, listID int, email, role string) (models.Share, error) {
+				if owner, _ := storage.OwnerFromContext(ctx); owner != alice {
+					t.Errorf("expected to share the list as its owner, got user %d", owner)
+				}
+				return models.Share{ListID: listID, UserID: 3, Email: email, Role: role}, nil
+			},
+			UnshareListFunc: func(ctx context.Context, listID, userID int) error {
+				return nil
+			},
+		}
+	}
+
+	t.Run("should return 200 with the shares of a list shared with the user", func(t *testing.T) {
+		shareHandler := NewShareHandler(shareStore(models.RoleViewer))
+
+		rr := serve(shareHandler, http.MethodGet, "/lists/1/shares", "/lists/{listID}/shares", "", shareHandler.GetSharesHandler)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 404 for the shares of a list not shared with the user", func(t *testing.T) {
+		shareHandler := NewShareHandler(shareStore(""))
+
+		rr := serve(shareHandler, http.MethodGet, "/lists/1/shares", "/lists/{listID}/shares", "", shareHandler.GetSharesHandler)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code 404, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 200 if list shared by an owner", func(t *testing.T) {
+		shareHandler := NewShareHandler(shareStore(models.RoleOwner))
+
+		rr := serve(shareHandler, http.MethodPost, "/lists/1/shares", "/lists/{listID}/shares", `{"email": "carol@example.com", "role": "editor"}`, shareHandler.ShareListHandler)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 403 if list shared by an editor", func(t *testing.T) {
+		shareHandler := NewShareHandler(shareStore(models.RoleEditor))
+
+		rr := serve(shareHandler, http.MethodPost, "/lists/1/shares", "/lists/{listID}/shares", `{"email": "carol@example.com", "role": "editor"}`, shareHandler.ShareListHandler)
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code 403, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 400 if role is unknown when sharing list", func(t *testing.T) {
+		shareHandler := NewShareHandler(shareStore(models.RoleOwner))
+
+		rr := serve(shareHandler, http.MethodPost, "/lists/1/shares", "/lists/{listID}/shares", `{"email": "carol@example.com", "role": "admin"}`, shareHandler.ShareListHandler)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 204 if a viewer leaves a list", func(t *testing.T) {
+		shareHandler := NewShareHandler(shareStore(models.RoleViewer))
+
+		rr := serve(shareHandler, http.MethodDelete, "/lists/1/shares/2", "/lists/{listID}/shares/{userID}", "", shareHandler.UnshareListHandler)
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("expected status code 204, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 403 if a viewer revokes another user", func(t *testing.T) {
+		shareHandler := NewShareHandler(shareStore(models.RoleViewer))
+
+		rr := serve(shareHandler, http.MethodDelete, "/lists/1/shares/3", "/lists/{listID}/shares/{userID}", "", shareHandler.UnshareListHandler)
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code 403, got %d", rr.Code)
+		}
+	})
+}
+
+func TestListHandlerShares(t *testing.T) {
+	const alice, bob = 1, 2
+	lists := &mockListStore{
+		GetListsFunc: func(ctx context.Context) ([]models.List, error) {
+			return []models.List{{ID: 1, OwnerID: bob, Name: "Inbox"}}, nil
+		},
+		GetListByIDFunc: func(ctx context.Context, id int) (*models.List, error) {
+			if owner, _ := storage.OwnerFromContext(ctx); owner != alice {
+				t.Errorf("expected to get the list as its owner, got user %d", owner)
+			}
+			return &models.List{ID: id, OwnerID: alice, Name: "Team"}, nil
+		},
+	}
+	shares := &mockShareStore{
+		GetSharedListsFunc: func(ctx context.Context) ([]models.List, error) {
+			return []models.List{{ID: 2, OwnerID: alice, Name: "Team", Role: models.RoleEditor}}, nil
+		},
+		ListAccessFunc: func(ctx context.Context, listID int) (models.Access, error) {
+			if listID != 2 {
+				return models.Access{}, storage.ErrNotFound
+			}
+			return models.Access{OwnerID: alice, Role: models.RoleViewer}, nil
+		},
+	}
+	listHandler := NewListHandler(lists, shares)
+	serve := func(path, route string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(storage.WithOwner(req.Context(), bob))
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc(route, handler).Methods(http.MethodGet)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should return the lists shared with the user after their own", func(t *testing.T) {
+		rr := serve("/lists", "/lists", listHandler.GetListsHandler)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, got %d", rr.Code)
+		}
+		var got []models.List
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || got[0].Role != models.RoleOwner || got[1].ID != 2 || got[1].Role != models.RoleEditor {
+			t.Errorf("expected the own list as owner and the shared one as editor, got %+v", got)
+		}
+	})
+
+	t.Run("should return 200 with the role for a list shared with the user", func(t *testing.T) {
+		rr := serve("/lists/2", "/lists/{listID}", listHandler.GetListByIDHandler)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, got %d", rr.Code)
+		}
+		var got models.List
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Role != models.RoleViewer {
+			t.Errorf("expected the viewer role, got %q", got.Role)
+		}
+	})
+
+	t.Run("should return 404 for a list not shared with the user", func(t *testing.T) {
+		rr := serve("/lists/3", "/lists/{listID}", listHandler.GetListByIDHandler)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code 404, got %d", rr.Code)
+		}
+	})
+}
+
+func TestTodoHandlerRoles(t *testing.T) {
+	const alice, bob = 1, 2
+	// private is a todo of alice in a list not shared with bob.
+	const private = 9
+	var actedFor int
+	act := func(ctx context.Context) *models.Todo {
+		actedFor, _ = storage.OwnerFromContext(ctx)
+		return &models.Todo{ID: 1, ListID: 1, OwnerID: alice}
+	}
+	store := &mockStore{
+		GetTodoByIDFunc: func(ctx context.Context, id int) (*models.Todo, error) {
+			return act(ctx), nil
+		},
+		ChangeEnableStatusFunc: func(ctx context.Context, id int, enabled bool, pre storage.Precondition) (*models.Todo, error) {
+			return act(ctx), nil
+		},
+		UpdateTodoFunc: func(ctx context.Context, id int, todoRequest models.TodoRequest, pre storage.Precondition) (*models.Todo, error) {
+			return act(ctx), nil
+		},
+		PatchTodoFunc: func(ctx context.Context, id int, patch storage.PatchFunc, pre storage.Precondition) (*models.Todo, error) {
+			if _, err := patch(models.TodoRequest{ListID: 1, Name: "shared todo"}); err != nil {
+				return nil, err
+			}
+			return act(ctx), nil
+		},
+		AddTodoFunc: func(ctx context.Context, todoRequest models.TodoRequest) (models.Todo, error) {
+			return *act(ctx), nil
+		},
+		DeleteTodoFunc: func(ctx context.Context, id int, permanent bool, pre storage.Precondition) error {
+			act(ctx)
+			return nil
+		},
+		GetTodosFunc: func(ctx context.Context, query storage.TodoQuery) (models.TodoPage, error) {
+			act(ctx)
+			return models.TodoPage{}, nil
+		},
+	}
+	serve := func(role, method, path, route, body string, handler func(*TodoHandler) http.HandlerFunc) *httptest.ResponseRecorder {
+		actedFor = 0
+		todoHandler := NewTodoHandler(store, &mockShareStore{
+			ListAccessFunc: func(ctx context.Context, listID int) (models.Access, error) {
+				if role == "" {
+					return models.Access{}, storage.ErrNotFound
+				}
+				return models.Access{OwnerID: alice, Role: role}, nil
+			},
+			TodoAccessFunc: func(ctx context.Context, todoID int) (models.Access, error) {
+				if role == "" || todoID == private {
+					return models.Access{}, storage.ErrNotFound
+				}
+				return models.Access{OwnerID: alice, Role: role}, nil
+			},
+		})
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		req = req.WithContext(storage.WithOwner(req.Context(), bob))
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc(route, handler(todoHandler)).Methods(method)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	get := func(h *TodoHandler) http.HandlerFunc { return h.GetTodoByIDHandler }
+	list := func(h *TodoHandler) http.HandlerFunc { return h.GetTodosHandler }
+	update := func(h *TodoHandler) http.HandlerFunc { return h.UpdateTodoHandler }
+	patch := func(h *TodoHandler) http.HandlerFunc { return h.PatchTodoHandler }
+	add := func(h *TodoHandler) http.HandlerFunc { return h.AddTodoHandler }
+	disable := func(h *TodoHandler) http.HandlerFunc { return h.DisableTodoHandler }
+	remove := func(h *TodoHandler) http.HandlerFunc { return h.DeleteTodoHandler }
+	body := `{"name": "shared todo", "description": "shared"}`
+
+	t.Run("should let a viewer read a shared todo as its owner", func(t *testing.T) {
+		rr := serve(models.RoleViewer, http.MethodGet, "/todos/1", "/todos/{id}", "", get)
+		if rr.Code != http.StatusOK || actedFor != alice {
+			t.Errorf("expected status code 200 acting for user %d, got %d acting for user %d", alice, rr.Code, actedFor)
+		}
+		rr = serve(models.RoleViewer, http.MethodGet, "/lists/1/todos", "/lists/{listID}/todos", "", list)
+		if rr.Code != http.StatusOK || actedFor != alice {
+			t.Errorf("expected status code 200 acting for user %d, got %d acting for user %d", alice, rr.Code, actedFor)
+		}
+	})
+
+	t.Run("should return 403 if a viewer changes a shared todo", func(t *testing.T) {
+		for name, rr := range map[string]*httptest.ResponseRecorder{
+			"PUT":     serve(models.RoleViewer, http.MethodPut, "/todos/1", "/todos/{id}", body, update),
+			"DELETE":  serve(models.RoleViewer, http.MethodDelete, "/todos/1", "/todos/{id}", "", remove),
+			"disable": serve(models.RoleViewer, http.MethodPatch, "/todos/1/disable", "/todos/{id}/disable", "", disable),
+		} {
+			if rr.Code != http.StatusForbidden || actedFor != 0 {
+				t.Errorf("%s: expected status code 403, got %d", name, rr.Code)
+			}
+		}
+	})
+
+	t.Run("should let an editor change a shared todo", func(t *testing.T) {
+		if rr := serve(models.RoleEditor, http.MethodPut, "/todos/1", "/todos/{id}", body, update); rr.Code != http.StatusOK || actedFor != alice {
+			t.Errorf("expected status code 200 acting for user %d, got %d", alice, rr.Code)
+		}
+		if rr := serve(models.RoleEditor, http.MethodDelete, "/todos/1", "/todos/{id}", "", remove); rr.Code != http.StatusNoContent {
+			t.Errorf("expected status code 204, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 403 if an editor moves a shared todo to another list", func(t *testing.T) {
+		rr := serve(models.RoleEditor, http.MethodPut, "/todos/1", "/todos/{id}", `{"list_id": 2, "name": "shared todo"}`, update)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code 403, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should let an editor give a shared todo a parent in a shared list", func(t *testing.T) {
+		if rr := serve(models.RoleEditor, http.MethodPatch, "/todos/1", "/todos/{id}", `{"parent_id": 2}`, patch); rr.Code != http.StatusOK || actedFor != alice {
+			t.Errorf("expected status code 200 acting for user %d, got %d", alice, rr.Code)
+		}
+		if rr := serve(models.RoleEditor, http.MethodPost, "/lists/1/todos", "/lists/{listID}/todos", `{"name": "subtask", "parent_id": 2}`, add); rr.Code != http.StatusCreated || actedFor != alice {
+			t.Errorf("expected status code 201 acting for user %d, got %d", alice, rr.Code)
+		}
+	})
+
+	t.Run("should return 404 if an editor gives a todo a parent not shared with them", func(t *testing.T) {
+		for name, rr := range map[string]*httptest.ResponseRecorder{
+			"POST":  serve(models.RoleEditor, http.MethodPost, "/lists/1/todos", "/lists/{listID}/todos", `{"name": "subtask", "parent_id": 9}`, add),
+			"PUT":   serve(models.RoleEditor, http.MethodPut, "/todos/1", "/todos/{id}", `{"name": "shared todo", "parent_id": 9}`, update),
+			"PATCH": serve(models.RoleEditor, http.MethodPatch, "/todos/1", "/todos/{id}", `{"parent_id": 9}`, patch),
+		} {
+			if rr.Code != http.StatusNotFound || actedFor != 0 {
+				t.Errorf("%s: expected status code 404, got %d", name, rr.Code)
+			}
+		}
+	})
+
+	t.Run("should return 404 for a todo not shared with the user", func(t *testing.T) {
+		for name, rr := range map[string]*httptest.ResponseRecorder{
+			"GET": serve("", http.MethodGet, "/todos/1", "/todos/{id}", "", get),
+			"PUT": serve("", http.MethodPut, "/todos/1", "/todos/{id}", body, update),
+		} {
+			if rr.Code != http.StatusNotFound || actedFor != 0 {
+				t.Errorf("%s: expected status code 404, got %d", name, rr.Code)
+			}
+		}
+	})
+}
+
+func TestSharedTodos(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	alice, err := store.AddUser(context.Background(), "alice@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := store.AddUser(context.Background(), "bob@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := storage.WithOwner(context.Background(), alice.ID)
+	shared, err := store.AddList(ctx, models.ListRequest{Name: "Team"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := store.AddList(ctx, models.ListRequest{Name: "Private"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ShareList(ctx, shared.ID, bob.Email, models.RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	todo, err := store.AddTodo(ctx, models.TodoRequest{ListID: shared.ID, Name: "shared"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subtask, err := store.AddTodo(ctx, models.TodoRequest{ParentID: &todo.ID, Name: "subtask"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	todoHandler := NewTodoHandler(store, store)
+	serve := func(userID int, method, path, route, body string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		req = req.WithContext(storage.WithOwner(req.Context(), userID))
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc(route, handler).Methods(method)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should return 409 if the owner puts a subtask of a shared todo in another list", func(t *testing.T) {
+		body := fmt.Sprintf(`{"name": "secret", "list_id": %d, "parent_id": %d}`, private.ID, todo.ID)
+		if rr := serve(alice.ID, http.MethodPost, "/todos", "/todos", body, todoHandler.AddTodoHandler); rr.Code != http.StatusConflict {
+			t.Errorf("expected status code 409 adding the subtask, got %d", rr.Code)
+		}
+		body = fmt.Sprintf(`{"list_id": %d}`, private.ID)
+		if rr := serve(alice.ID, http.MethodPatch, fmt.Sprintf("/todos/%d", subtask.ID), "/todos/{id}", body, todoHandler.PatchTodoHandler); rr.Code != http.StatusConflict {
+			t.Errorf("expected status code 409 moving the subtask, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should only show a viewer the subtasks in the shared list", func(t *testing.T) {
+		rr := serve(bob.ID, http.MethodGet, fmt.Sprintf("/todos/%d/tree", todo.ID), "/todos/{id}/tree", "", todoHandler.GetTodoTreeHandler)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, got %d", rr.Code)
+		}
+		var tree models.TodoTree
+		if err := json.NewDecoder(rr.Body).Decode(&tree); err != nil {
+			t.Fatal(err)
+		}
+		if len(tree.Children) != 1 || tree.Children[0].ID != subtask.ID || tree.Children[0].ListID != shared.ID {
+			t.Errorf("expected only the subtask in the shared list, got %+v", tree.Children)
+		}
+
+		rr = serve(bob.ID, http.MethodGet, fmt.Sprintf("/todos/%d/children", todo.ID), "/todos/{id}/children", "", todoHandler.GetTodoChildrenHandler)
+		var children []models.Todo
+		if err := json.NewDecoder(rr.Body).Decode(&children); err != nil {
+			t.Fatal(err)
+		}
+		if len(children) != 1 || children[0].ID != subtask.ID {
+			t.Errorf("expected only the subtask in the shared list, got %+v", children)
+		}
+	})
+
+	t.Run("should let an editor undo their own change to a shared todo", func(t *testing.T) {
+		if _, err := store.ShareList(ctx, shared.ID, bob.Email, models.RoleEditor); err != nil {
+			t.Fatal(err)
+		}
+		rr := serve(bob.ID, http.MethodPatch, fmt.Sprintf("/todos/%d", todo.ID), "/todos/{id}", `{"name": "renamed by bob"}`, todoHandler.PatchTodoHandler)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code 200 renaming the todo, got %d", rr.Code)
+		}
+
+		if rr := serve(alice.ID, http.MethodPost, "/undo", "/undo", "", todoHandler.UndoHandler); rr.Code != http.StatusConflict {
+			t.Errorf("expected status code 409 with nothing for alice to undo, got %d", rr.Code)
+		}
+		if rr := serve(bob.ID, http.MethodPost, "/undo", "/undo", "", todoHandler.UndoHandler); rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200 undoing bob's change, got %d", rr.Code)
+		}
+		got, err := store.GetTodoByID(ctx, todo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != "shared" {
+			t.Errorf("expected bob's change to be undone, got %q", got.Name)
+		}
+	})
+}
+
+// ownedShares is a ShareStorage under which the user owns every list and
+// todo, for tests that are not about sharing.
+type ownedShares struct {
+	storage.ShareStorage
+}
+
+func (ownedShares) ListAccess(ctx context.Context, listID int) (models.Access, error) {
+	userID, _ := storage.OwnerFromContext(ctx)
+	return models.Access{OwnerID: userID, Role: models.RoleOwner}, nil
+}
+
+func (ownedShares) GetSharedLists(ctx context.Context) ([]models.List, error) {
+	return []models.List{}, nil
+}
+
+func (ownedShares) TodoAccess(ctx context.Context, todoID int) (models.Access, error) {
+	userID, _ := storage.OwnerFromContext(ctx)
+	return models.Access{OwnerID: userID, Role: models.RoleOwner}, nil
+}
+
+type mockShareStore struct {
+	GetSharesFunc      func(ctx context.Context, listID int) ([]models.Share, error)
+	GetSharedListsFunc func(ctx context.Context) ([]models.List, error)
+	ShareListFunc      func(ctx context.Context, listID int, email, role string) (models.Share, error)
+	UnshareListFunc    func(ctx context.Context, listID, userID int) error
+	ListAccessFunc     func(ctx context.Context, listID int) (models.Access, error)
+	TodoAccessFunc     func(ctx context.Context, todoID int) (models.Access, error)
+}
+
+func (m *mockShareStore) GetShares(ctx context.Context, listID int) ([]models.Share, error) {
+	return m.GetSharesFunc(ctx, listID)
+}
+
+func (m *mockShareStore) GetSharedLists(ctx context.Context) ([]models.List, error) {
+	return m.GetSharedListsFunc(ctx)
+}
+
+func (m *mockShareStore) ShareList(ctx context.Context, listID int, email, role string) (models.Share, error) {
+	return m.ShareListFunc(ctx, listID, email, role)
+}
+
+func (m *mockShareStore) UnshareList(ctx context.Context, listID, userID int) error {
+	return m.UnshareListFunc(ctx, listID, userID)
+}
+
+func (m *mockShareStore) ListAccess(ctx context.Context, listID int) (models.Access, error) {
+	return m.ListAccessFunc(ctx, listID)
+}
+
+func (m *mockShareStore) TodoAccess(ctx context.Context, todoID int) (models.Access, error) {
+	return m.TodoAccessFunc(ctx, todoID)
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/cmgchess/gotodo/models"
+	"github.com/cmgchess/gotodo/storage"
+	"github.com/cmgchess/gotodo/utils"
+)
+
+type TagHandler struct {
+	store storage.TagStorage
+}
+
+func NewTagHandler(store storage.TagStorage) *TagHandler {
+	return &TagHandler{store: store}
+}
+
+func (h *TagHandler) GetTagsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tags, err := h.store.GetTags(ctx)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusOK, tags)
+}
+
+func (h *TagHandler) GetTagByIDHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	i, err := utils.ParseIDFromRequest(r)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid ID"))
+		return
+	}
+	tag, err := h.store.GetTagByID(ctx, i)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusOK, tag)
+}
+
+func (h *TagHandler) AddTagHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var tagRequest models.TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&tagRequest); err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid request payload"))
+		return
+	}
+	if err := utils.ValidateStruct(tagRequest); err != nil {
+		utils.ValidationError(w, r, err)
+		return
+	}
+
+	tag, err := h.store.AddTag(ctx, tagRequest)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusCreated, tag)
+}
+
+func (h *TagHandler) UpdateTagHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	i, err := utils.ParseIDFromRequest(r)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid ID"))
+		return
+	}
+	var tagRequest models.TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&tagRequest); err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid request payload"))
+		return
+	}
+	if err := utils.ValidateStruct(tagRequest); err != nil {
+		utils.ValidationError(w, r, err)
+		return
+	}
+
+	tag, err := h.store.UpdateTag(ctx, i, tagRequest)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusOK, tag)
+}
+
+func (h *TagHandler) DeleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	i, err := utils.ParseIDFromRequest(r)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid ID"))
+		return
+	}
+	if err := h.store.DeleteTag(ctx, i); err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AttachTagHandler adds the tag {tagID} to the todo {id} and responds with
+// the todo.
+func (h *TagHandler) AttachTagHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	todoID, tagID, err := parseTodoTagIDs(r)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+	todo, err := h.store.AttachTag(ctx, todoID, tagID, utils.ParsePrecondition(r))
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	writeTodo(w, http.StatusOK, todo)
+}
+
+// DetachTagHandler removes the tag {tagID} from the todo {id} and responds
+// with the todo.
+func (h *TagHandler) DetachTagHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	todoID, tagID, err := parseTodoTagIDs(r)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+	todo, err := h.store.DetachTag(ctx, todoID, tagID, utils.ParsePrecondition(r))
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	writeTodo(w, http.StatusOK, todo)
+}
+
+func parseTodoTagIDs(r *http.Request) (int, int, error) {
+	todoID, err := utils.ParseIDFromRequest(r)
+	if err != nil {
+		return 0, 0, errors.New("invalid ID")
+	}
+	tagID, err := utils.ParseIntVarFromRequest(r, "tagID")
+	if err != nil {
+		return 0, 0, errors.New("invalid tag ID")
+	}
+	return todoID, tagID, nil
+}
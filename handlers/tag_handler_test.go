@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cmgchess/gotodo/models"
+	"github.com/cmgchess/gotodo/storage"
+	"github.com/gorilla/mux"
+)
+
+func TestTagHandlers(t *testing.T) {
+	t.Run("should return 200 if tags return successfully", func(t *testing.T) {
+		tagHandler := NewTagHandler(&mockTagStore{
+			GetTagsFunc: func(ctx context.Context) ([]models.Tag, error) {
+				return []models.Tag{{ID: 1, Name: "work"}}, nil
+			},
+		})
+		req, err := http.NewRequest(http.MethodGet, "/tags", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/tags", tagHandler.GetTagsHandler).Methods(http.MethodGet)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 404 if tag not found", func(t *testing.T) {
+		tagHandler := NewTagHandler(&mockTagStore{
+			GetTagByIDFunc: func(ctx context.Context, id int) (*models.Tag, error) {
+				return nil, storage.ErrNotFound
+			},
+		})
+		req, err := http.NewRequest(http.MethodGet, "/tags/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/tags/{id}", tagHandler.GetTagByIDHandler).Methods(http.MethodGet)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code 404, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 201 if tag added successfully", func(t *testing.T) {
+		tagHandler := NewTagHandler(&mockTagStore{
+			AddTagFunc: func(ctx context.Context, tagRequest models.TagRequest) (models.Tag, error) {
+				return models.Tag{ID: 1, Name: tagRequest.Name}, nil
+			},
+		})
+		req, err := http.NewRequest(http.MethodPost, "/tags", strings.NewReader(`{"name": "work"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/tags", tagHandler.AddTagHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Errorf("expected status code 201, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 400 if model validation failed when adding tag", func(t *testing.T) {
+		tagHandler := NewTagHandler(&mockTagStore{})
+		req, err := http.NewRequest(http.MethodPost, "/tags", strings.NewReader(`{"name": ""}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/tags", tagHandler.AddTagHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 409 if tag name is taken when updating tag", func(t *testing.T) {
+		tagHandler := NewTagHandler(&mockTagStore{
+			UpdateTagFunc: func(ctx context.Context, id int, tagRequest models.TagRequest) (*models.Tag, error) {
+				return nil, storage.ErrConflict
+			},
+		})
+		req, err := http.NewRequest(http.MethodPut, "/tags/1", strings.NewReader(`{"name": "home"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/tags/{id}", tagHandler.UpdateTagHandler).Methods(http.MethodPut)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code 409, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 204 if tag deleted successfully", func(t *testing.T) {
+		tagHandler := NewTagHandler(&mockTagStore{
+			DeleteTagFunc: func(ctx context.Context, id int) error { return nil },
+		})
+		req, err := http.NewRequest(http.MethodDelete, "/tags/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/tags/{id}", tagHandler.DeleteTagHandler).Methods(http.MethodDelete)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("expected status code 204, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 200 with ETag if tag attached to todo", func(t *testing.T) {
+		var gotTodoID, gotTagID int
+		tagHandler := NewTagHandler(&mockTagStore{
+			AttachTagFunc: func(ctx context.Context, todoID, tagID int, pre storage.Precondition) (*models.Todo, error) {
+				gotTodoID, gotTagID = todoID, tagID
+				return &models.Todo{ID: todoID, Version: 2, Tags: []models.Tag{{ID: tagID, Name: "work"}}}, nil
+			},
+		})
+		req, err := http.NewRequest(http.MethodPut, "/todos/1/tags/2", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/tags/{tagID}", tagHandler.AttachTagHandler).Methods(http.MethodPut)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+		if gotTodoID != 1 || gotTagID != 2 {
+			t.Errorf("expected todo 1 and tag 2, got %d and %d", gotTodoID, gotTagID)
+		}
+		if rr.Header().Get("ETag") != `"2"` {
+			t.Errorf("expected ETag \"2\", got %q", rr.Header().Get("ETag"))
+		}
+	})
+
+	t.Run("should return 400 if invalid tag id passed when attaching tag", func(t *testing.T) {
+		tagHandler := NewTagHandler(&mockTagStore{})
+		req, err := http.NewRequest(http.MethodPut, "/todos/1/tags/abc", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/tags/{tagID}", tagHandler.AttachTagHandler).Methods(http.MethodPut)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 404 if tag is not attached when detaching tag", func(t *testing.T) {
+		tagHandler := NewTagHandler(&mockTagStore{
+			DetachTagFunc: func(ctx context.Context, todoID, tagID int, pre storage.Precondition) (*models.Todo, error) {
+				return nil, storage.ErrNotFound
+			},
+		})
+		req, err := http.NewRequest(http.MethodDelete, "/todos/1/tags/2", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/tags/{tagID}", tagHandler.DetachTagHandler).Methods(http.MethodDelete)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code 404, got %d", rr.Code)
+		}
+	})
+}
+
+type mockTagStore struct {
+	GetTagsFunc    func(ctx context.Context) ([]models.Tag, error)
+	GetTagByIDFunc func(ctx context.Context, id int) (*models.Tag, error)
+	AddTagFunc     func(ctx context.Context, tagRequest models.TagRequest) (models.Tag, error)
+	UpdateTagFunc  func(ctx context.Context, id int, tagRequest models.TagRequest) (*models.Tag, error)
+	DeleteTagFunc  func(ctx context.Context, id int) error
+	AttachTagFunc  func(ctx context.Context, todoID, tagID int, pre storage.Precondition) (*models.Todo, error)
+	DetachTagFunc  func(ctx context.Context, todoID, tagID int, pre storage.Precondition) (*models.Todo, error)
+}
+
+func (m *mockTagStore) GetTags(ctx context.Context) ([]models.Tag, error) {
+	return m.GetTagsFunc(ctx)
+}
+
+func (m *mockTagStore) GetTagByID(ctx context.Context, id int) (*models.Tag, error) {
+	return m.GetTagByIDFunc(ctx, id)
+}
+
+func (m *mockTagStore) AddTag(ctx context.Context, tagRequest models.TagRequest) (models.Tag, error) {
+	return m.AddTagFunc(ctx, tagRequest)
+}
+
+func (m *mockTagStore) UpdateTag(ctx context.Context, id int, tagRequest models.TagRequest) (*models.Tag, error) {
+	return m.UpdateTagFunc(ctx, id, tagRequest)
+}
+
+func (m *mockTagStore) DeleteTag(ctx context.Context, id int) error {
+	return m.DeleteTagFunc(ctx, id)
+}
+
+func (m *mockTagStore) AttachTag(ctx context.Context, todoID, tagID int, pre storage.Precondition) (*models.Todo, error) {
+	return m.AttachTagFunc(ctx, todoID, tagID, pre)
+}
+
+func (m *mockTagStore) DetachTag(ctx context.Context, todoID, tagID int, pre storage.Precondition) (*models.Todo, error) {
+	return m.DetachTagFunc(ctx, todoID, tagID, pre)
+}
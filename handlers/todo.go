@@ -1,10 +1,17 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cmgchess/gotodo/models"
 	"github.com/cmgchess/gotodo/storage"
@@ -12,129 +19,766 @@ import (
 	"github.com/go-playground/validator/v10"
 )
 
+const defaultSearchLimit = 20
+
+// Limits on the number of occurrences GetTodoOccurrencesHandler previews.
+const (
+	defaultOccurrenceLimit = 10
+	maxOccurrenceLimit     = 100
+)
+
+// invalidPatchError marks errors caused by the patch document itself rather
+// than by storage.
+type invalidPatchError struct {
+	err error
+}
+
+func (e invalidPatchError) Error() string { return e.err.Error() }
+
+func (e invalidPatchError) Unwrap() error { return e.err }
+
+// uncheckedParentError stops a patch that gives a todo a parent the role of
+// the user on which was not checked yet.
+type uncheckedParentError struct {
+	id int
+}
+
+func (e uncheckedParentError) Error() string {
+	return fmt.Sprintf("role on parent todo with id %d not checked", e.id)
+}
+
+// equalIDs reports whether two optional IDs are equal.
+func equalIDs(a, b *int) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+// writeTodo writes todo as JSON along with its ETag.
+func writeTodo(w http.ResponseWriter, status int, todo *models.Todo) {
+	w.Header().Set("ETag", utils.ETag(todo.Version))
+	utils.JSON(w, status, todo)
+}
+
+// TodoHandler serves todos, both the user's own and those in lists shared
+// with them. Every handler of a todo or list checks the user's role on it
+// first, and then acts for its owner: viewers can read, editors can also
+// change todos.
 type TodoHandler struct {
-	store storage.Storage
+	store  storage.Storage
+	shares storage.ShareStorage
 }
 
-func NewTodoHandler(store storage.Storage) *TodoHandler {
-	return &TodoHandler{store: store}
+func NewTodoHandler(store storage.Storage, shares storage.ShareStorage) *TodoHandler {
+	return &TodoHandler{store: store, shares: shares}
 }
 
 func (h *TodoHandler) GetTodosHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseTodoQuery(r)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+	ctx, err := h.queryContext(r, query)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	page, err := h.store.GetTodos(ctx, query)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusOK, page)
+}
+
+// GetOverdueTodosHandler lists open, enabled todos whose due date has
+// passed. It accepts the same list options as GetTodosHandler.
+func (h *TodoHandler) GetOverdueTodosHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseTodoQuery(r)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+	ctx, err := h.queryContext(r, query)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	now := time.Now().UTC()
+	completed, enabled := false, true
+	query.Completed = &completed
+	query.Enabled = &enabled
+	if query.DueBefore == nil || query.DueBefore.After(now) {
+		query.DueBefore = &now
+	}
+
+	page, err := h.store.GetTodos(ctx, query)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusOK, page)
+}
+
+// queryContext returns the context to list the todos of query in: that of
+// the owner of the list it is restricted to, if any.
+func (h *TodoHandler) queryContext(r *http.Request, query storage.TodoQuery) (context.Context, error) {
+	if query.ListID == 0 {
+		return r.Context(), nil
+	}
+	return listContext(r, h.shares, query.ListID, models.RoleViewer)
+}
+
+func (h *TodoHandler) SearchTodosHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	todos, err := h.store.GetTodos(ctx)
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("missing search query"))
+		return
+	}
+	limit := defaultSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > storage.MaxTodoLimit {
+			utils.Error(w, r, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", storage.MaxTodoLimit))
+			return
+		}
+		limit = l
+	}
+
+	results, err := h.store.SearchTodos(ctx, q, limit)
 	if err != nil {
-		utils.Error(w, http.StatusInternalServerError, errors.New("internal server error"))
+		utils.StorageError(w, r, err)
 		return
 	}
-	utils.JSON(w, http.StatusOK, todos)
+	utils.JSON(w, http.StatusOK, results)
 }
 
 func (h *TodoHandler) GetTodoByIDHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
 	i, err := utils.ParseIDFromRequest(r)
 	if err != nil {
-		utils.Error(w, http.StatusBadRequest, errors.New("invalid ID"))
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid ID"))
+		return
+	}
+	ctx, err := todoContext(r, h.shares, i, models.RoleViewer)
+	if err != nil {
+		utils.StorageError(w, r, err)
 		return
 	}
 
 	todo, err := h.store.GetTodoByID(ctx, i)
 	if err != nil {
-		utils.Error(w, http.StatusNotFound, err)
+		utils.StorageError(w, r, err)
 		return
 	}
 
-	utils.JSON(w, http.StatusOK, todo)
+	pre := utils.ParsePrecondition(r)
+	if pre.NotModified(todo.Version) {
+		w.Header().Set("ETag", utils.ETag(todo.Version))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if !pre.Matches(todo.Version) {
+		utils.Error(w, r, http.StatusPreconditionFailed, errors.New("precondition failed"))
+		return
+	}
+	writeTodo(w, http.StatusOK, todo)
 }
 
+// GetTodoChildrenHandler lists the direct subtasks of a todo.
+func (h *TodoHandler) GetTodoChildrenHandler(w http.ResponseWriter, r *http.Request) {
+	i, err := utils.ParseIDFromRequest(r)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid ID"))
+		return
+	}
+	ctx, err := todoContext(r, h.shares, i, models.RoleViewer)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	children, err := h.store.GetChildren(ctx, i)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusOK, children)
+}
+
+// GetTodoTreeHandler returns a todo with all of its subtasks, recursively.
+// Subtasks are always in the list of their parent, so the role on the todo
+// covers them too.
+func (h *TodoHandler) GetTodoTreeHandler(w http.ResponseWriter, r *http.Request) {
+	i, err := utils.ParseIDFromRequest(r)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid ID"))
+		return
+	}
+	ctx, err := todoContext(r, h.shares, i, models.RoleViewer)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	tree, err := h.store.GetTodoTree(ctx, i)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusOK, tree)
+}
+
+// GetTodoOccurrencesHandler previews the due dates of the next occurrences
+// of a recurring todo, up to ?limit= of them. It lists none for a todo that
+// does not recur.
+func (h *TodoHandler) GetTodoOccurrencesHandler(w http.ResponseWriter, r *http.Request) {
+	i, err := utils.ParseIDFromRequest(r)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid ID"))
+		return
+	}
+	ctx, err := todoContext(r, h.shares, i, models.RoleViewer)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	limit := defaultOccurrenceLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > maxOccurrenceLimit {
+			utils.Error(w, r, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxOccurrenceLimit))
+			return
+		}
+		limit = l
+	}
+
+	todo, err := h.store.GetTodoByID(ctx, i)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusOK, todo.Occurrences(time.Now().UTC(), limit))
+}
+
+// GetTodoHistoryHandler lists the changes made to a todo, most recent first,
+// a page of up to ?limit= of them at a time starting at ?cursor=.
+func (h *TodoHandler) GetTodoHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	i, err := utils.ParseIDFromRequest(r)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid ID"))
+		return
+	}
+	ctx, err := todoContext(r, h.shares, i, models.RoleViewer)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	query := storage.HistoryQuery{Cursor: r.URL.Query().Get("cursor")}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > storage.MaxHistoryLimit {
+			utils.Error(w, r, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", storage.MaxHistoryLimit))
+			return
+		}
+		query.Limit = l
+	}
+
+	page, err := h.store.GetTodoHistory(ctx, i, query)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusOK, page)
+}
+
+// AddTodoHandler creates a todo. On routes nested under /lists/{listID} the
+// todo is created in that list, whatever the payload says. Adding a todo to
+// a shared list, or a subtask to a shared todo, takes the editor role on
+// both.
 func (h *TodoHandler) AddTodoHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
 	var todoRequest models.TodoRequest
 	if err := json.NewDecoder(r.Body).Decode(&todoRequest); err != nil {
-		utils.Error(w, http.StatusBadRequest, errors.New("invalid request payload"))
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid request payload"))
 		return
 	}
+	if listID, ok, err := listIDFromPath(r); err != nil {
+		utils.Error(w, r, http.StatusBadRequest, err)
+		return
+	} else if ok {
+		todoRequest.ListID = listID
+	}
 	if err := utils.ValidateStruct(todoRequest); err != nil {
-		errors := err.(validator.ValidationErrors)
-		utils.Error(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		utils.ValidationError(w, r, err)
+		return
+	}
+	ctx := r.Context()
+	var err error
+	switch {
+	case todoRequest.ListID != 0:
+		ctx, err = listContext(r, h.shares, todoRequest.ListID, models.RoleEditor)
+		if err == nil && todoRequest.ParentID != nil {
+			err = h.checkParent(r, ctx, *todoRequest.ParentID)
+		}
+	case todoRequest.ParentID != nil:
+		ctx, err = todoContext(r, h.shares, *todoRequest.ParentID, models.RoleEditor)
+	}
+	if err != nil {
+		utils.StorageError(w, r, err)
 		return
 	}
 
 	todo, err := h.store.AddTodo(ctx, todoRequest)
 	if err != nil {
-		utils.Error(w, http.StatusInternalServerError, errors.New("internal server error"))
+		utils.StorageError(w, r, err)
 		return
 	}
-	utils.JSON(w, http.StatusCreated, todo)
+	writeTodo(w, http.StatusCreated, &todo)
 }
 
 func (h *TodoHandler) EnableTodoHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
 	i, err := utils.ParseIDFromRequest(r)
 	if err != nil {
-		utils.Error(w, http.StatusBadRequest, errors.New("invalid ID"))
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid ID"))
+		return
+	}
+	ctx, err := todoContext(r, h.shares, i, models.RoleEditor)
+	if err != nil {
+		utils.StorageError(w, r, err)
 		return
 	}
-	todo, err := h.store.ChangeEnableStatus(ctx, i, true)
+	todo, err := h.store.ChangeEnableStatus(ctx, i, true, utils.ParsePrecondition(r))
 	if err != nil {
-		utils.Error(w, http.StatusNotFound, err)
+		utils.StorageError(w, r, err)
 		return
 	}
-	utils.JSON(w, http.StatusOK, todo)
+	writeTodo(w, http.StatusOK, todo)
 }
 
 func (h *TodoHandler) DisableTodoHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
 	i, err := utils.ParseIDFromRequest(r)
 	if err != nil {
-		utils.Error(w, http.StatusBadRequest, errors.New("invalid ID"))
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid ID"))
+		return
+	}
+	ctx, err := todoContext(r, h.shares, i, models.RoleEditor)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	todo, err := h.store.ChangeEnableStatus(ctx, i, false, utils.ParsePrecondition(r))
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	writeTodo(w, http.StatusOK, todo)
+}
+
+// CompleteTodoHandler completes a todo. A todo blocked by open todos is
+// only completed with ?force=true.
+func (h *TodoHandler) CompleteTodoHandler(w http.ResponseWriter, r *http.Request) {
+	i, err := utils.ParseIDFromRequest(r)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid ID"))
+		return
+	}
+	ctx, err := todoContext(r, h.shares, i, models.RoleEditor)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	force, err := parseBoolParam(r.URL.Query().Get("force"), "force")
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+	todo, err := h.store.ChangeCompleteStatus(ctx, i, true, force != nil && *force, utils.ParsePrecondition(r))
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	writeTodo(w, http.StatusOK, todo)
+}
+
+func (h *TodoHandler) ReopenTodoHandler(w http.ResponseWriter, r *http.Request) {
+	i, err := utils.ParseIDFromRequest(r)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid ID"))
 		return
 	}
-	todo, err := h.store.ChangeEnableStatus(ctx, i, false)
+	ctx, err := todoContext(r, h.shares, i, models.RoleEditor)
 	if err != nil {
-		utils.Error(w, http.StatusNotFound, err)
+		utils.StorageError(w, r, err)
 		return
 	}
-	utils.JSON(w, http.StatusOK, todo)
+	todo, err := h.store.ChangeCompleteStatus(ctx, i, false, false, utils.ParsePrecondition(r))
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	writeTodo(w, http.StatusOK, todo)
 }
 
+// UpdateTodoHandler replaces the writable fields of a todo. Only the owner
+// of a shared todo can move it to another list, and its parent takes the
+// editor role.
 func (h *TodoHandler) UpdateTodoHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
 	i, err := utils.ParseIDFromRequest(r)
 	if err != nil {
-		utils.Error(w, http.StatusBadRequest, errors.New("invalid ID"))
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid ID"))
+		return
+	}
+	ctx, owned, err := h.editContext(r, i)
+	if err != nil {
+		utils.StorageError(w, r, err)
 		return
 	}
 	var todoRequest models.TodoRequest
 	if err := json.NewDecoder(r.Body).Decode(&todoRequest); err != nil {
-		utils.Error(w, http.StatusBadRequest, errors.New("invalid request payload"))
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid request payload"))
 		return
 	}
 
 	if err := utils.ValidateStruct(todoRequest); err != nil {
-		errors := err.(validator.ValidationErrors)
-		utils.Error(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		utils.ValidationError(w, r, err)
+		return
+	}
+	if !owned && todoRequest.ListID != 0 {
+		current, err := h.store.GetTodoByID(ctx, i)
+		if err != nil {
+			utils.StorageError(w, r, err)
+			return
+		}
+		if current.ListID != todoRequest.ListID {
+			utils.StorageError(w, r, errSharedTodoMoved)
+			return
+		}
+	}
+	if todoRequest.ParentID != nil {
+		if err := h.checkParent(r, ctx, *todoRequest.ParentID); err != nil {
+			utils.StorageError(w, r, err)
+			return
+		}
+	}
+
+	todo, err := h.store.UpdateTodo(ctx, i, todoRequest, utils.ParsePrecondition(r))
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	writeTodo(w, http.StatusOK, todo)
+}
+
+// PatchTodoHandler applies a JSON Merge Patch or JSON Patch document to the
+// writable fields of a todo. The result must pass the same validation as a
+// full TodoRequest. Only the owner of a shared todo can move it to another
+// list, and a new parent takes the editor role. The role on the parent is
+// checked outside of the store, which then applies the patch again.
+func (h *TodoHandler) PatchTodoHandler(w http.ResponseWriter, r *http.Request) {
+	i, err := utils.ParseIDFromRequest(r)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid ID"))
+		return
+	}
+	ctx, owned, err := h.editContext(r, i)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+
+	var apply func(doc, patch []byte) ([]byte, error)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case utils.MergePatchContentType:
+		apply = utils.MergePatch
+	case utils.JSONPatchContentType:
+		apply = utils.JSONPatch
+	default:
+		w.Header().Set("Accept-Patch", utils.MergePatchContentType+", "+utils.JSONPatchContentType)
+		utils.Error(w, r, http.StatusUnsupportedMediaType, fmt.Errorf("content type must be %s or %s", utils.MergePatchContentType, utils.JSONPatchContentType))
+		return
+	}
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid request payload"))
 		return
 	}
 
-	todo, err := h.store.UpdateTodo(ctx, i, todoRequest)
+	var checkedParent *int
+	patchTodo := func(current models.TodoRequest) (models.TodoRequest, error) {
+		doc, err := json.Marshal(current)
+		if err != nil {
+			return current, err
+		}
+		patched, err := apply(doc, patch)
+		if err != nil {
+			return current, invalidPatchError{err}
+		}
+		var todoRequest models.TodoRequest
+		decoder := json.NewDecoder(bytes.NewReader(patched))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&todoRequest); err != nil {
+			return current, invalidPatchError{err}
+		}
+		if err := utils.ValidateStruct(todoRequest); err != nil {
+			return current, err
+		}
+		if !owned && todoRequest.ListID != 0 && todoRequest.ListID != current.ListID {
+			return current, errSharedTodoMoved
+		}
+		if parentID := todoRequest.ParentID; parentID != nil && !equalIDs(parentID, current.ParentID) && !equalIDs(parentID, checkedParent) {
+			return current, uncheckedParentError{*parentID}
+		}
+		return todoRequest, nil
+	}
+	todo, err := h.store.PatchTodo(ctx, i, patchTodo, utils.ParsePrecondition(r))
+	var uncheckedParent uncheckedParentError
+	if errors.As(err, &uncheckedParent) {
+		checkedParent = &uncheckedParent.id
+		if err = h.checkParent(r, ctx, uncheckedParent.id); err == nil {
+			todo, err = h.store.PatchTodo(ctx, i, patchTodo, utils.ParsePrecondition(r))
+		}
+	}
+	if errors.As(err, &uncheckedParent) {
+		err = fmt.Errorf("parent of todo with id %d changed while patching it: %w", i, storage.ErrConflict)
+	}
+
+	var validationErrors validator.ValidationErrors
+	var invalidPatch invalidPatchError
+	switch {
+	case err == nil:
+		writeTodo(w, http.StatusOK, todo)
+	case errors.As(err, &validationErrors):
+		utils.ValidationError(w, r, err)
+	case errors.Is(err, utils.ErrPatchTestFailed):
+		utils.Error(w, r, http.StatusConflict, err)
+	case errors.As(err, &invalidPatch):
+		utils.Error(w, r, http.StatusBadRequest, fmt.Errorf("invalid patch: %v", err))
+	default:
+		utils.StorageError(w, r, err)
+	}
+}
+
+// AddDependencyHandler marks the todo {id} as blocked by the todo
+// {blockerID} and responds with the todo.
+func (h *TodoHandler) AddDependencyHandler(w http.ResponseWriter, r *http.Request) {
+	i, blockerID, err := parseDependencyIDs(r)
 	if err != nil {
-		utils.Error(w, http.StatusNotFound, err)
+		utils.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
-	utils.JSON(w, http.StatusOK, todo)
+	ctx, err := h.dependencyContext(r, i, blockerID)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	todo, err := h.store.AddDependency(ctx, i, blockerID, utils.ParsePrecondition(r))
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	writeTodo(w, http.StatusOK, todo)
 }
 
+// RemoveDependencyHandler removes the todo {blockerID} from the todos
+// blocking {id} and responds with the todo.
+func (h *TodoHandler) RemoveDependencyHandler(w http.ResponseWriter, r *http.Request) {
+	i, blockerID, err := parseDependencyIDs(r)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+	ctx, err := h.dependencyContext(r, i, blockerID)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	todo, err := h.store.RemoveDependency(ctx, i, blockerID, utils.ParsePrecondition(r))
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	writeTodo(w, http.StatusOK, todo)
+}
+
+// MoveTodoHandler moves a todo right before the todo "before" or right
+// after the todo "after" in the manual order, and responds with the todo.
+func (h *TodoHandler) MoveTodoHandler(w http.ResponseWriter, r *http.Request) {
+	i, err := utils.ParseIDFromRequest(r)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid ID"))
+		return
+	}
+	ctx, err := todoContext(r, h.shares, i, models.RoleEditor)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	var moveRequest models.MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&moveRequest); err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid request payload"))
+		return
+	}
+	if err := utils.ValidateStruct(moveRequest); err != nil {
+		utils.ValidationError(w, r, err)
+		return
+	}
+	if moveRequest.Before == nil && moveRequest.After == nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("before or after is required"))
+		return
+	}
+	for _, target := range []*int{moveRequest.Before, moveRequest.After} {
+		if target == nil {
+			continue
+		}
+		if _, err := todoContext(r, h.shares, *target, models.RoleViewer); err != nil {
+			utils.StorageError(w, r, err)
+			return
+		}
+	}
+
+	todo, err := h.store.MoveTodo(ctx, i, moveRequest, utils.ParsePrecondition(r))
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	writeTodo(w, http.StatusOK, todo)
+}
+
+// editContext returns a context to change the todo id in, which takes the
+// editor role, and whether the user of r owns the todo.
+func (h *TodoHandler) editContext(r *http.Request, id int) (context.Context, bool, error) {
+	access, err := h.shares.TodoAccess(r.Context(), id)
+	if err != nil {
+		return nil, false, err
+	}
+	ctx, err := withAccess(r.Context(), access, models.RoleEditor)
+	if err != nil {
+		return nil, false, err
+	}
+	userID, _ := storage.OwnerFromContext(r.Context())
+	return ctx, access.OwnerID == userID, nil
+}
+
+// checkParent checks that the user of r has the editor role on the todo
+// parentID, and that it belongs to the user ctx acts for.
+func (h *TodoHandler) checkParent(r *http.Request, ctx context.Context, parentID int) error {
+	access, err := h.shares.TodoAccess(r.Context(), parentID)
+	if err != nil {
+		return err
+	}
+	if _, err := withAccess(r.Context(), access, models.RoleEditor); err != nil {
+		return err
+	}
+	if ownerID, _ := storage.OwnerFromContext(ctx); ownerID != access.OwnerID {
+		return errParentOwner
+	}
+	return nil
+}
+
+// dependencyContext returns a context to change the todos blocking id in,
+// which takes the editor role on id and the viewer role on blockerID.
+func (h *TodoHandler) dependencyContext(r *http.Request, id, blockerID int) (context.Context, error) {
+	ctx, err := todoContext(r, h.shares, id, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := todoContext(r, h.shares, blockerID, models.RoleViewer); err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+func parseDependencyIDs(r *http.Request) (int, int, error) {
+	id, err := utils.ParseIDFromRequest(r)
+	if err != nil {
+		return 0, 0, errors.New("invalid ID")
+	}
+	blockerID, err := utils.ParseIntVarFromRequest(r, "blockerID")
+	if err != nil {
+		return 0, 0, errors.New("invalid blocking todo ID")
+	}
+	return id, blockerID, nil
+}
+
+// DeleteTodoHandler moves a todo to the trash, or deletes it for good with
+// ?permanent=true.
 func (h *TodoHandler) DeleteTodoHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
 	i, err := utils.ParseIDFromRequest(r)
 	if err != nil {
-		utils.Error(w, http.StatusBadRequest, errors.New("invalid ID"))
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid ID"))
 		return
 	}
-	if err := h.store.DeleteTodo(ctx, i); err != nil {
-		utils.Error(w, http.StatusNotFound, err)
+	ctx, err := todoContext(r, h.shares, i, models.RoleEditor)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	permanent, err := parseBoolParam(r.URL.Query().Get("permanent"), "permanent")
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.store.DeleteTodo(ctx, i, permanent != nil && *permanent, utils.ParsePrecondition(r)); err != nil {
+		utils.StorageError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// GetTrashHandler lists the todos in the trash, most recently deleted first.
+func (h *TodoHandler) GetTrashHandler(w http.ResponseWriter, r *http.Request) {
+	todos, err := h.store.GetTrash(r.Context())
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusOK, todos)
+}
+
+// RestoreTodoHandler takes a todo out of the trash and responds with it.
+func (h *TodoHandler) RestoreTodoHandler(w http.ResponseWriter, r *http.Request) {
+	i, err := utils.ParseIDFromRequest(r)
+	if err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid ID"))
+		return
+	}
+	ctx, err := todoContext(r, h.shares, i, models.RoleEditor)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	todo, err := h.store.RestoreTodo(ctx, i, utils.ParsePrecondition(r))
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	writeTodo(w, http.StatusOK, todo)
+}
+
+// UndoHandler reverts the last ?n= undoable changes, one by default, and
+// responds with the changes it reverted, most recent first.
+func (h *TodoHandler) UndoHandler(w http.ResponseWriter, r *http.Request) {
+	h.undo(w, r, h.store.Undo)
+}
+
+// RedoHandler applies the last ?n= undone changes again, one by default, and
+// responds with the changes it applied.
+func (h *TodoHandler) RedoHandler(w http.ResponseWriter, r *http.Request) {
+	h.undo(w, r, h.store.Redo)
+}
+
+func (h *TodoHandler) undo(w http.ResponseWriter, r *http.Request, revert func(ctx context.Context, n int) ([]models.TodoEvent, error)) {
+	n := 1
+	if v := r.URL.Query().Get("n"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 1 || i > storage.UndoDepth {
+			utils.Error(w, r, http.StatusBadRequest, fmt.Errorf("n must be between 1 and %d", storage.UndoDepth))
+			return
+		}
+		n = i
+	}
+	events, err := revert(r.Context(), n)
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusOK, events)
+}
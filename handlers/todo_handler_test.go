@@ -2,23 +2,28 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cmgchess/gotodo/models"
+	"github.com/cmgchess/gotodo/storage"
+	"github.com/cmgchess/gotodo/utils"
 	"github.com/gorilla/mux"
 )
 
 func TestTodoHandlers(t *testing.T) {
 	t.Run("should return 200 if todos return successfully", func(t *testing.T) {
 		todoHandler := NewTodoHandler(&mockStore{
-			GetTodosFunc: func(ctx context.Context) ([]models.Todo, error) {
-				return []models.Todo{}, nil
+			GetTodosFunc: func(ctx context.Context, query storage.TodoQuery) (models.TodoPage, error) {
+				return models.TodoPage{Todos: []models.Todo{}}, nil
 			},
-		})
+		}, ownedShares{})
 		req, err := http.NewRequest(http.MethodGet, "/todos", nil)
 		if err != nil {
 			t.Fatal(err)
@@ -36,56 +41,112 @@ func TestTodoHandlers(t *testing.T) {
 
 	t.Run("should return 500 if internal error occurs when fetching todos", func(t *testing.T) {
 		todoHandler := NewTodoHandler(&mockStore{
-			GetTodosFunc: func(ctx context.Context) ([]models.Todo, error) {
-				return nil, errors.New("internal server error")
+			GetTodosFunc: func(ctx context.Context, query storage.TodoQuery) (models.TodoPage, error) {
+				return models.TodoPage{}, errors.New("internal server error")
 			},
-		})
+		}, ownedShares{})
 		req, err := http.NewRequest(http.MethodGet, "/todos", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
-		
+
 		router.HandleFunc("/todos", todoHandler.GetTodosHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
-	
+
 		if rr.Code != http.StatusInternalServerError {
 			t.Errorf("expected status code 500, got %d", rr.Code)
 		}
 	})
 
-	t.Run("should return 200 if todo by ID return successfully", func(t *testing.T) {
+	t.Run("should pass list options to storage when fetching todos", func(t *testing.T) {
+		var got storage.TodoQuery
 		todoHandler := NewTodoHandler(&mockStore{
-			GetTodoByIDFunc: func(ctx context.Context, id int) (*models.Todo, error) {
-				return &models.Todo{ID: id, Name: "Test Todo"}, nil
+			GetTodosFunc: func(ctx context.Context, query storage.TodoQuery) (models.TodoPage, error) {
+				got = query
+				return models.TodoPage{Todos: []models.Todo{}}, nil
 			},
-		})
-		req, err := http.NewRequest(http.MethodGet, "/todos/1", nil)
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos?limit=10&sort=-name&completed=true&created_after=2025-01-01T00:00:00Z&cursor=abc&tag=work&tag=home&tag_match=all", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos/{id}", todoHandler.GetTodoByIDHandler).Methods(http.MethodGet)
+		router.HandleFunc("/todos", todoHandler.GetTodosHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusOK {
 			t.Errorf("expected status code 200, got %d", rr.Code)
 		}
+		if got.Limit != 10 || got.Sort != storage.SortName || !got.Desc || got.Cursor != "abc" {
+			t.Errorf("unexpected query %+v", got)
+		}
+		if got.Completed == nil || !*got.Completed || got.Enabled != nil || got.CreatedAfter == nil {
+			t.Errorf("unexpected filters %+v", got)
+		}
+		if strings.Join(got.Tags, ",") != "work,home" || !got.MatchAllTags {
+			t.Errorf("unexpected tag filters %+v", got)
+		}
 	})
 
-	t.Run("should return 400 if invalid id passed when get todo by ID", func(t *testing.T) {
-		todoHandler := NewTodoHandler(&mockStore{})
-		req, err := http.NewRequest(http.MethodGet, "/todos/bla", nil)
+	t.Run("should return 400 if invalid list options passed when fetching todos", func(t *testing.T) {
+		for _, q := range []string{"limit=0", "limit=abc", "sort=color", "completed=maybe", "created_before=yesterday", "tag_match=some"} {
+			todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+			req, err := http.NewRequest(http.MethodGet, "/todos?"+q, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+
+			router.HandleFunc("/todos", todoHandler.GetTodosHandler).Methods(http.MethodGet)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status code 400, got %d", q, rr.Code)
+			}
+		}
+	})
+
+	t.Run("should restrict todos to the list in the path", func(t *testing.T) {
+		var got storage.TodoQuery
+		todoHandler := NewTodoHandler(&mockStore{
+			GetTodosFunc: func(ctx context.Context, query storage.TodoQuery) (models.TodoPage, error) {
+				got = query
+				return models.TodoPage{Todos: []models.Todo{}}, nil
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/lists/2/todos", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos/{id}", todoHandler.GetTodoByIDHandler).Methods(http.MethodGet)
+		router.HandleFunc("/lists/{listID}/todos", todoHandler.GetTodosHandler).Methods(http.MethodGet)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+		if got.ListID != 2 {
+			t.Errorf("expected list 2, got %d", got.ListID)
+		}
+	})
+
+	t.Run("should return 400 if list id in the path is invalid when fetching todos", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/lists/abc/todos", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/lists/{listID}/todos", todoHandler.GetTodosHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusBadRequest {
@@ -93,78 +154,93 @@ func TestTodoHandlers(t *testing.T) {
 		}
 	})
 
-	t.Run("should return 404 if todo not found when get todo by ID", func(t *testing.T) {
+	t.Run("should return 400 if cursor is invalid when fetching todos", func(t *testing.T) {
 		todoHandler := NewTodoHandler(&mockStore{
-			GetTodoByIDFunc: func(ctx context.Context, id int) (*models.Todo, error) {
-				return nil, errors.New("todo not found")
+			GetTodosFunc: func(ctx context.Context, query storage.TodoQuery) (models.TodoPage, error) {
+				return models.TodoPage{}, storage.ErrInvalidCursor
 			},
-		})
-		req, err := http.NewRequest(http.MethodGet, "/todos/1", nil)
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos?cursor=bla", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos/{id}", todoHandler.GetTodoByIDHandler).Methods(http.MethodGet)
+		router.HandleFunc("/todos", todoHandler.GetTodosHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
-		if rr.Code != http.StatusNotFound {
-			t.Errorf("expected status code 404, got %d", rr.Code)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
 		}
 	})
 
-	t.Run("should return 201 if todo added successfully", func(t *testing.T) {
+	t.Run("should only list open and enabled todos past their due date when fetching overdue todos", func(t *testing.T) {
+		var got storage.TodoQuery
 		todoHandler := NewTodoHandler(&mockStore{
-			AddTodoFunc: func(ctx context.Context, todoRequest models.TodoRequest) (models.Todo, error) {
-				return models.Todo{ID: 1, Name: todoRequest.Name}, nil
+			GetTodosFunc: func(ctx context.Context, query storage.TodoQuery) (models.TodoPage, error) {
+				got = query
+				return models.TodoPage{Todos: []models.Todo{}}, nil
 			},
-		})
-		body := strings.NewReader(`{"name": "Test Todo", "description": "Testing add"}`)
-		req, err := http.NewRequest(http.MethodPost, "/todos", body)
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos/overdue?completed=true&due_before=2999-01-01T00:00:00Z", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos", todoHandler.AddTodoHandler).Methods(http.MethodPost)
+		router.HandleFunc("/todos/overdue", todoHandler.GetOverdueTodosHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
-		if rr.Code != http.StatusCreated {
-			t.Errorf("expected status code 201, got %d", rr.Code)
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+		if got.Completed == nil || *got.Completed || got.Enabled == nil || !*got.Enabled {
+			t.Errorf("expected open and enabled filters, got %+v", got)
+		}
+		if got.DueBefore == nil || got.DueBefore.After(time.Now()) {
+			t.Errorf("expected due_before to be capped at now, got %v", got.DueBefore)
 		}
 	})
 
-	t.Run("should return 400 if invalid payload when adding todo", func(t *testing.T) {
-		todoHandler := NewTodoHandler(&mockStore{})
-		body := strings.NewReader("hello")
-		req, err := http.NewRequest(http.MethodPost, "/todos", body)
+	t.Run("should return 200 if search returns successfully", func(t *testing.T) {
+		var gotQ string
+		var gotLimit int
+		todoHandler := NewTodoHandler(&mockStore{
+			SearchTodosFunc: func(ctx context.Context, q string, limit int) ([]models.TodoSearchResult, error) {
+				gotQ, gotLimit = q, limit
+				return []models.TodoSearchResult{}, nil
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos/search?q=buy+milk&limit=5", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos", todoHandler.AddTodoHandler).Methods(http.MethodPost)
+		router.HandleFunc("/todos/search", todoHandler.SearchTodosHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
-		if rr.Code != http.StatusBadRequest {
-			t.Errorf("expected status code 400, got %d", rr.Code)
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+		if gotQ != "buy milk" || gotLimit != 5 {
+			t.Errorf("expected query %q with limit 5, got %q with limit %d", "buy milk", gotQ, gotLimit)
 		}
 	})
 
-	t.Run("should return 400 if model validation failed when adding todo", func(t *testing.T) {
-		todoHandler := NewTodoHandler(&mockStore{})
-		body := strings.NewReader(`{"description": ""}`)
-		req, err := http.NewRequest(http.MethodPost, "/todos", body)
+	t.Run("should return 400 if search query is missing", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos/search?q=+", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos", todoHandler.AddTodoHandler).Methods(http.MethodPost)
+		router.HandleFunc("/todos/search", todoHandler.SearchTodosHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusBadRequest {
@@ -172,21 +248,20 @@ func TestTodoHandlers(t *testing.T) {
 		}
 	})
 
-	t.Run("should return 500 if internal error occurs when adding todo", func(t *testing.T) {
+	t.Run("should return 500 if internal error occurs when searching todos", func(t *testing.T) {
 		todoHandler := NewTodoHandler(&mockStore{
-			AddTodoFunc: func(ctx context.Context, todoRequest models.TodoRequest) (models.Todo, error) {
-				return models.Todo{}, errors.New("internal server error")
+			SearchTodosFunc: func(ctx context.Context, q string, limit int) ([]models.TodoSearchResult, error) {
+				return nil, errors.New("internal server error")
 			},
-		})
-		body := strings.NewReader(`{"name": "Test Todo", "description": "Testing add"}`)
-		req, err := http.NewRequest(http.MethodPost, "/todos", body)
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos/search?q=milk", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos", todoHandler.AddTodoHandler).Methods(http.MethodPost)
+		router.HandleFunc("/todos/search", todoHandler.SearchTodosHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusInternalServerError {
@@ -194,20 +269,20 @@ func TestTodoHandlers(t *testing.T) {
 		}
 	})
 
-	t.Run("should return 200 if todo enabled successfully", func(t *testing.T) {
+	t.Run("should return 200 if todo by ID return successfully", func(t *testing.T) {
 		todoHandler := NewTodoHandler(&mockStore{
-			ChangeEnableStatusFunc: func(ctx context.Context, id int, enabled bool) (*models.Todo, error) {
-				return &models.Todo{ID: id, Name: "Test Todo", Enabled: enabled}, nil
+			GetTodoByIDFunc: func(ctx context.Context, id int) (*models.Todo, error) {
+				return &models.Todo{ID: id, Name: "Test Todo"}, nil
 			},
-		})
-		req, err := http.NewRequest(http.MethodPatch, "/todos/1/enable", nil)
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos/1", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos/{id}/enable", todoHandler.EnableTodoHandler).Methods(http.MethodPatch)
+		router.HandleFunc("/todos/{id}", todoHandler.GetTodoByIDHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusOK {
@@ -215,16 +290,16 @@ func TestTodoHandlers(t *testing.T) {
 		}
 	})
 
-	t.Run("should return 400 if invalid id passed when enable todo", func(t *testing.T) {
-		todoHandler := NewTodoHandler(&mockStore{})
-		req, err := http.NewRequest(http.MethodPatch, "/todos/bla/enable", nil)
+	t.Run("should return 400 if invalid id passed when get todo by ID", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos/bla", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos/{id}/enable", todoHandler.EnableTodoHandler).Methods(http.MethodPatch)
+		router.HandleFunc("/todos/{id}", todoHandler.GetTodoByIDHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusBadRequest {
@@ -232,20 +307,20 @@ func TestTodoHandlers(t *testing.T) {
 		}
 	})
 
-	t.Run("should return 404 if todo not found when enable", func(t *testing.T) {
+	t.Run("should return 404 if todo not found when get todo by ID", func(t *testing.T) {
 		todoHandler := NewTodoHandler(&mockStore{
-			ChangeEnableStatusFunc: func(ctx context.Context, id int, enabled bool) (*models.Todo, error) {
-				return nil, errors.New("todo not found")
+			GetTodoByIDFunc: func(ctx context.Context, id int) (*models.Todo, error) {
+				return nil, storage.ErrNotFound
 			},
-		})
-		req, err := http.NewRequest(http.MethodPatch, "/todos/1/enable", nil)
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos/1", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos/{id}/enable", todoHandler.EnableTodoHandler).Methods(http.MethodPatch)
+		router.HandleFunc("/todos/{id}", todoHandler.GetTodoByIDHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusNotFound {
@@ -253,58 +328,166 @@ func TestTodoHandlers(t *testing.T) {
 		}
 	})
 
-	t.Run("should return 200 if todo disabled successfully", func(t *testing.T) {
+	t.Run("should return 500 without leaking details if storage fails when get todo by ID", func(t *testing.T) {
 		todoHandler := NewTodoHandler(&mockStore{
-			ChangeEnableStatusFunc: func(ctx context.Context, id int, enabled bool) (*models.Todo, error) {
-				return &models.Todo{ID: id, Name: "Test Todo", Enabled: enabled}, nil
+			GetTodoByIDFunc: func(ctx context.Context, id int) (*models.Todo, error) {
+				return nil, errors.New("failed to query todo: connection refused")
 			},
-		})
-		req, err := http.NewRequest(http.MethodPatch, "/todos/1/disable", nil)
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos/1", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos/{id}/disable", todoHandler.DisableTodoHandler).Methods(http.MethodPatch)
+		router.HandleFunc("/todos/{id}", todoHandler.GetTodoByIDHandler).Methods(http.MethodGet)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("expected status code 500, got %d", rr.Code)
+		}
+		if strings.Contains(rr.Body.String(), "connection refused") {
+			t.Errorf("expected internal error details to be hidden, got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("should return ETag and honor If-None-Match when get todo by ID", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			GetTodoByIDFunc: func(ctx context.Context, id int) (*models.Todo, error) {
+				return &models.Todo{ID: id, Name: "Test Todo", Version: 3}, nil
+			},
+		}, ownedShares{})
+		router := mux.NewRouter()
+		router.HandleFunc("/todos/{id}", todoHandler.GetTodoByIDHandler).Methods(http.MethodGet)
+
+		tests := []struct {
+			header, value string
+			status        int
+		}{
+			{"", "", http.StatusOK},
+			{"If-None-Match", `"3"`, http.StatusNotModified},
+			{"If-None-Match", `W/"3"`, http.StatusNotModified},
+			{"If-None-Match", `"2", "4"`, http.StatusOK},
+			{"If-None-Match", "*", http.StatusNotModified},
+			{"If-Match", `"2"`, http.StatusPreconditionFailed},
+			{"If-Match", `"3"`, http.StatusOK},
+		}
+		for _, tt := range tests {
+			req, err := http.NewRequest(http.MethodGet, "/todos/1", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Errorf("%s: %s: expected status code %d, got %d", tt.header, tt.value, tt.status, rr.Code)
+			}
+			if rr.Code != http.StatusPreconditionFailed && rr.Header().Get("ETag") != `"3"` {
+				t.Errorf("%s: %s: expected ETag \"3\", got %q", tt.header, tt.value, rr.Header().Get("ETag"))
+			}
+		}
+	})
+
+	t.Run("should return 201 if todo added successfully", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			AddTodoFunc: func(ctx context.Context, todoRequest models.TodoRequest) (models.Todo, error) {
+				return models.Todo{ID: 1, Name: todoRequest.Name}, nil
+			},
+		}, ownedShares{})
+		body := strings.NewReader(`{"name": "Test Todo", "description": "Testing add"}`)
+		req, err := http.NewRequest(http.MethodPost, "/todos", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos", todoHandler.AddTodoHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Errorf("expected status code 201, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 200 with subtasks when get todo children", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			GetChildrenFunc: func(ctx context.Context, id int) ([]models.Todo, error) {
+				return []models.Todo{{ID: 2, ParentID: &id, Name: "Step"}}, nil
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos/1/children", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/children", todoHandler.GetTodoChildrenHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusOK {
 			t.Errorf("expected status code 200, got %d", rr.Code)
 		}
+		var children []models.Todo
+		if err := json.NewDecoder(rr.Body).Decode(&children); err != nil {
+			t.Fatal(err)
+		}
+		if len(children) != 1 || children[0].ParentID == nil || *children[0].ParentID != 1 {
+			t.Errorf("unexpected children %+v", children)
+		}
 	})
 
-	t.Run("should return 400 if invalid id passed when disable todo", func(t *testing.T) {
-		todoHandler := NewTodoHandler(&mockStore{})
-		req, err := http.NewRequest(http.MethodPatch, "/todos/bla/disable", nil)
+	t.Run("should return 200 with nested subtasks when get todo tree", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			GetTodoTreeFunc: func(ctx context.Context, id int) (*models.TodoTree, error) {
+				return &models.TodoTree{
+					Todo:     models.Todo{ID: id},
+					Children: []models.TodoTree{{Todo: models.Todo{ID: 2, ParentID: &id}, Children: []models.TodoTree{}}},
+				}, nil
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos/1/tree", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos/{id}/disable", todoHandler.DisableTodoHandler).Methods(http.MethodPatch)
+		router.HandleFunc("/todos/{id}/tree", todoHandler.GetTodoTreeHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
-		if rr.Code != http.StatusBadRequest {
-			t.Errorf("expected status code 400, got %d", rr.Code)
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+		var tree models.TodoTree
+		if err := json.NewDecoder(rr.Body).Decode(&tree); err != nil {
+			t.Fatal(err)
+		}
+		if tree.ID != 1 || len(tree.Children) != 1 || tree.Children[0].ID != 2 {
+			t.Errorf("unexpected tree %+v", tree)
 		}
 	})
 
-	t.Run("should return 404 if todo not found when disable", func(t *testing.T) {
+	t.Run("should return 404 if todo not found when get todo tree", func(t *testing.T) {
 		todoHandler := NewTodoHandler(&mockStore{
-			ChangeEnableStatusFunc: func(ctx context.Context, id int, enabled bool) (*models.Todo, error) {
-				return nil, errors.New("todo not found")
+			GetTodoTreeFunc: func(ctx context.Context, id int) (*models.TodoTree, error) {
+				return nil, storage.ErrNotFound
 			},
-		})
-		req, err := http.NewRequest(http.MethodPatch, "/todos/1/disable", nil)
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos/1/tree", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos/{id}/disable", todoHandler.DisableTodoHandler).Methods(http.MethodPatch)
+		router.HandleFunc("/todos/{id}/tree", todoHandler.GetTodoTreeHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusNotFound {
@@ -312,39 +495,45 @@ func TestTodoHandlers(t *testing.T) {
 		}
 	})
 
-	t.Run("should return 200 if todo updated successfully", func(t *testing.T) {
+	t.Run("should return 200 with upcoming dates when get todo occurrences", func(t *testing.T) {
+		dueAt := time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)
 		todoHandler := NewTodoHandler(&mockStore{
-			UpdateTodoFunc: func(ctx context.Context, id int, todoRequest models.TodoRequest) (*models.Todo, error) {
-				return &models.Todo{ID: id, Name: todoRequest.Name}, nil
+			GetTodoByIDFunc: func(ctx context.Context, id int) (*models.Todo, error) {
+				return &models.Todo{ID: id, DueAt: &dueAt, RRule: "FREQ=WEEKLY;COUNT=4"}, nil
 			},
-		})
-		body := strings.NewReader(`{"name": "Updated Todo", "description": "Testing update"}`)
-		req, err := http.NewRequest(http.MethodPut, "/todos/1", body)
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos/1/occurrences?limit=5", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos/{id}", todoHandler.UpdateTodoHandler).Methods(http.MethodPut)
+		router.HandleFunc("/todos/{id}/occurrences", todoHandler.GetTodoOccurrencesHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusOK {
 			t.Errorf("expected status code 200, got %d", rr.Code)
 		}
+		var dates []time.Time
+		if err := json.NewDecoder(rr.Body).Decode(&dates); err != nil {
+			t.Fatal(err)
+		}
+		if len(dates) != 3 || !dates[0].Equal(dueAt.AddDate(0, 0, 7)) || !dates[2].Equal(dueAt.AddDate(0, 0, 21)) {
+			t.Errorf("expected the three weekly occurrences left, got %v", dates)
+		}
 	})
 
-	t.Run("should return 400 if invalid id passed when update todo", func(t *testing.T) {
-		todoHandler := NewTodoHandler(&mockStore{})
-		body := strings.NewReader(`{"name": "Updated Todo", "description": "Testing update"}`)
-		req, err := http.NewRequest(http.MethodPut, "/todos/bla", body)
+	t.Run("should return 400 if limit is invalid when get todo occurrences", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos/1/occurrences?limit=0", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos/{id}", todoHandler.UpdateTodoHandler).Methods(http.MethodPut)
+		router.HandleFunc("/todos/{id}/occurrences", todoHandler.GetTodoOccurrencesHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusBadRequest {
@@ -352,35 +541,52 @@ func TestTodoHandlers(t *testing.T) {
 		}
 	})
 
-	t.Run("should return 400 if invalid payload when updating todo", func(t *testing.T) {
-		todoHandler := NewTodoHandler(&mockStore{})
-		body := strings.NewReader("hello")
-		req, err := http.NewRequest(http.MethodPut, "/todos/1", body)
+	t.Run("should return 200 with a page of events when get todo history", func(t *testing.T) {
+		var got storage.HistoryQuery
+		todoHandler := NewTodoHandler(&mockStore{
+			GetTodoHistoryFunc: func(ctx context.Context, id int, query storage.HistoryQuery) (models.TodoEventPage, error) {
+				got = query
+				return models.TodoEventPage{
+					Events:     []models.TodoEvent{{ID: 2, TodoID: id, Action: models.EventUpdated, Before: []byte(`{"name":"a"}`), After: []byte(`{"name":"b"}`)}},
+					NextCursor: "next",
+				}, nil
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos/1/history?limit=1&cursor=abc", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos/{id}", todoHandler.UpdateTodoHandler).Methods(http.MethodPut)
+		router.HandleFunc("/todos/{id}/history", todoHandler.GetTodoHistoryHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
-		if rr.Code != http.StatusBadRequest {
-			t.Errorf("expected status code 400, got %d", rr.Code)
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+		if got.Limit != 1 || got.Cursor != "abc" {
+			t.Errorf("expected limit and cursor to be passed on, got %+v", got)
+		}
+		var page models.TodoEventPage
+		if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Events) != 1 || page.NextCursor != "next" || string(page.Events[0].After) != `{"name":"b"}` {
+			t.Errorf("unexpected history %+v", page)
 		}
 	})
 
-	t.Run("should return 400 if model validation failed when updating todo", func(t *testing.T) {
-		todoHandler := NewTodoHandler(&mockStore{})
-		body := strings.NewReader(`{"description": ""}`)
-		req, err := http.NewRequest(http.MethodPut, "/todos/1", body)
+	t.Run("should return 400 if limit is invalid when get todo history", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos/1/history?limit=1000", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos/{id}", todoHandler.UpdateTodoHandler).Methods(http.MethodPut)
+		router.HandleFunc("/todos/{id}/history", todoHandler.GetTodoHistoryHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusBadRequest {
@@ -388,21 +594,20 @@ func TestTodoHandlers(t *testing.T) {
 		}
 	})
 
-	t.Run("should return 404 if todo not found when update", func(t *testing.T) {
+	t.Run("should return 404 if todo has no history", func(t *testing.T) {
 		todoHandler := NewTodoHandler(&mockStore{
-			UpdateTodoFunc: func(ctx context.Context, id int, todoRequest models.TodoRequest) (*models.Todo, error) {
-				return nil, errors.New("todo not found")
+			GetTodoHistoryFunc: func(ctx context.Context, id int, query storage.HistoryQuery) (models.TodoEventPage, error) {
+				return models.TodoEventPage{}, storage.ErrNotFound
 			},
-		})
-		body := strings.NewReader(`{"name": "Updated Todo", "description": "Testing update"}`)
-		req, err := http.NewRequest(http.MethodPut, "/todos/1", body)
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/todos/1/history", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos/{id}", todoHandler.UpdateTodoHandler).Methods(http.MethodPut)
+		router.HandleFunc("/todos/{id}/history", todoHandler.GetTodoHistoryHandler).Methods(http.MethodGet)
 		router.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusNotFound {
@@ -410,91 +615,1198 @@ func TestTodoHandlers(t *testing.T) {
 		}
 	})
 
-	t.Run("should return 200 if todo deleted successfully", func(t *testing.T) {
-		todoHandler := NewTodoHandler(&mockStore{
-			DeleteTodoFunc: func(ctx context.Context, id int) error { return nil },
-		})
-		req, err := http.NewRequest(http.MethodDelete, "/todos/1", nil)
+	t.Run("should return 400 if rrule is invalid when adding todo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		body := strings.NewReader(`{"name": "Test Todo", "rrule": "FREQ=SOMETIMES"}`)
+		req, err := http.NewRequest(http.MethodPost, "/todos", body)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos/{id}", todoHandler.DeleteTodoHandler).Methods(http.MethodDelete)
+		router.HandleFunc("/todos", todoHandler.AddTodoHandler).Methods(http.MethodPost)
 		router.ServeHTTP(rr, req)
 
-		if rr.Code != http.StatusNoContent {
-			t.Errorf("expected status code 204, got %d", rr.Code)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+		var problem utils.Problem
+		if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+			t.Fatal(err)
+		}
+		if len(problem.Errors) != 1 || problem.Errors[0].Field != "rrule" || problem.Errors[0].Tag != "rrule" {
+			t.Errorf("expected rrule error, got %+v", problem.Errors)
 		}
 	})
 
-	t.Run("should return 400 if invalid id passed when delete todo", func(t *testing.T) {
-		todoHandler := NewTodoHandler(&mockStore{})
-		req, err := http.NewRequest(http.MethodDelete, "/todos/bla", nil)
+	t.Run("should add todo to the list in the path", func(t *testing.T) {
+		var got models.TodoRequest
+		todoHandler := NewTodoHandler(&mockStore{
+			AddTodoFunc: func(ctx context.Context, todoRequest models.TodoRequest) (models.Todo, error) {
+				got = todoRequest
+				return models.Todo{ID: 1, ListID: todoRequest.ListID, Name: todoRequest.Name}, nil
+			},
+		}, ownedShares{})
+		body := strings.NewReader(`{"name": "Test Todo", "list_id": 5}`)
+		req, err := http.NewRequest(http.MethodPost, "/lists/2/todos", body)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos/{id}", todoHandler.DeleteTodoHandler).Methods(http.MethodDelete)
+		router.HandleFunc("/lists/{listID}/todos", todoHandler.AddTodoHandler).Methods(http.MethodPost)
 		router.ServeHTTP(rr, req)
 
-		if rr.Code != http.StatusBadRequest {
-			t.Errorf("expected status code 400, got %d", rr.Code)
+		if rr.Code != http.StatusCreated {
+			t.Errorf("expected status code 201, got %d", rr.Code)
+		}
+		if got.ListID != 2 {
+			t.Errorf("expected todo to be added to list 2, got %d", got.ListID)
 		}
 	})
 
-	t.Run("should return 404 if todo not found when delete", func(t *testing.T) {
-		todoHandler := NewTodoHandler(&mockStore{
-			DeleteTodoFunc: func(ctx context.Context, id int) error { return errors.New("todo not found") },
-		})
-		req, err := http.NewRequest(http.MethodDelete, "/todos/1", nil)
+	t.Run("should return 400 if invalid payload when adding todo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		body := strings.NewReader("hello")
+		req, err := http.NewRequest(http.MethodPost, "/todos", body)
 		if err != nil {
 			t.Fatal(err)
 		}
 		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 
-		router.HandleFunc("/todos/{id}", todoHandler.DeleteTodoHandler).Methods(http.MethodDelete)
+		router.HandleFunc("/todos", todoHandler.AddTodoHandler).Methods(http.MethodPost)
 		router.ServeHTTP(rr, req)
 
-		if rr.Code != http.StatusNotFound {
-			t.Errorf("expected status code 404, got %d", rr.Code)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 400 if model validation failed when adding todo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		body := strings.NewReader(`{"description": ""}`)
+		req, err := http.NewRequest(http.MethodPost, "/todos", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos", todoHandler.AddTodoHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return field errors as problem details when adding todo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		body := strings.NewReader(`{"name": "ab"}`)
+		req, err := http.NewRequest(http.MethodPost, "/todos", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos", todoHandler.AddTodoHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("expected content type application/problem+json, got %q", ct)
+		}
+		var problem utils.Problem
+		if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+			t.Fatal(err)
+		}
+		if problem.Status != http.StatusBadRequest || problem.Instance != "/todos" {
+			t.Errorf("unexpected problem %+v", problem)
+		}
+		if len(problem.Errors) != 1 {
+			t.Fatalf("expected 1 field error, got %+v", problem.Errors)
+		}
+		if fe := problem.Errors[0]; fe.Field != "name" || fe.Tag != "min" || fe.Limit != "3" {
+			t.Errorf("unexpected field error %+v", fe)
+		}
+	})
+
+	t.Run("should return 400 if due date is not RFC 3339 when adding todo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		body := strings.NewReader(`{"name": "Test Todo", "due_at": "tomorrow"}`)
+		req, err := http.NewRequest(http.MethodPost, "/todos", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos", todoHandler.AddTodoHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+		var problem utils.Problem
+		if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+			t.Fatal(err)
+		}
+		if len(problem.Errors) != 1 || problem.Errors[0].Field != "due_at" || problem.Errors[0].Tag != "datetime" {
+			t.Errorf("expected due_at datetime error, got %+v", problem.Errors)
+		}
+	})
+
+	t.Run("should return 400 if priority is unknown when adding todo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		body := strings.NewReader(`{"name": "Test Todo", "priority": "critical"}`)
+		req, err := http.NewRequest(http.MethodPost, "/todos", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos", todoHandler.AddTodoHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+		var problem utils.Problem
+		if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+			t.Fatal(err)
+		}
+		if len(problem.Errors) != 1 || problem.Errors[0].Field != "priority" || problem.Errors[0].Tag != "oneof" {
+			t.Errorf("expected priority oneof error, got %+v", problem.Errors)
+		}
+	})
+
+	t.Run("should return 500 if internal error occurs when adding todo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			AddTodoFunc: func(ctx context.Context, todoRequest models.TodoRequest) (models.Todo, error) {
+				return models.Todo{}, errors.New("internal server error")
+			},
+		}, ownedShares{})
+		body := strings.NewReader(`{"name": "Test Todo", "description": "Testing add"}`)
+		req, err := http.NewRequest(http.MethodPost, "/todos", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos", todoHandler.AddTodoHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("expected status code 500, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 200 if todo enabled successfully", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			ChangeEnableStatusFunc: func(ctx context.Context, id int, enabled bool, pre storage.Precondition) (*models.Todo, error) {
+				return &models.Todo{ID: id, Name: "Test Todo", Enabled: enabled}, nil
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPatch, "/todos/1/enable", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/enable", todoHandler.EnableTodoHandler).Methods(http.MethodPatch)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 400 if invalid id passed when enable todo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPatch, "/todos/bla/enable", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/enable", todoHandler.EnableTodoHandler).Methods(http.MethodPatch)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 404 if todo not found when enable", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			ChangeEnableStatusFunc: func(ctx context.Context, id int, enabled bool, pre storage.Precondition) (*models.Todo, error) {
+				return nil, storage.ErrNotFound
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPatch, "/todos/1/enable", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/enable", todoHandler.EnableTodoHandler).Methods(http.MethodPatch)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code 404, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 409 if todo already enabled", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			ChangeEnableStatusFunc: func(ctx context.Context, id int, enabled bool, pre storage.Precondition) (*models.Todo, error) {
+				return nil, storage.ErrAlreadyInState
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPatch, "/todos/1/enable", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/enable", todoHandler.EnableTodoHandler).Methods(http.MethodPatch)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code 409, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 200 if todo disabled successfully", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			ChangeEnableStatusFunc: func(ctx context.Context, id int, enabled bool, pre storage.Precondition) (*models.Todo, error) {
+				return &models.Todo{ID: id, Name: "Test Todo", Enabled: enabled}, nil
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPatch, "/todos/1/disable", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/disable", todoHandler.DisableTodoHandler).Methods(http.MethodPatch)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 400 if invalid id passed when disable todo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPatch, "/todos/bla/disable", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/disable", todoHandler.DisableTodoHandler).Methods(http.MethodPatch)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 404 if todo not found when disable", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			ChangeEnableStatusFunc: func(ctx context.Context, id int, enabled bool, pre storage.Precondition) (*models.Todo, error) {
+				return nil, storage.ErrNotFound
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPatch, "/todos/1/disable", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/disable", todoHandler.DisableTodoHandler).Methods(http.MethodPatch)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code 404, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 200 if todo completed successfully", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			ChangeCompleteStatusFunc: func(ctx context.Context, id int, completed, force bool, pre storage.Precondition) (*models.Todo, error) {
+				return &models.Todo{ID: id, Name: "Test Todo", Completed: completed}, nil
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPatch, "/todos/1/complete", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/complete", todoHandler.CompleteTodoHandler).Methods(http.MethodPatch)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 409 if todo is blocked when complete", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			ChangeCompleteStatusFunc: func(ctx context.Context, id int, completed, force bool, pre storage.Precondition) (*models.Todo, error) {
+				return nil, storage.ErrBlocked
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPatch, "/todos/1/complete", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/complete", todoHandler.CompleteTodoHandler).Methods(http.MethodPatch)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code 409, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should pass force to storage when complete todo", func(t *testing.T) {
+		var gotForce bool
+		todoHandler := NewTodoHandler(&mockStore{
+			ChangeCompleteStatusFunc: func(ctx context.Context, id int, completed, force bool, pre storage.Precondition) (*models.Todo, error) {
+				gotForce = force
+				return &models.Todo{ID: id, Completed: completed}, nil
+			},
+		}, ownedShares{})
+		for _, tt := range []struct {
+			query string
+			code  int
+			force bool
+		}{
+			{"?force=true", http.StatusOK, true},
+			{"", http.StatusOK, false},
+			{"?force=maybe", http.StatusBadRequest, false},
+		} {
+			gotForce = false
+			req, err := http.NewRequest(http.MethodPatch, "/todos/1/complete"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+
+			router.HandleFunc("/todos/{id}/complete", todoHandler.CompleteTodoHandler).Methods(http.MethodPatch)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.code || gotForce != tt.force {
+				t.Errorf("%q: expected %d with force %v, got %d with force %v", tt.query, tt.code, tt.force, rr.Code, gotForce)
+			}
+		}
+	})
+
+	t.Run("should return 400 if invalid id passed when complete todo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPatch, "/todos/bla/complete", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/complete", todoHandler.CompleteTodoHandler).Methods(http.MethodPatch)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 404 if todo not found when complete", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			ChangeCompleteStatusFunc: func(ctx context.Context, id int, completed, force bool, pre storage.Precondition) (*models.Todo, error) {
+				return nil, storage.ErrNotFound
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPatch, "/todos/1/complete", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/complete", todoHandler.CompleteTodoHandler).Methods(http.MethodPatch)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code 404, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 200 if todo reopened successfully", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			ChangeCompleteStatusFunc: func(ctx context.Context, id int, completed, force bool, pre storage.Precondition) (*models.Todo, error) {
+				return &models.Todo{ID: id, Name: "Test Todo", Completed: completed}, nil
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPatch, "/todos/1/reopen", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/reopen", todoHandler.ReopenTodoHandler).Methods(http.MethodPatch)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 400 if invalid id passed when reopen todo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPatch, "/todos/bla/reopen", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/reopen", todoHandler.ReopenTodoHandler).Methods(http.MethodPatch)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 404 if todo not found when reopen", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			ChangeCompleteStatusFunc: func(ctx context.Context, id int, completed, force bool, pre storage.Precondition) (*models.Todo, error) {
+				return nil, storage.ErrNotFound
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPatch, "/todos/1/reopen", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/reopen", todoHandler.ReopenTodoHandler).Methods(http.MethodPatch)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code 404, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 200 if todo updated successfully", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			UpdateTodoFunc: func(ctx context.Context, id int, todoRequest models.TodoRequest, pre storage.Precondition) (*models.Todo, error) {
+				return &models.Todo{ID: id, Name: todoRequest.Name}, nil
+			},
+		}, ownedShares{})
+		body := strings.NewReader(`{"name": "Updated Todo", "description": "Testing update"}`)
+		req, err := http.NewRequest(http.MethodPut, "/todos/1", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}", todoHandler.UpdateTodoHandler).Methods(http.MethodPut)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should pass If-Match to storage and return 412 on mismatch when update", func(t *testing.T) {
+		var got storage.Precondition
+		todoHandler := NewTodoHandler(&mockStore{
+			UpdateTodoFunc: func(ctx context.Context, id int, todoRequest models.TodoRequest, pre storage.Precondition) (*models.Todo, error) {
+				got = pre
+				return nil, storage.ErrPreconditionFailed
+			},
+		}, ownedShares{})
+		body := strings.NewReader(`{"name": "Updated Todo", "description": "Testing update"}`)
+		req, err := http.NewRequest(http.MethodPut, "/todos/1", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("If-Match", `"2"`)
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}", todoHandler.UpdateTodoHandler).Methods(http.MethodPut)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusPreconditionFailed {
+			t.Errorf("expected status code 412, got %d", rr.Code)
+		}
+		if len(got.IfMatch) != 1 || got.IfMatch[0] != 2 {
+			t.Errorf("expected If-Match version 2, got %+v", got)
+		}
+	})
+
+	t.Run("should return 400 if invalid id passed when update todo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		body := strings.NewReader(`{"name": "Updated Todo", "description": "Testing update"}`)
+		req, err := http.NewRequest(http.MethodPut, "/todos/bla", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}", todoHandler.UpdateTodoHandler).Methods(http.MethodPut)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 400 if invalid payload when updating todo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		body := strings.NewReader("hello")
+		req, err := http.NewRequest(http.MethodPut, "/todos/1", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}", todoHandler.UpdateTodoHandler).Methods(http.MethodPut)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 400 if model validation failed when updating todo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		body := strings.NewReader(`{"description": ""}`)
+		req, err := http.NewRequest(http.MethodPut, "/todos/1", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}", todoHandler.UpdateTodoHandler).Methods(http.MethodPut)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 404 if todo not found when update", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			UpdateTodoFunc: func(ctx context.Context, id int, todoRequest models.TodoRequest, pre storage.Precondition) (*models.Todo, error) {
+				return nil, storage.ErrNotFound
+			},
+		}, ownedShares{})
+		body := strings.NewReader(`{"name": "Updated Todo", "description": "Testing update"}`)
+		req, err := http.NewRequest(http.MethodPut, "/todos/1", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}", todoHandler.UpdateTodoHandler).Methods(http.MethodPut)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code 404, got %d", rr.Code)
+		}
+	})
+
+	patchStore := &mockStore{
+		PatchTodoFunc: func(ctx context.Context, id int, patch storage.PatchFunc, pre storage.Precondition) (*models.Todo, error) {
+			todoRequest, err := patch(models.TodoRequest{Name: "Test Todo", Description: "Old description"})
+			if err != nil {
+				return nil, err
+			}
+			return &models.Todo{ID: id, Name: todoRequest.Name, Description: todoRequest.Description}, nil
+		},
+	}
+
+	patchTests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		description string
+	}{
+		{"should return 200 if merge patch applied successfully", "application/merge-patch+json", `{"description": "New description"}`, http.StatusOK, "New description"},
+		{"should return 200 if JSON patch applied successfully", "application/json-patch+json", `[{"op": "replace", "path": "/description", "value": "New description"}]`, http.StatusOK, "New description"},
+		{"should return 415 if patch content type is unsupported", "application/json", `{"description": "New description"}`, http.StatusUnsupportedMediaType, ""},
+		{"should return 400 if patch document is invalid", "application/json-patch+json", `{"op": "replace"}`, http.StatusBadRequest, ""},
+		{"should return 400 if patch adds unknown fields", "application/merge-patch+json", `{"completed": true}`, http.StatusBadRequest, ""},
+		{"should return 400 if patched todo fails validation", "application/merge-patch+json", `{"name": null}`, http.StatusBadRequest, ""},
+		{"should return 409 if JSON patch test operation fails", "application/json-patch+json", `[{"op": "test", "path": "/name", "value": "Other"}]`, http.StatusConflict, ""},
+	}
+	for _, tt := range patchTests {
+		t.Run(tt.name, func(t *testing.T) {
+			todoHandler := NewTodoHandler(patchStore, ownedShares{})
+			req, err := http.NewRequest(http.MethodPatch, "/todos/1", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+
+			router.HandleFunc("/todos/{id}", todoHandler.PatchTodoHandler).Methods(http.MethodPatch)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Errorf("expected status code %d, got %d", tt.status, rr.Code)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var todo models.Todo
+			if err := json.NewDecoder(rr.Body).Decode(&todo); err != nil {
+				t.Fatal(err)
+			}
+			if todo.Name != "Test Todo" || todo.Description != tt.description {
+				t.Errorf("unexpected patched todo %+v", todo)
+			}
+		})
+	}
+
+	t.Run("should return 404 if todo not found when patch", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			PatchTodoFunc: func(ctx context.Context, id int, patch storage.PatchFunc, pre storage.Precondition) (*models.Todo, error) {
+				return nil, storage.ErrNotFound
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPatch, "/todos/1", strings.NewReader(`{"description": "New description"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}", todoHandler.PatchTodoHandler).Methods(http.MethodPatch)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code 404, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 200 if todo deleted successfully", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			DeleteTodoFunc: func(ctx context.Context, id int, permanent bool, pre storage.Precondition) error { return nil },
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodDelete, "/todos/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}", todoHandler.DeleteTodoHandler).Methods(http.MethodDelete)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("expected status code 204, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should pass permanent to storage when delete todo", func(t *testing.T) {
+		for _, tt := range []struct {
+			query string
+			want  bool
+		}{{"", false}, {"?permanent=true", true}, {"?permanent=false", false}} {
+			var got bool
+			todoHandler := NewTodoHandler(&mockStore{
+				DeleteTodoFunc: func(ctx context.Context, id int, permanent bool, pre storage.Precondition) error {
+					got = permanent
+					return nil
+				},
+			}, ownedShares{})
+			req, err := http.NewRequest(http.MethodDelete, "/todos/1"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+
+			router.HandleFunc("/todos/{id}", todoHandler.DeleteTodoHandler).Methods(http.MethodDelete)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusNoContent || got != tt.want {
+				t.Errorf("%q: expected 204 with permanent=%v, got %d with %v", tt.query, tt.want, rr.Code, got)
+			}
+		}
+	})
+
+	t.Run("should return 400 if permanent is invalid when delete todo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		req, err := http.NewRequest(http.MethodDelete, "/todos/1?permanent=maybe", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}", todoHandler.DeleteTodoHandler).Methods(http.MethodDelete)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 200 with trashed todos when get trash", func(t *testing.T) {
+		deletedAt := time.Now().UTC()
+		todoHandler := NewTodoHandler(&mockStore{
+			GetTrashFunc: func(ctx context.Context) ([]models.Todo, error) {
+				return []models.Todo{{ID: 1, DeletedAt: &deletedAt}}, nil
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodGet, "/trash", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/trash", todoHandler.GetTrashHandler).Methods(http.MethodGet)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+		var todos []models.Todo
+		if err := json.NewDecoder(rr.Body).Decode(&todos); err != nil {
+			t.Fatal(err)
+		}
+		if len(todos) != 1 || todos[0].DeletedAt == nil {
+			t.Errorf("unexpected trash %+v", todos)
+		}
+	})
+
+	t.Run("should return 200 with ETag if todo restored", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			RestoreTodoFunc: func(ctx context.Context, id int, pre storage.Precondition) (*models.Todo, error) {
+				return &models.Todo{ID: id, Version: 4}, nil
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPost, "/todos/1/restore", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/restore", todoHandler.RestoreTodoHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+		if rr.Header().Get("ETag") != `"4"` {
+			t.Errorf("expected ETag \"4\", got %q", rr.Header().Get("ETag"))
+		}
+	})
+
+	t.Run("should return 409 if todo is not in the trash when restore", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			RestoreTodoFunc: func(ctx context.Context, id int, pre storage.Precondition) (*models.Todo, error) {
+				return nil, storage.ErrAlreadyInState
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPost, "/todos/1/restore", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/restore", todoHandler.RestoreTodoHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code 409, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 200 with the reverted changes when undo", func(t *testing.T) {
+		var got int
+		todoHandler := NewTodoHandler(&mockStore{
+			UndoFunc: func(ctx context.Context, n int) ([]models.TodoEvent, error) {
+				got = n
+				return []models.TodoEvent{{ID: 3, TodoID: 1, Action: models.EventDisabled}}, nil
+			},
+		}, ownedShares{})
+		for _, tt := range []struct {
+			query string
+			want  int
+		}{{"", 1}, {"?n=3", 3}} {
+			req, err := http.NewRequest(http.MethodPost, "/undo"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+
+			router.HandleFunc("/undo", todoHandler.UndoHandler).Methods(http.MethodPost)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK || got != tt.want {
+				t.Errorf("%q: expected 200 undoing %d changes, got %d undoing %d", tt.query, tt.want, rr.Code, got)
+			}
+			var events []models.TodoEvent
+			if err := json.NewDecoder(rr.Body).Decode(&events); err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 || events[0].Action != models.EventDisabled {
+				t.Errorf("unexpected events %+v", events)
+			}
+		}
+	})
+
+	t.Run("should return 400 if n is invalid when undo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		for _, query := range []string{"?n=0", "?n=abc", fmt.Sprintf("?n=%d", storage.UndoDepth+1)} {
+			req, err := http.NewRequest(http.MethodPost, "/undo"+query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+
+			router.HandleFunc("/undo", todoHandler.UndoHandler).Methods(http.MethodPost)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%q: expected status code 400, got %d", query, rr.Code)
+			}
+		}
+	})
+
+	t.Run("should return 409 if the todo changed since when redo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			RedoFunc: func(ctx context.Context, n int) ([]models.TodoEvent, error) {
+				return nil, storage.ErrConflict
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPost, "/redo", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/redo", todoHandler.RedoHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code 409, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 400 if invalid id passed when delete todo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		req, err := http.NewRequest(http.MethodDelete, "/todos/bla", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}", todoHandler.DeleteTodoHandler).Methods(http.MethodDelete)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 200 with ETag if todo moved", func(t *testing.T) {
+		var got models.MoveRequest
+		todoHandler := NewTodoHandler(&mockStore{
+			MoveTodoFunc: func(ctx context.Context, id int, move models.MoveRequest, pre storage.Precondition) (*models.Todo, error) {
+				got = move
+				return &models.Todo{ID: id, Rank: "V", Version: 2}, nil
+			},
+		}, ownedShares{})
+		body := strings.NewReader(`{"after": 2, "before": 3}`)
+		req, err := http.NewRequest(http.MethodPost, "/todos/1/move", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/move", todoHandler.MoveTodoHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+		if rr.Header().Get("ETag") != `"2"` {
+			t.Errorf("expected ETag \"2\", got %q", rr.Header().Get("ETag"))
+		}
+		if got.After == nil || *got.After != 2 || got.Before == nil || *got.Before != 3 {
+			t.Errorf("expected move after 2 and before 3, got %+v", got)
+		}
+	})
+
+	t.Run("should return 400 if neither before nor after passed when moving todo", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPost, "/todos/1/move", strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/move", todoHandler.MoveTodoHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 409 if todo moved next to itself", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			MoveTodoFunc: func(ctx context.Context, id int, move models.MoveRequest, pre storage.Precondition) (*models.Todo, error) {
+				return nil, storage.ErrConflict
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPost, "/todos/1/move", strings.NewReader(`{"before": 1}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/move", todoHandler.MoveTodoHandler).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code 409, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 200 with ETag if dependency added", func(t *testing.T) {
+		var gotID, gotBlockerID int
+		todoHandler := NewTodoHandler(&mockStore{
+			AddDependencyFunc: func(ctx context.Context, id, blockerID int, pre storage.Precondition) (*models.Todo, error) {
+				gotID, gotBlockerID = id, blockerID
+				return &models.Todo{ID: id, Version: 3, BlockedBy: []int{blockerID}, Blocked: true}, nil
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPut, "/todos/1/blocked-by/2", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/blocked-by/{blockerID}", todoHandler.AddDependencyHandler).Methods(http.MethodPut)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+		if gotID != 1 || gotBlockerID != 2 {
+			t.Errorf("expected todo 1 blocked by 2, got %d blocked by %d", gotID, gotBlockerID)
+		}
+		if rr.Header().Get("ETag") != `"3"` {
+			t.Errorf("expected ETag \"3\", got %q", rr.Header().Get("ETag"))
+		}
+	})
+
+	t.Run("should return 409 if dependency would create a cycle", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			AddDependencyFunc: func(ctx context.Context, id, blockerID int, pre storage.Precondition) (*models.Todo, error) {
+				return nil, storage.ErrConflict
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodPut, "/todos/1/blocked-by/2", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/blocked-by/{blockerID}", todoHandler.AddDependencyHandler).Methods(http.MethodPut)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code 409, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 400 if invalid blocking id passed when removing dependency", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{}, ownedShares{})
+		req, err := http.NewRequest(http.MethodDelete, "/todos/1/blocked-by/abc", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}/blocked-by/{blockerID}", todoHandler.RemoveDependencyHandler).Methods(http.MethodDelete)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 404 if todo not found when delete", func(t *testing.T) {
+		todoHandler := NewTodoHandler(&mockStore{
+			DeleteTodoFunc: func(ctx context.Context, id int, permanent bool, pre storage.Precondition) error {
+				return storage.ErrNotFound
+			},
+		}, ownedShares{})
+		req, err := http.NewRequest(http.MethodDelete, "/todos/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/todos/{id}", todoHandler.DeleteTodoHandler).Methods(http.MethodDelete)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code 404, got %d", rr.Code)
 		}
 	})
 }
 
 type mockStore struct {
-	GetTodosFunc           func(ctx context.Context) ([]models.Todo, error)
-	GetTodoByIDFunc        func(ctx context.Context, id int) (*models.Todo, error)
-	AddTodoFunc            func(ctx context.Context, todoRequest models.TodoRequest) (models.Todo, error)
-	ChangeEnableStatusFunc func(ctx context.Context, id int, enabled bool) (*models.Todo, error)
-	UpdateTodoFunc         func(ctx context.Context, id int, todoRequest models.TodoRequest) (*models.Todo, error)
-	DeleteTodoFunc         func(ctx context.Context, id int) error
+	GetTodosFunc             func(ctx context.Context, query storage.TodoQuery) (models.TodoPage, error)
+	SearchTodosFunc          func(ctx context.Context, q string, limit int) ([]models.TodoSearchResult, error)
+	GetTodoByIDFunc          func(ctx context.Context, id int) (*models.Todo, error)
+	GetChildrenFunc          func(ctx context.Context, id int) ([]models.Todo, error)
+	GetTodoTreeFunc          func(ctx context.Context, id int) (*models.TodoTree, error)
+	AddTodoFunc              func(ctx context.Context, todoRequest models.TodoRequest) (models.Todo, error)
+	ChangeEnableStatusFunc   func(ctx context.Context, id int, enabled bool, pre storage.Precondition) (*models.Todo, error)
+	ChangeCompleteStatusFunc func(ctx context.Context, id int, completed, force bool, pre storage.Precondition) (*models.Todo, error)
+	UpdateTodoFunc           func(ctx context.Context, id int, todoRequest models.TodoRequest, pre storage.Precondition) (*models.Todo, error)
+	PatchTodoFunc            func(ctx context.Context, id int, patch storage.PatchFunc, pre storage.Precondition) (*models.Todo, error)
+	DeleteTodoFunc           func(ctx context.Context, id int, permanent bool, pre storage.Precondition) error
+	GetTrashFunc             func(ctx context.Context) ([]models.Todo, error)
+	RestoreTodoFunc          func(ctx context.Context, id int, pre storage.Precondition) (*models.Todo, error)
+	PurgeTrashFunc           func(ctx context.Context, before time.Time) (int, error)
+	GetTodoHistoryFunc       func(ctx context.Context, id int, query storage.HistoryQuery) (models.TodoEventPage, error)
+	UndoFunc                 func(ctx context.Context, n int) ([]models.TodoEvent, error)
+	RedoFunc                 func(ctx context.Context, n int) ([]models.TodoEvent, error)
+	AddDependencyFunc        func(ctx context.Context, id, blockerID int, pre storage.Precondition) (*models.Todo, error)
+	RemoveDependencyFunc     func(ctx context.Context, id, blockerID int, pre storage.Precondition) (*models.Todo, error)
+	MoveTodoFunc             func(ctx context.Context, id int, move models.MoveRequest, pre storage.Precondition) (*models.Todo, error)
 }
 
-func (m *mockStore) GetTodos(ctx context.Context) ([]models.Todo, error) {
-	return m.GetTodosFunc(ctx)
+func (m *mockStore) GetTodos(ctx context.Context, query storage.TodoQuery) (models.TodoPage, error) {
+	return m.GetTodosFunc(ctx, query)
+}
+
+func (m *mockStore) SearchTodos(ctx context.Context, q string, limit int) ([]models.TodoSearchResult, error) {
+	return m.SearchTodosFunc(ctx, q, limit)
 }
 
 func (m *mockStore) GetTodoByID(ctx context.Context, id int) (*models.Todo, error) {
 	return m.GetTodoByIDFunc(ctx, id)
 }
 
+func (m *mockStore) GetChildren(ctx context.Context, id int) ([]models.Todo, error) {
+	return m.GetChildrenFunc(ctx, id)
+}
+
+func (m *mockStore) GetTodoTree(ctx context.Context, id int) (*models.TodoTree, error) {
+	return m.GetTodoTreeFunc(ctx, id)
+}
+
 func (m *mockStore) AddTodo(ctx context.Context, todoRequest models.TodoRequest) (models.Todo, error) {
 	return m.AddTodoFunc(ctx, todoRequest)
 }
 
-func (m *mockStore) ChangeEnableStatus(ctx context.Context, id int, enabled bool) (*models.Todo, error) {
-	return m.ChangeEnableStatusFunc(ctx, id, enabled)
+func (m *mockStore) ChangeEnableStatus(ctx context.Context, id int, enabled bool, pre storage.Precondition) (*models.Todo, error) {
+	return m.ChangeEnableStatusFunc(ctx, id, enabled, pre)
+}
+
+func (m *mockStore) ChangeCompleteStatus(ctx context.Context, id int, completed, force bool, pre storage.Precondition) (*models.Todo, error) {
+	return m.ChangeCompleteStatusFunc(ctx, id, completed, force, pre)
+}
+
+func (m *mockStore) UpdateTodo(ctx context.Context, id int, todoRequest models.TodoRequest, pre storage.Precondition) (*models.Todo, error) {
+	return m.UpdateTodoFunc(ctx, id, todoRequest, pre)
+}
+
+func (m *mockStore) PatchTodo(ctx context.Context, id int, patch storage.PatchFunc, pre storage.Precondition) (*models.Todo, error) {
+	return m.PatchTodoFunc(ctx, id, patch, pre)
+}
+
+func (m *mockStore) DeleteTodo(ctx context.Context, id int, permanent bool, pre storage.Precondition) error {
+	return m.DeleteTodoFunc(ctx, id, permanent, pre)
+}
+
+func (m *mockStore) GetTrash(ctx context.Context) ([]models.Todo, error) {
+	return m.GetTrashFunc(ctx)
+}
+
+func (m *mockStore) RestoreTodo(ctx context.Context, id int, pre storage.Precondition) (*models.Todo, error) {
+	return m.RestoreTodoFunc(ctx, id, pre)
+}
+
+func (m *mockStore) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	return m.PurgeTrashFunc(ctx, before)
+}
+
+func (m *mockStore) GetTodoHistory(ctx context.Context, id int, query storage.HistoryQuery) (models.TodoEventPage, error) {
+	return m.GetTodoHistoryFunc(ctx, id, query)
+}
+
+func (m *mockStore) Undo(ctx context.Context, n int) ([]models.TodoEvent, error) {
+	return m.UndoFunc(ctx, n)
+}
+
+func (m *mockStore) Redo(ctx context.Context, n int) ([]models.TodoEvent, error) {
+	return m.RedoFunc(ctx, n)
+}
+
+func (m *mockStore) AddDependency(ctx context.Context, id, blockerID int, pre storage.Precondition) (*models.Todo, error) {
+	return m.AddDependencyFunc(ctx, id, blockerID, pre)
 }
 
-func (m *mockStore) UpdateTodo(ctx context.Context, id int, todoRequest models.TodoRequest) (*models.Todo, error) {
-	return m.UpdateTodoFunc(ctx, id, todoRequest)
+func (m *mockStore) RemoveDependency(ctx context.Context, id, blockerID int, pre storage.Precondition) (*models.Todo, error) {
+	return m.RemoveDependencyFunc(ctx, id, blockerID, pre)
 }
 
-func (m *mockStore) DeleteTodo(ctx context.Context, id int) error {
-	return m.DeleteTodoFunc(ctx, id)
+func (m *mockStore) MoveTodo(ctx context.Context, id int, move models.MoveRequest, pre storage.Precondition) (*models.Todo, error) {
+	return m.MoveTodoFunc(ctx, id, move, pre)
 }
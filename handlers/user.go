@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cmgchess/gotodo/auth"
+	"github.com/cmgchess/gotodo/models"
+	"github.com/cmgchess/gotodo/storage"
+	"github.com/cmgchess/gotodo/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var errInvalidCredentials = errors.New("invalid email or password")
+
+// dummyHash is compared with the password of logins with an unknown email,
+// so that they take as long as those with a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+type UserHandler struct {
+	store    storage.UserStorage
+	secret   []byte
+	tokenTTL time.Duration
+}
+
+// NewUserHandler returns a handler that signs the tokens it hands out at
+// login with secret and makes them valid for tokenTTL.
+func NewUserHandler(store storage.UserStorage, secret []byte, tokenTTL time.Duration) *UserHandler {
+	return &UserHandler{store: store, secret: secret, tokenTTL: tokenTTL}
+}
+
+func (h *UserHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userRequest, ok := decodeUserRequest(w, r)
+	if !ok {
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(userRequest.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("failed to hash password: %v", err)
+		utils.Error(w, r, http.StatusInternalServerError, errors.New("internal server error"))
+		return
+	}
+	user, err := h.store.AddUser(ctx, userRequest.Email, string(hash))
+	if err != nil {
+		utils.StorageError(w, r, err)
+		return
+	}
+	utils.JSON(w, http.StatusCreated, user)
+}
+
+// LoginHandler exchanges an email and password for a bearer token. Unknown
+// emails and wrong passwords get the same 401 after the same bcrypt work,
+// so that neither the response nor its timing tells which accounts exist.
+func (h *UserHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userRequest, ok := decodeUserRequest(w, r)
+	if !ok {
+		return
+	}
+	user, err := h.store.GetUserByEmail(ctx, userRequest.Email)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			bcrypt.CompareHashAndPassword(dummyHash, []byte(userRequest.Password))
+			utils.Error(w, r, http.StatusUnauthorized, errInvalidCredentials)
+			return
+		}
+		utils.StorageError(w, r, err)
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(userRequest.Password)); err != nil {
+		utils.Error(w, r, http.StatusUnauthorized, errInvalidCredentials)
+		return
+	}
+	token, err := auth.NewToken(h.secret, user.ID, h.tokenTTL)
+	if err != nil {
+		log.Printf("failed to create token: %v", err)
+		utils.Error(w, r, http.StatusInternalServerError, errors.New("internal server error"))
+		return
+	}
+	utils.JSON(w, http.StatusOK, models.Token{
+		Token:     token,
+		TokenType: "Bearer",
+		ExpiresIn: int(h.tokenTTL.Seconds()),
+	})
+}
+
+func decodeUserRequest(w http.ResponseWriter, r *http.Request) (models.UserRequest, bool) {
+	var userRequest models.UserRequest
+	if err := json.NewDecoder(r.Body).Decode(&userRequest); err != nil {
+		utils.Error(w, r, http.StatusBadRequest, errors.New("invalid request payload"))
+		return userRequest, false
+	}
+	if err := utils.ValidateStruct(userRequest); err != nil {
+		utils.ValidationError(w, r, err)
+		return userRequest, false
+	}
+	return userRequest, true
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmgchess/gotodo/auth"
+	"github.com/cmgchess/gotodo/models"
+	"github.com/cmgchess/gotodo/storage"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUserHandlers(t *testing.T) {
+	secret := []byte("secret")
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(userHandler *UserHandler, path, body string, handler func(*UserHandler) http.HandlerFunc) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc(path, handler(userHandler)).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	register := func(h *UserHandler) http.HandlerFunc { return h.RegisterHandler }
+	login := func(h *UserHandler) http.HandlerFunc { return h.LoginHandler }
+
+	t.Run("should return 201 with a hashed password if user registered successfully", func(t *testing.T) {
+		var stored string
+		userHandler := NewUserHandler(&mockUserStore{
+			AddUserFunc: func(ctx context.Context, email, passwordHash string) (models.User, error) {
+				stored = passwordHash
+				return models.User{ID: 1, Email: email, PasswordHash: passwordHash}, nil
+			},
+		}, secret, time.Hour)
+
+		rr := serve(userHandler, "/auth/register", `{"email": "alice@example.com", "password": "correct horse"}`, register)
+
+		if rr.Code != http.StatusCreated {
+			t.Errorf("expected status code 201, got %d", rr.Code)
+		}
+		if bcrypt.CompareHashAndPassword([]byte(stored), []byte("correct horse")) != nil {
+			t.Errorf("expected a bcrypt hash of the password to be stored, got %q", stored)
+		}
+		if strings.Contains(rr.Body.String(), stored) {
+			t.Errorf("expected the password hash to stay out of the response, got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("should return 400 if password is too short when registering", func(t *testing.T) {
+		userHandler := NewUserHandler(&mockUserStore{}, secret, time.Hour)
+
+		rr := serve(userHandler, "/auth/register", `{"email": "alice@example.com", "password": "short"}`, register)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 400 if password is longer than 72 bytes when registering", func(t *testing.T) {
+		userHandler := NewUserHandler(&mockUserStore{}, secret, time.Hour)
+
+		rr := serve(userHandler, "/auth/register", `{"email": "alice@example.com", "password": "`+strings.Repeat("é", 72)+`"}`, register)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 409 if email is taken when registering", func(t *testing.T) {
+		userHandler := NewUserHandler(&mockUserStore{
+			AddUserFunc: func(ctx context.Context, email, passwordHash string) (models.User, error) {
+				return models.User{}, storage.ErrConflict
+			},
+		}, secret, time.Hour)
+
+		rr := serve(userHandler, "/auth/register", `{"email": "alice@example.com", "password": "correct horse"}`, register)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code 409, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 200 with a token for the user if login succeeded", func(t *testing.T) {
+		userHandler := NewUserHandler(&mockUserStore{
+			GetUserByEmailFunc: func(ctx context.Context, email string) (*models.User, error) {
+				return &models.User{ID: 7, Email: email, PasswordHash: string(hash)}, nil
+			},
+		}, secret, time.Hour)
+
+		rr := serve(userHandler, "/auth/login", `{"email": "alice@example.com", "password": "correct horse"}`, login)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, got %d", rr.Code)
+		}
+		var token models.Token
+		if err := json.NewDecoder(rr.Body).Decode(&token); err != nil {
+			t.Fatal(err)
+		}
+		verifier, err := auth.NewVerifier(auth.KeyConfig{Secret: secret})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if principal, err := verifier.Verify(token.Token); err != nil || principal.UserID != 7 {
+			t.Errorf("expected a token for user 7, got %d, %v", principal.UserID, err)
+		}
+		if token.TokenType != "Bearer" || token.ExpiresIn != 3600 {
+			t.Errorf("unexpected token %+v", token)
+		}
+	})
+
+	t.Run("should return 401 if password is wrong when logging in", func(t *testing.T) {
+		userHandler := NewUserHandler(&mockUserStore{
+			GetUserByEmailFunc: func(ctx context.Context, email string) (*models.User, error) {
+				return &models.User{ID: 7, Email: email, PasswordHash: string(hash)}, nil
+			},
+		}, secret, time.Hour)
+
+		rr := serve(userHandler, "/auth/login", `{"email": "alice@example.com", "password": "wrong horse"}`, login)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code 401, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should return 401 if user is unknown when logging in", func(t *testing.T) {
+		userHandler := NewUserHandler(&mockUserStore{
+			GetUserByEmailFunc: func(ctx context.Context, email string) (*models.User, error) {
+				return nil, storage.ErrNotFound
+			},
+		}, secret, time.Hour)
+
+		rr := serve(userHandler, "/auth/login", `{"email": "bob@example.com", "password": "correct horse"}`, login)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code 401, got %d", rr.Code)
+		}
+	})
+}
+
+type mockUserStore struct {
+	AddUserFunc        func(ctx context.Context, email, passwordHash string) (models.User, error)
+	GetUserByEmailFunc func(ctx context.Context, email string) (*models.User, error)
+}
+
+func (m *mockUserStore) AddUser(ctx context.Context, email, passwordHash string) (models.User, error) {
+	return m.AddUserFunc(ctx, email, passwordHash)
+}
+
+func (m *mockUserStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return m.GetUserByEmailFunc(ctx, email)
+}
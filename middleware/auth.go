@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cmgchess/gotodo/auth"
+	"github.com/cmgchess/gotodo/models"
+	"github.com/cmgchess/gotodo/storage"
+	"github.com/cmgchess/gotodo/utils"
+)
+
+const authRealm = "gotodo"
+
+type principalContextKey struct{}
+
+// PrincipalFromContext returns the principal AuthMiddleware verified for the
+// request ctx belongs to, if any.
+func PrincipalFromContext(ctx context.Context) (auth.Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(auth.Principal)
+	return principal, ok
+}
+
+// AuthMiddleware requires requests to carry either a bearer token the
+// verifier accepts or an API key in an "Authorization: ApiKey" header. It
+// puts the principal into the request context and lets the storage act for
+// its user. Requests without valid credentials are rejected with 401 and a
+// WWW-Authenticate challenge as in RFC 6750, and unsafe requests made with a
+// read-only API key with 403.
+func AuthMiddleware(verifier *auth.Verifier, apiKeys storage.APIKeyStorage) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var principal auth.Principal
+			var err error
+			scheme, credentials, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+			switch {
+			case credentials == "":
+				challenge(w, r, "", errors.New("missing bearer token or API key"))
+				return
+			case strings.EqualFold(scheme, "Bearer"):
+				principal, err = verifier.Verify(credentials)
+			case strings.EqualFold(scheme, "ApiKey"):
+				principal, err = apiKeyPrincipal(r.Context(), apiKeys, credentials)
+			default:
+				challenge(w, r, "", fmt.Errorf("unsupported authorization scheme %q", scheme))
+				return
+			}
+			if err != nil {
+				if !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, auth.ErrInvalidToken) && !errors.Is(err, auth.ErrTokenExpired) {
+					utils.StorageError(w, r, err)
+					return
+				}
+				challenge(w, r, "invalid_token", err)
+				return
+			}
+			if principal.Scope == models.ScopeRead && !isSafeMethod(r.Method) {
+				forbid(w, r, "insufficient_scope", errors.New("API key is read-only"))
+				return
+			}
+			ctx := context.WithValue(r.Context(), principalContextKey{}, principal)
+			ctx = storage.WithOwner(ctx, principal.UserID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// TokenOnlyMiddleware rejects requests authenticated with an API key with
+// 403, for routes such as managing API keys that scripts must not reach. It
+// goes after AuthMiddleware.
+func TokenOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if principal, _ := PrincipalFromContext(r.Context()); principal.APIKeyID != 0 {
+			forbid(w, r, "insufficient_scope", errors.New("API keys cannot be used here"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiKeyPrincipal looks up the API key presented in a request and records
+// its use.
+func apiKeyPrincipal(ctx context.Context, apiKeys storage.APIKeyStorage, key string) (auth.Principal, error) {
+	apiKey, err := apiKeys.UseAPIKey(ctx, auth.HashAPIKey(key), time.Now().UTC())
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	return auth.Principal{UserID: apiKey.OwnerID, APIKeyID: apiKey.ID, Scope: apiKey.Scope}, nil
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// challenge rejects r with 401. A request that carried no credentials gets
+// no error code in the challenge, as RFC 6750 asks.
+func challenge(w http.ResponseWriter, r *http.Request, code string, err error) {
+	for _, scheme := range []string{"Bearer", "ApiKey"} {
+		w.Header().Add("WWW-Authenticate", authenticate(scheme, code, err))
+	}
+	utils.Error(w, r, http.StatusUnauthorized, err)
+}
+
+// forbid rejects r with 403 for credentials that are valid but not enough.
+func forbid(w http.ResponseWriter, r *http.Request, code string, err error) {
+	w.Header().Set("WWW-Authenticate", authenticate("Bearer", code, err))
+	utils.Error(w, r, http.StatusForbidden, err)
+}
+
+func authenticate(scheme, code string, err error) string {
+	value := fmt.Sprintf("%s realm=%q", scheme, authRealm)
+	if code != "" {
+		value += fmt.Sprintf(", error=%q, error_description=%q", code, err.Error())
+	}
+	return value
+}
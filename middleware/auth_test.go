@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmgchess/gotodo/auth"
+	"github.com/cmgchess/gotodo/models"
+	"github.com/cmgchess/gotodo/storage"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	secret := []byte("secret")
+	verifier, err := auth.NewVerifier(auth.KeyConfig{Secret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewMemoryStorage()
+	user, err := store.AddUser(context.Background(), "alice@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addKey := func(scope string, expiresAt *time.Time) string {
+		key, prefix, err := auth.NewAPIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := storage.WithOwner(context.Background(), user.ID)
+		apiKey := models.APIKey{Name: "script", Prefix: prefix, Scope: scope, ExpiresAt: expiresAt}
+		if _, err := store.AddAPIKey(ctx, apiKey, auth.HashAPIKey(key)); err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	var owner int
+	var principal auth.Principal
+	handler := AuthMiddleware(verifier, store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		owner, _ = storage.OwnerFromContext(r.Context())
+		principal, _ = PrincipalFromContext(r.Context())
+	}))
+	sendMethod := func(method, authorization string) *httptest.ResponseRecorder {
+		owner = 0
+		req := httptest.NewRequest(method, "/todos", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	send := func(authorization string) *httptest.ResponseRecorder {
+		return sendMethod(http.MethodGet, authorization)
+	}
+
+	t.Run("should act for the user of a valid token", func(t *testing.T) {
+		token, err := auth.NewToken(secret, 7, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := send("Bearer " + token)
+		if rr.Code != http.StatusOK || owner != 7 || principal.UserID != 7 {
+			t.Errorf("expected status code 200 for user 7, got %d for user %d", rr.Code, owner)
+		}
+	})
+
+	t.Run("should return 401 with a challenge without a token", func(t *testing.T) {
+		rr := send("")
+		if rr.Code != http.StatusUnauthorized || owner != 0 {
+			t.Errorf("expected status code 401, got %d", rr.Code)
+		}
+		if got := rr.Header().Get("WWW-Authenticate"); got != `Bearer realm="gotodo"` {
+			t.Errorf("unexpected WWW-Authenticate %q", got)
+		}
+	})
+
+	t.Run("should return 401 for a token signed with another secret", func(t *testing.T) {
+		token, _ := auth.NewToken([]byte("other"), 7, time.Hour)
+		rr := send("Bearer " + token)
+		if rr.Code != http.StatusUnauthorized || owner != 0 {
+			t.Errorf("expected status code 401, got %d", rr.Code)
+		}
+		if got := rr.Header().Get("WWW-Authenticate"); !strings.Contains(got, `error="invalid_token"`) {
+			t.Errorf("expected an invalid_token challenge, got %q", got)
+		}
+	})
+
+	t.Run("should return 401 for an expired token", func(t *testing.T) {
+		token, _ := auth.NewToken(secret, 7, -time.Minute)
+		rr := send("Bearer " + token)
+		if rr.Code != http.StatusUnauthorized || owner != 0 {
+			t.Errorf("expected status code 401, got %d", rr.Code)
+		}
+		if got := rr.Header().Get("WWW-Authenticate"); !strings.Contains(got, `error_description="token has expired"`) {
+			t.Errorf("expected an expiry challenge, got %q", got)
+		}
+	})
+
+	t.Run("should return 401 for another scheme", func(t *testing.T) {
+		if rr := send("Basic YWxpY2U6c2VjcmV0"); rr.Code != http.StatusUnauthorized || owner != 0 {
+			t.Errorf("expected status code 401, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should act for the owner of an API key", func(t *testing.T) {
+		key := addKey(models.ScopeReadWrite, nil)
+		rr := sendMethod(http.MethodPost, "ApiKey "+key)
+		if rr.Code != http.StatusOK || owner != user.ID || principal.APIKeyID == 0 {
+			t.Errorf("expected status code 200 for user %d, got %d for user %d", user.ID, rr.Code, owner)
+		}
+	})
+
+	t.Run("should return 401 for an unknown API key", func(t *testing.T) {
+		rr := send("ApiKey gtd_unknown")
+		if rr.Code != http.StatusUnauthorized || owner != 0 {
+			t.Errorf("expected status code 401, got %d", rr.Code)
+		}
+		if got := rr.Header().Values("WWW-Authenticate"); len(got) != 2 || !strings.Contains(got[1], `ApiKey realm="gotodo", error="invalid_token"`) {
+			t.Errorf("expected an invalid_token challenge for both schemes, got %q", got)
+		}
+	})
+
+	t.Run("should return 401 for an expired API key", func(t *testing.T) {
+		expiresAt := time.Now().Add(-time.Minute)
+		if rr := send("ApiKey " + addKey(models.ScopeReadWrite, &expiresAt)); rr.Code != http.StatusUnauthorized || owner != 0 {
+			t.Errorf("expected status code 401, got %d", rr.Code)
+		}
+	})
+
+	t.Run("should only let a read-only API key read", func(t *testing.T) {
+		key := addKey(models.ScopeRead, nil)
+		if rr := send("ApiKey " + key); rr.Code != http.StatusOK || owner != user.ID {
+			t.Errorf("expected status code 200, got %d", rr.Code)
+		}
+		rr := sendMethod(http.MethodDelete, "ApiKey "+key)
+		if rr.Code != http.StatusForbidden || owner != 0 {
+			t.Errorf("expected status code 403, got %d", rr.Code)
+		}
+		if got := rr.Header().Get("WWW-Authenticate"); !strings.Contains(got, `error="insufficient_scope"`) {
+			t.Errorf("expected an insufficient_scope challenge, got %q", got)
+		}
+	})
+}
+
+func TestTokenOnlyMiddleware(t *testing.T) {
+	handler := TokenOnlyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	send := func(principal auth.Principal) int {
+		req := httptest.NewRequest(http.MethodGet, "/api-keys", nil)
+		req = req.WithContext(context.WithValue(req.Context(), principalContextKey{}, principal))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := send(auth.Principal{UserID: 1, Scope: models.ScopeReadWrite}); code != http.StatusOK {
+		t.Errorf("expected status code 200 for a token, got %d", code)
+	}
+	if code := send(auth.Principal{UserID: 1, APIKeyID: 2, Scope: models.ScopeReadWrite}); code != http.StatusForbidden {
+		t.Errorf("expected status code 403 for an API key, got %d", code)
+	}
+}
@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cmgchess/gotodo/utils"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyMiddleware makes requests carrying an Idempotency-Key header
+// safe to retry. The first response for a client and key is stored for ttl
+// and replayed to later requests with the same key; reusing the key with a
+// different payload is rejected with 422. Server errors are not stored, so
+// they can be retried.
+func IdempotencyMiddleware(ttl time.Duration) func(http.Handler) http.Handler {
+	store := newIdempotencyStore(ttl)
+	return store.middleware
+}
+
+type idempotencyEntry struct {
+	fingerprint [sha256.Size]byte
+	done        bool
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+}
+
+type idempotencyStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]*idempotencyEntry
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+func (s *idempotencyStore) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			utils.Error(w, r, http.StatusBadRequest, errors.New("Idempotency-Key is too long"))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			utils.Error(w, r, http.StatusBadRequest, errors.New("invalid request payload"))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := sha256.Sum256([]byte(r.Method + " " + r.URL.RequestURI() + "\n" + string(body)))
+		id := ClientID(r) + "\x00" + key
+
+		entry, fresh := s.reserve(id, fingerprint)
+		switch {
+		case entry.fingerprint != fingerprint:
+			utils.Error(w, r, http.StatusUnprocessableEntity, errors.New("Idempotency-Key was already used with a different payload"))
+			return
+		case !fresh && !entry.done:
+			utils.Error(w, r, http.StatusConflict, errors.New("a request with this Idempotency-Key is still being processed"))
+			return
+		case !fresh:
+			for name, values := range entry.header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(entry.status)
+			w.Write(entry.body)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		completed := false
+		defer func() {
+			// Release the key if the handler panicked, so it can be retried.
+			if !completed {
+				s.release(id)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+		s.complete(id, rec)
+		completed = true
+	})
+}
+
+// reserve returns the live entry for id, or creates an in-flight one and
+// reports it as fresh. Expired entries are dropped, except those still in
+// flight, which complete or release removes.
+func (s *idempotencyStore) reserve(id string, fingerprint [sha256.Size]byte) (*idempotencyEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for k, e := range s.entries {
+		if e.done && now.After(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+
+	if entry, ok := s.entries[id]; ok {
+		return entry, false
+	}
+	entry := &idempotencyEntry{fingerprint: fingerprint, expires: now.Add(s.ttl)}
+	s.entries[id] = entry
+	return entry, true
+}
+
+func (s *idempotencyStore) complete(id string, rec *responseRecorder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.entries[id]
+	if entry == nil {
+		return
+	}
+	if rec.status >= http.StatusInternalServerError {
+		delete(s.entries, id)
+		return
+	}
+	entry.done = true
+	entry.status = rec.status
+	entry.header = rec.Header().Clone()
+	entry.body = rec.body.Bytes()
+	entry.expires = s.now().Add(s.ttl)
+}
+
+// release drops the in-flight entry for id without storing a response.
+func (s *idempotencyStore) release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, id)
+}
+
+// responseRecorder passes a response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// ClientID identifies the caller of r: by a hash of its Authorization
+// header when present, otherwise by its remote IP address.
+func ClientID(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		return "auth:" + hex.EncodeToString(sum[:])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	newHandler := func() (http.Handler, *idempotencyStore, *int) {
+		calls := 0
+		store := newIdempotencyStore(time.Hour)
+		handler := store.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"id": %d}`, calls)
+		}))
+		return handler, store, &calls
+	}
+	send := func(handler http.Handler, key, body, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should replay the first response for a retried key", func(t *testing.T) {
+		handler, _, calls := newHandler()
+
+		first := send(handler, "abc", `{"name": "Test Todo"}`, "10.0.0.1:1234")
+		retry := send(handler, "abc", `{"name": "Test Todo"}`, "10.0.0.1:5678")
+
+		if *calls != 1 {
+			t.Errorf("expected handler to be called once, got %d", *calls)
+		}
+		if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+			t.Errorf("expected replayed 201 %q, got %d %q", first.Body.String(), retry.Code, retry.Body.String())
+		}
+		if retry.Header().Get("Content-Type") != "application/json" || retry.Header().Get("Idempotent-Replayed") != "true" {
+			t.Errorf("expected replayed headers, got %v", retry.Header())
+		}
+	})
+
+	t.Run("should return 422 if key is reused with a different payload", func(t *testing.T) {
+		handler, _, calls := newHandler()
+
+		send(handler, "abc", `{"name": "Test Todo"}`, "10.0.0.1:1234")
+		rr := send(handler, "abc", `{"name": "Other Todo"}`, "10.0.0.1:1234")
+
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected status code 422, got %d", rr.Code)
+		}
+		if *calls != 1 {
+			t.Errorf("expected handler to be called once, got %d", *calls)
+		}
+	})
+
+	t.Run("should scope keys by client", func(t *testing.T) {
+		handler, _, calls := newHandler()
+
+		send(handler, "abc", `{"name": "Test Todo"}`, "10.0.0.1:1234")
+		send(handler, "abc", `{"name": "Test Todo"}`, "10.0.0.2:1234")
+
+		if *calls != 2 {
+			t.Errorf("expected handler to be called for each client, got %d", *calls)
+		}
+	})
+
+	t.Run("should execute again once the key expired", func(t *testing.T) {
+		handler, store, calls := newHandler()
+		now := time.Now()
+		store.now = func() time.Time { return now }
+
+		send(handler, "abc", `{"name": "Test Todo"}`, "10.0.0.1:1234")
+		now = now.Add(2 * time.Hour)
+		send(handler, "abc", `{"name": "Test Todo"}`, "10.0.0.1:1234")
+
+		if *calls != 2 {
+			t.Errorf("expected handler to be called again after expiry, got %d", *calls)
+		}
+	})
+
+	t.Run("should keep a key in flight past its expiry", func(t *testing.T) {
+		store := newIdempotencyStore(time.Hour)
+		now := time.Now()
+		store.now = func() time.Time { return now }
+		var retry *httptest.ResponseRecorder
+		var handler http.Handler
+		handler = store.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if retry == nil {
+				now = now.Add(2 * time.Hour)
+				retry = send(handler, "abc", `{"name": "Test Todo"}`, "10.0.0.1:1234")
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+		send(handler, "abc", `{"name": "Test Todo"}`, "10.0.0.1:1234")
+
+		if retry.Code != http.StatusConflict {
+			t.Errorf("expected status code 409 while in flight, got %d", retry.Code)
+		}
+	})
+
+	t.Run("should release the key if the handler panics", func(t *testing.T) {
+		store := newIdempotencyStore(time.Hour)
+		calls := 0
+		handler := store.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				panic("boom")
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected the panic to propagate")
+				}
+			}()
+			send(handler, "abc", `{"name": "Test Todo"}`, "10.0.0.1:1234")
+		}()
+		rr := send(handler, "abc", `{"name": "Test Todo"}`, "10.0.0.1:1234")
+
+		if rr.Code != http.StatusCreated || calls != 2 {
+			t.Errorf("expected the retry to run the handler again, got %d after %d calls", rr.Code, calls)
+		}
+	})
+
+	t.Run("should pass through requests without a key", func(t *testing.T) {
+		handler, _, calls := newHandler()
+
+		send(handler, "", `{"name": "Test Todo"}`, "10.0.0.1:1234")
+		send(handler, "", `{"name": "Test Todo"}`, "10.0.0.1:1234")
+
+		if *calls != 2 {
+			t.Errorf("expected handler to be called for each request, got %d", *calls)
+		}
+	})
+}
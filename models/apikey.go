@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Scopes an APIKey can be limited to.
+const (
+	ScopeRead      = "read"
+	ScopeReadWrite = "read-write"
+)
+
+// APIKey lets scripts call the API on behalf of its owner without logging
+// in. Only a hash of the key is kept; the key itself is returned once, when
+// it is created, and Prefix is what identifies it afterwards. A key whose
+// Scope is ScopeRead can only make safe requests. Keys with an ExpiresAt in
+// the past stop working.
+type APIKey struct {
+	ID         int        `json:"id"`
+	OwnerID    int        `json:"owner_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scope      string     `json:"scope"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type APIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scope     string     `json:"scope" validate:"required,oneof=read read-write"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// NewAPIKey is a key just created, along with the key itself.
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
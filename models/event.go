@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Actions a TodoEvent records.
+const (
+	EventCreated           = "created"
+	EventUpdated           = "updated"
+	EventEnabled           = "enabled"
+	EventDisabled          = "disabled"
+	EventCompleted         = "completed"
+	EventReopened          = "reopened"
+	EventMoved             = "moved"
+	EventTagged            = "tagged"
+	EventUntagged          = "untagged"
+	EventDependencyAdded   = "dependency_added"
+	EventDependencyRemoved = "dependency_removed"
+	EventTrashed           = "trashed"
+	EventRestored          = "restored"
+	EventDeleted           = "deleted"
+)
+
+// TodoEvent records one change made to a todo. Before and After hold the
+// fields the change touched, as JSON objects keyed like a Todo; Before is
+// null for the todo being created and After for it being deleted for good.
+// Version is the version the change left the todo at. OwnerID is the owner
+// of the todo, kept so the history stays private after it is deleted, and
+// ActorID the user who made the change, who may be one the todo is shared
+// with.
+type TodoEvent struct {
+	ID        int             `json:"id"`
+	TodoID    int             `json:"todo_id"`
+	OwnerID   int             `json:"-"`
+	ActorID   int             `json:"actor_id"`
+	Action    string          `json:"action"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	Version   int             `json:"version"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type TodoEventPage struct {
+	Events     []TodoEvent `json:"events"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// List groups todos. Every todo belongs to exactly one list of its owner;
+// todos created without one go to the owner's default list, which cannot be
+// deleted. Role is the role the user the list was fetched for has on it.
+type List struct {
+	ID          int       `json:"id"`
+	OwnerID     int       `json:"owner_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Default     bool      `json:"default"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type ListRequest struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=1000"`
+}
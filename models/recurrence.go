@@ -0,0 +1,76 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+// ParseRRule parses an RFC 5545 recurrence rule such as
+// "FREQ=WEEKLY;BYDAY=MO,WE", with or without the "RRULE:" prefix. DTSTART
+// is not allowed: occurrences are anchored to the todo's due date.
+func ParseRRule(rule string) (*rrule.ROption, error) {
+	if strings.ContainsAny(rule, "\r\n") {
+		return nil, errors.New("rrule must be a single RRULE line")
+	}
+	option, err := rrule.StrToROption(rule)
+	if err != nil {
+		return nil, err
+	}
+	if !option.Dtstart.IsZero() {
+		return nil, errors.New("rrule must not contain DTSTART")
+	}
+	if _, err := rrule.NewRRule(*option); err != nil {
+		return nil, err
+	}
+	return option, nil
+}
+
+// NextOccurrence returns the due date of the occurrence that follows the
+// todo and the rule that occurrence continues with, which has its COUNT
+// reduced by one. The todo's due date anchors the rule, or from if it has
+// none. ok is false if the todo does not recur or its rule has run out.
+func (t Todo) NextOccurrence(from time.Time) (dueAt time.Time, rule string, ok bool) {
+	if t.RRule == "" {
+		return time.Time{}, "", false
+	}
+	option, err := ParseRRule(t.RRule)
+	if err != nil || option.Count == 1 {
+		return time.Time{}, "", false
+	}
+	start := from
+	if t.DueAt != nil {
+		start = *t.DueAt
+	}
+	option.Dtstart = start.UTC()
+	r, err := rrule.NewRRule(*option)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	next := r.After(start, false)
+	if next.IsZero() {
+		return time.Time{}, "", false
+	}
+	if option.Count > 1 {
+		option.Count--
+	}
+	return next.UTC(), option.RRuleString(), true
+}
+
+// Occurrences returns the due dates of up to limit occurrences following
+// the todo, as completing each of them in turn would create them.
+func (t Todo) Occurrences(from time.Time, limit int) []time.Time {
+	dates := make([]time.Time, 0)
+	for len(dates) < limit {
+		dueAt, rule, ok := t.NextOccurrence(from)
+		if !ok {
+			break
+		}
+		dates = append(dates, dueAt)
+		t.DueAt = &dueAt
+		t.RRule = rule
+	}
+	return dates
+}
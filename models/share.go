@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Roles a list can be shared in, from least to most access. Viewers can
+// read the list and its todos, editors can also change them, and owners can
+// also share the list with others. The user who owns a list always has
+// RoleOwner.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+var roleRanks = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// Share gives the user UserID access to the list ListID in Role.
+type Share struct {
+	ListID    int       `json:"list_id"`
+	UserID    int       `json:"user_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ShareRequest struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+	Role  string `json:"role" validate:"required,oneof=viewer editor owner"`
+}
+
+// Access is what a user may do with a list or todo: act in Role on data
+// owned by the user OwnerID.
+type Access struct {
+	OwnerID int
+	Role    string
+}
+
+// Allows reports whether a has at least the given role.
+func (a Access) Allows(role string) bool {
+	return roleRanks[a.Role] >= roleRanks[role] && roleRanks[role] > 0
+}
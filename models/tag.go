@@ -0,0 +1,12 @@
+package models
+
+// Tag labels todos. Tag names are unique per owner, and only the owner's
+// todos can carry the tag.
+type Tag struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type TagRequest struct {
+	Name string `json:"name" validate:"required,max=50"`
+}
@@ -2,17 +2,142 @@ package models
 
 import "time"
 
+const (
+	PriorityNone   = "none"
+	PriorityLow    = "low"
+	PriorityMedium = "medium"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+// PriorityRank orders priorities from most urgent (0) to none (4).
+func PriorityRank(priority string) int {
+	switch priority {
+	case PriorityUrgent:
+		return 0
+	case PriorityHigh:
+		return 1
+	case PriorityMedium:
+		return 2
+	case PriorityLow:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// Todo is a single task. Subtasks point to their parent with ParentID; a
+// parent with AutoComplete set is completed once its last open subtask is.
+// BlockedBy lists the todos that must be completed first, and Blocked is set
+// while any of them is open. A todo with an RRule recurs: completing it
+// the first time creates the next occurrence, which carries the rule on.
+// Rank holds the manual order of todos, set with a MoveRequest. DeletedAt is
+// set while the todo is in the trash.
 type Todo struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Completed   bool      `json:"completed"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Enabled     bool      `json:"enabled"`
+	ID           int        `json:"id"`
+	OwnerID      int        `json:"owner_id"`
+	ListID       int        `json:"list_id"`
+	ParentID     *int       `json:"parent_id"`
+	Name         string     `json:"name"`
+	Description  string     `json:"description"`
+	Priority     string     `json:"priority"`
+	Rank         string     `json:"rank"`
+	Completed    bool       `json:"completed"`
+	CompletedAt  *time.Time `json:"completed_at"`
+	DueAt        *time.Time `json:"due_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	DeletedAt    *time.Time `json:"deleted_at"`
+	Enabled      bool       `json:"enabled"`
+	AutoComplete bool       `json:"auto_complete"`
+	RRule        string     `json:"rrule"`
+	Version      int        `json:"version"`
+	Tags         []Tag      `json:"tags"`
+	BlockedBy    []int      `json:"blocked_by"`
+	Blocked      bool       `json:"blocked"`
 }
 
+// TodoRequest holds the writable fields of a todo. A zero ListID means the
+// default list when adding a todo, or its parent's list for a subtask, and
+// the current list when updating one. Subtasks are always in their parent's
+// list.
 type TodoRequest struct {
-	Name        string `json:"name" validate:"required,max=100,min=3"`
-	Description string `json:"description" validate:"max=1000"`
+	ListID       int     `json:"list_id,omitempty" validate:"omitempty,min=1"`
+	ParentID     *int    `json:"parent_id,omitempty" validate:"omitempty,min=1"`
+	Name         string  `json:"name" validate:"required,max=100,min=3"`
+	Description  string  `json:"description" validate:"max=1000"`
+	Priority     string  `json:"priority,omitempty" validate:"omitempty,oneof=none low medium high urgent"`
+	DueAt        *string `json:"due_at,omitempty" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	AutoComplete bool    `json:"auto_complete,omitempty"`
+	RRule        string  `json:"rrule,omitempty" validate:"omitempty,max=500,rrule"`
+}
+
+// PriorityOrDefault returns the requested priority, or PriorityNone if the
+// request has none.
+func (r TodoRequest) PriorityOrDefault() string {
+	if r.Priority == "" {
+		return PriorityNone
+	}
+	return r.Priority
+}
+
+// DueTime returns the parsed due date of a validated request, or nil if it
+// has none.
+func (r TodoRequest) DueTime() *time.Time {
+	if r.DueAt == nil {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, *r.DueAt)
+	if err != nil {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+// Request returns the writable fields of the todo, as a client would send
+// them to update it.
+func (t Todo) Request() TodoRequest {
+	r := TodoRequest{
+		ListID:       t.ListID,
+		ParentID:     t.ParentID,
+		AutoComplete: t.AutoComplete,
+		RRule:        t.RRule,
+		Name:         t.Name,
+		Description:  t.Description,
+		Priority:     t.Priority,
+	}
+	if t.DueAt != nil {
+		dueAt := t.DueAt.Format(time.RFC3339Nano)
+		r.DueAt = &dueAt
+	}
+	return r
+}
+
+// MoveRequest places a todo right before the todo Before or right after the
+// todo After. Given both, the todo goes right after After, which must come
+// before Before.
+type MoveRequest struct {
+	Before *int `json:"before,omitempty" validate:"omitempty,min=1"`
+	After  *int `json:"after,omitempty" validate:"omitempty,min=1"`
+}
+
+// TodoTree is a todo with all of its subtasks, recursively.
+type TodoTree struct {
+	Todo
+	Children []TodoTree `json:"children"`
+}
+
+type TodoPage struct {
+	Todos      []Todo `json:"todos"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// TodoSearchResult is a todo matching a search. Snippet is an HTML excerpt of
+// its name and description with the matching words wrapped in <mark> tags;
+// the text itself is escaped, so clients can render the snippet as is.
+type TodoSearchResult struct {
+	Todo
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
 }
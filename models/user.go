@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// User owns todos, tags and lists. PasswordHash is a bcrypt hash and never
+// leaves the server.
+type User struct {
+	ID           int       `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// UserRequest holds the credentials a user registers or logs in with.
+// bcrypt cannot hash passwords longer than 72 bytes, which may be fewer
+// characters, so those are rejected.
+type UserRequest struct {
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required,min=8,maxbytes=72"`
+}
+
+// Token is what a successful login returns: a bearer token for the
+// Authorization header and the number of seconds it stays valid.
+type Token struct {
+	Token     string `json:"token"`
+	TokenType string `json:"token_type"`
+	ExpiresIn int    `json:"expires_in"`
+}
@@ -3,31 +3,92 @@ package router
 import (
 	"net/http"
 
+	"github.com/cmgchess/gotodo/auth"
+	"github.com/cmgchess/gotodo/configs"
 	"github.com/cmgchess/gotodo/handlers"
 	"github.com/cmgchess/gotodo/middleware"
 	"github.com/cmgchess/gotodo/storage"
 	"github.com/gorilla/mux"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func SetupRouter(db *pgxpool.Pool) *mux.Router {
+// SetupRouter returns the API router. /ping, registration and login are
+// public; every other route needs a bearer token verifier accepts or an API
+// key, except for managing API keys, which needs a token. Only listing and
+// creating todos are nested under /lists/{listID}/todos; a single todo is
+// addressed as /todos/{id}, whichever list it is in.
+func SetupRouter(store storage.Store, verifier *auth.Verifier) *mux.Router {
 	r := mux.NewRouter()
 	sr := r.PathPrefix("/api/v1").Subrouter()
 
 	sr.Use(middleware.LoggingMiddleware)
 
+	idempotency := middleware.IdempotencyMiddleware(configs.Envs.IdempotencyTTL)
+
+	api := sr.NewRoute().Subrouter()
+	api.Use(middleware.AuthMiddleware(verifier, store))
+
 	pingHandler := handlers.NewPingHandler()
-	todoHandler := handlers.NewTodoHandler(storage.NewPostgresStorage(db))
+	todoHandler := handlers.NewTodoHandler(store, store)
+	tagHandler := handlers.NewTagHandler(store)
+	listHandler := handlers.NewListHandler(store, store)
+	shareHandler := handlers.NewShareHandler(store)
+	apiKeyHandler := handlers.NewAPIKeyHandler(store)
+	userHandler := handlers.NewUserHandler(store, configs.Envs.JWTSecret, configs.Envs.TokenTTL)
 
 	r.Handle("/ping", middleware.LoggingMiddleware(http.HandlerFunc(pingHandler.HealthHandler))).Methods(http.MethodGet)
 
-	sr.HandleFunc("/todos", todoHandler.GetTodosHandler).Methods(http.MethodGet)
-	sr.HandleFunc("/todos/{id}", todoHandler.GetTodoByIDHandler).Methods(http.MethodGet)
-	sr.HandleFunc("/todos", todoHandler.AddTodoHandler).Methods(http.MethodPost)
-	sr.HandleFunc("/todos/{id}/enable", todoHandler.EnableTodoHandler).Methods(http.MethodPatch)
-	sr.HandleFunc("/todos/{id}/disable", todoHandler.DisableTodoHandler).Methods(http.MethodPatch)
-	sr.HandleFunc("/todos/{id}", todoHandler.UpdateTodoHandler).Methods(http.MethodPut)
-	sr.HandleFunc("/todos/{id}", todoHandler.DeleteTodoHandler).Methods(http.MethodDelete)
+	sr.HandleFunc("/auth/register", userHandler.RegisterHandler).Methods(http.MethodPost)
+	sr.HandleFunc("/auth/login", userHandler.LoginHandler).Methods(http.MethodPost)
+
+	api.HandleFunc("/todos", todoHandler.GetTodosHandler).Methods(http.MethodGet)
+	api.HandleFunc("/todos/overdue", todoHandler.GetOverdueTodosHandler).Methods(http.MethodGet)
+	api.HandleFunc("/todos/search", todoHandler.SearchTodosHandler).Methods(http.MethodGet)
+	api.HandleFunc("/todos/{id}", todoHandler.GetTodoByIDHandler).Methods(http.MethodGet)
+	api.HandleFunc("/todos/{id}/children", todoHandler.GetTodoChildrenHandler).Methods(http.MethodGet)
+	api.HandleFunc("/todos/{id}/tree", todoHandler.GetTodoTreeHandler).Methods(http.MethodGet)
+	api.HandleFunc("/todos/{id}/occurrences", todoHandler.GetTodoOccurrencesHandler).Methods(http.MethodGet)
+	api.HandleFunc("/todos/{id}/history", todoHandler.GetTodoHistoryHandler).Methods(http.MethodGet)
+	api.Handle("/todos", idempotency(http.HandlerFunc(todoHandler.AddTodoHandler))).Methods(http.MethodPost)
+	api.HandleFunc("/todos/{id}/enable", todoHandler.EnableTodoHandler).Methods(http.MethodPatch)
+	api.HandleFunc("/todos/{id}/disable", todoHandler.DisableTodoHandler).Methods(http.MethodPatch)
+	api.HandleFunc("/todos/{id}/complete", todoHandler.CompleteTodoHandler).Methods(http.MethodPatch)
+	api.HandleFunc("/todos/{id}/reopen", todoHandler.ReopenTodoHandler).Methods(http.MethodPatch)
+	api.HandleFunc("/todos/{id}", todoHandler.UpdateTodoHandler).Methods(http.MethodPut)
+	api.HandleFunc("/todos/{id}", todoHandler.PatchTodoHandler).Methods(http.MethodPatch)
+	api.HandleFunc("/todos/{id}", todoHandler.DeleteTodoHandler).Methods(http.MethodDelete)
+	api.HandleFunc("/todos/{id}/move", todoHandler.MoveTodoHandler).Methods(http.MethodPost)
+	api.HandleFunc("/todos/{id}/restore", todoHandler.RestoreTodoHandler).Methods(http.MethodPost)
+	api.HandleFunc("/todos/{id}/blocked-by/{blockerID}", todoHandler.AddDependencyHandler).Methods(http.MethodPut)
+	api.HandleFunc("/todos/{id}/blocked-by/{blockerID}", todoHandler.RemoveDependencyHandler).Methods(http.MethodDelete)
+	api.HandleFunc("/todos/{id}/tags/{tagID}", tagHandler.AttachTagHandler).Methods(http.MethodPut)
+	api.HandleFunc("/todos/{id}/tags/{tagID}", tagHandler.DetachTagHandler).Methods(http.MethodDelete)
+
+	api.HandleFunc("/trash", todoHandler.GetTrashHandler).Methods(http.MethodGet)
+	api.HandleFunc("/undo", todoHandler.UndoHandler).Methods(http.MethodPost)
+	api.HandleFunc("/redo", todoHandler.RedoHandler).Methods(http.MethodPost)
+
+	api.HandleFunc("/tags", tagHandler.GetTagsHandler).Methods(http.MethodGet)
+	api.HandleFunc("/tags/{id}", tagHandler.GetTagByIDHandler).Methods(http.MethodGet)
+	api.HandleFunc("/tags", tagHandler.AddTagHandler).Methods(http.MethodPost)
+	api.HandleFunc("/tags/{id}", tagHandler.UpdateTagHandler).Methods(http.MethodPut)
+	api.HandleFunc("/tags/{id}", tagHandler.DeleteTagHandler).Methods(http.MethodDelete)
+
+	api.HandleFunc("/lists", listHandler.GetListsHandler).Methods(http.MethodGet)
+	api.HandleFunc("/lists/{listID}", listHandler.GetListByIDHandler).Methods(http.MethodGet)
+	api.HandleFunc("/lists", listHandler.AddListHandler).Methods(http.MethodPost)
+	api.HandleFunc("/lists/{listID}", listHandler.UpdateListHandler).Methods(http.MethodPut)
+	api.HandleFunc("/lists/{listID}", listHandler.DeleteListHandler).Methods(http.MethodDelete)
+	api.HandleFunc("/lists/{listID}/todos", todoHandler.GetTodosHandler).Methods(http.MethodGet)
+	api.Handle("/lists/{listID}/todos", idempotency(http.HandlerFunc(todoHandler.AddTodoHandler))).Methods(http.MethodPost)
+	api.HandleFunc("/lists/{listID}/shares", shareHandler.GetSharesHandler).Methods(http.MethodGet)
+	api.HandleFunc("/lists/{listID}/shares", shareHandler.ShareListHandler).Methods(http.MethodPost)
+	api.HandleFunc("/lists/{listID}/shares/{userID}", shareHandler.UnshareListHandler).Methods(http.MethodDelete)
+
+	keys := api.PathPrefix("/api-keys").Subrouter()
+	keys.Use(middleware.TokenOnlyMiddleware)
+	keys.HandleFunc("", apiKeyHandler.GetAPIKeysHandler).Methods(http.MethodGet)
+	keys.HandleFunc("", apiKeyHandler.AddAPIKeyHandler).Methods(http.MethodPost)
+	keys.HandleFunc("/{id}", apiKeyHandler.DeleteAPIKeyHandler).Methods(http.MethodDelete)
 
 	return r
 }
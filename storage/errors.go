@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by Store implementations. They are wrapped with details
+// about the todo, tag or list involved, so compare with errors.Is.
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrConflict           = errors.New("conflict")
+	ErrAlreadyInState     = errors.New("already in requested state")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrInvalidCursor      = errors.New("invalid cursor")
+	ErrBlocked            = errors.New("blocked")
+	ErrUnauthenticated    = errors.New("unauthenticated")
+	ErrForbidden          = errors.New("forbidden")
+)
+
+func notFound(id int) error {
+	return fmt.Errorf("todo with id %d %w", id, ErrNotFound)
+}
+
+func alreadyInState(id int, state string) error {
+	return fmt.Errorf("todo with id %d is already %s: %w", id, state, ErrAlreadyInState)
+}
+
+func preconditionFailed(id, version int) error {
+	return fmt.Errorf("todo with id %d is at version %d: %w", id, version, ErrPreconditionFailed)
+}
+
+func userNotFound(email string) error {
+	return fmt.Errorf("user %q %w", email, ErrNotFound)
+}
+
+func userExists(email string) error {
+	return fmt.Errorf("user %q already exists: %w", email, ErrConflict)
+}
+
+func apiKeyNotFound(id int) error {
+	return fmt.Errorf("API key with id %d %w", id, ErrNotFound)
+}
+
+// errUnknownAPIKey is returned for keys that do not exist or have expired.
+// It names no key, as the caller only holds the secret.
+var errUnknownAPIKey = fmt.Errorf("API key %w", ErrNotFound)
+
+func tagNotFound(id int) error {
+	return fmt.Errorf("tag with id %d %w", id, ErrNotFound)
+}
+
+func tagExists(name string) error {
+	return fmt.Errorf("tag %q already exists: %w", name, ErrConflict)
+}
+
+func tagNotAttached(todoID, tagID int) error {
+	return fmt.Errorf("tag with id %d is not attached to todo with id %d: %w", tagID, todoID, ErrNotFound)
+}
+
+func listNotFound(id int) error {
+	return fmt.Errorf("list with id %d %w", id, ErrNotFound)
+}
+
+func defaultListDeleted(id int) error {
+	return fmt.Errorf("list with id %d is the default list and cannot be deleted: %w", id, ErrConflict)
+}
+
+func shareNotFound(listID, userID int) error {
+	return fmt.Errorf("list with id %d is not shared with user %d: %w", listID, userID, ErrNotFound)
+}
+
+func sharedWithOwner(listID int) error {
+	return fmt.Errorf("list with id %d cannot be shared with its owner: %w", listID, ErrConflict)
+}
+
+func parentNotFound(id int) error {
+	return fmt.Errorf("parent todo with id %d %w", id, ErrNotFound)
+}
+
+func subtaskListMismatch(parentID, listID int) error {
+	return fmt.Errorf("subtasks of todo with id %d must be in its list, not list with id %d: %w", parentID, listID, ErrConflict)
+}
+
+func cyclicParent(id, parentID int) error {
+	return fmt.Errorf("todo with id %d cannot be a subtask of its own subtask %d: %w", id, parentID, ErrConflict)
+}
+
+func blockerNotFound(id int) error {
+	return fmt.Errorf("blocking todo with id %d %w", id, ErrNotFound)
+}
+
+func dependencyNotFound(id, blockerID int) error {
+	return fmt.Errorf("todo with id %d is not blocked by todo with id %d: %w", id, blockerID, ErrNotFound)
+}
+
+func cyclicDependency(id, blockerID int) error {
+	return fmt.Errorf("todo with id %d cannot be blocked by todo with id %d, which waits for it: %w", id, blockerID, ErrConflict)
+}
+
+func moveTargetNotFound(id int) error {
+	return fmt.Errorf("todo with id %d to move next to %w", id, ErrNotFound)
+}
+
+func movedNextToItself(id int) error {
+	return fmt.Errorf("todo with id %d cannot be moved next to itself: %w", id, ErrConflict)
+}
+
+func moveOutOfOrder(afterID, beforeID int) error {
+	return fmt.Errorf("todo with id %d does not come before todo with id %d: %w", afterID, beforeID, ErrConflict)
+}
+
+func notTrashed(id int) error {
+	return fmt.Errorf("todo with id %d is not in the trash: %w", id, ErrAlreadyInState)
+}
+
+func parentInTrash(id, parentID int) error {
+	return fmt.Errorf("todo with id %d cannot be restored while its parent %d is in the trash: %w", id, parentID, ErrConflict)
+}
+
+func blocked(id int) error {
+	return fmt.Errorf("todo with id %d is blocked by open todos: %w", id, ErrBlocked)
+}
+
+func nothingToUndo(redo bool) error {
+	if redo {
+		return fmt.Errorf("nothing to redo: %w", ErrConflict)
+	}
+	return fmt.Errorf("nothing to undo: %w", ErrConflict)
+}
+
+func revertForbidden(id int) error {
+	return fmt.Errorf("editor role on todo with id %d required to revert its change: %w", id, ErrForbidden)
+}
+
+func changedSince(id int, action string) error {
+	return fmt.Errorf("todo with id %d changed since it was %s: %w", id, action, ErrConflict)
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/cmgchess/gotodo/models"
+)
+
+const (
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 100
+)
+
+// HistoryQuery selects a page of the events of a todo, most recent first.
+// A zero Limit falls back to DefaultHistoryLimit.
+type HistoryQuery struct {
+	Limit  int
+	Cursor string
+}
+
+func (q HistoryQuery) normalize() HistoryQuery {
+	if q.Limit <= 0 {
+		q.Limit = DefaultHistoryLimit
+	}
+	if q.Limit > MaxHistoryLimit {
+		q.Limit = MaxHistoryLimit
+	}
+	return q
+}
+
+// afterEvent returns the ID of the event the page starts after, or zero for
+// the first page. Cursors are opaque to clients like those of TodoQuery.
+func (q HistoryQuery) afterEvent() (int, error) {
+	if q.Cursor == "" {
+		return 0, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.Atoi(string(b))
+	if err != nil || id < 1 {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
+
+// eventPage trims events fetched with one extra row to q.Limit and sets the
+// cursor for the next page when that extra row was present.
+func eventPage(q HistoryQuery, events []models.TodoEvent) models.TodoEventPage {
+	p := models.TodoEventPage{Events: events}
+	if len(events) > q.Limit {
+		p.Events = events[:q.Limit]
+		last := p.Events[q.Limit-1].ID
+		p.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(last)))
+	}
+	return p
+}
+
+// newEvent returns the event recording a change of a todo from before to
+// after, either of which is nil if the change created or deleted it. ok is
+// false if the change left every recorded field as it was.
+func newEvent(action string, before, after *models.Todo, now time.Time) (event models.TodoEvent, ok bool) {
+	event = models.TodoEvent{Action: action, CreatedAt: now}
+	if after != nil {
+		event.TodoID, event.OwnerID, event.Version = after.ID, after.OwnerID, after.Version
+	} else {
+		event.TodoID, event.OwnerID, event.Version = before.ID, before.OwnerID, before.Version
+	}
+	b, a := todoFields(before), todoFields(after)
+	if before != nil && after != nil {
+		for key, value := range b {
+			if bytes.Equal(value, a[key]) {
+				delete(b, key)
+				delete(a, key)
+			}
+		}
+		if len(a) == 0 {
+			return event, false
+		}
+	}
+	event.Before, event.After = marshalFields(b), marshalFields(a)
+	return event, true
+}
+
+// todoFields returns the JSON fields of a todo, leaving out the version and
+// update time every change bumps. It returns nil for a nil todo.
+func todoFields(todo *models.Todo) map[string]json.RawMessage {
+	if todo == nil {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	b, _ := json.Marshal(todo)
+	_ = json.Unmarshal(b, &fields)
+	delete(fields, "version")
+	delete(fields, "updated_at")
+	return fields
+}
+
+func marshalFields(fields map[string]json.RawMessage) json.RawMessage {
+	b, _ := json.Marshal(fields)
+	return b
+}
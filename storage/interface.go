@@ -2,15 +2,112 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/cmgchess/gotodo/models"
 )
 
+// PatchFunc computes the new writable fields of a todo from its current ones.
+type PatchFunc func(current models.TodoRequest) (models.TodoRequest, error)
+
+// Storage manages todos. Completing a blocked todo fails with ErrBlocked
+// unless forced. Moving a todo only changes its rank, unless ranks have grown
+// too long and are spread out again first. Deleting a todo moves it to the
+// trash unless permanent; todos in the trash are left out of every read but
+// GetTrash and can be restored until purged. Every change made to a todo
+// through Storage or TagStorage is recorded in its history, but not the
+// changes other todos undergo as a consequence, such as a parent completed
+// by roll-up. Updates, enabling, disabling, completing, reopening and
+// trashing a todo also go on an undo stack of the last UndoDepth changes of
+// the user who made them (see WithActor), which Undo and Redo walk; a change
+// whose todo was modified since fails with ErrConflict and is dropped from
+// the stack, as is one to a todo no longer shared with the user.
 type Storage interface {
-	GetTodos(ctx context.Context) ([]models.Todo, error)
+	GetTodos(ctx context.Context, query TodoQuery) (models.TodoPage, error)
+	SearchTodos(ctx context.Context, q string, limit int) ([]models.TodoSearchResult, error)
 	GetTodoByID(ctx context.Context, id int) (*models.Todo, error)
+	GetChildren(ctx context.Context, id int) ([]models.Todo, error)
+	GetTodoTree(ctx context.Context, id int) (*models.TodoTree, error)
 	AddTodo(ctx context.Context, todoRequest models.TodoRequest) (models.Todo, error)
-	ChangeEnableStatus(ctx context.Context, id int, enabled bool) (*models.Todo, error)
-	UpdateTodo(ctx context.Context, id int, todoRequest models.TodoRequest) (*models.Todo, error)
-	DeleteTodo(ctx context.Context, id int) error
+	ChangeEnableStatus(ctx context.Context, id int, enabled bool, pre Precondition) (*models.Todo, error)
+	ChangeCompleteStatus(ctx context.Context, id int, completed, force bool, pre Precondition) (*models.Todo, error)
+	UpdateTodo(ctx context.Context, id int, todoRequest models.TodoRequest, pre Precondition) (*models.Todo, error)
+	PatchTodo(ctx context.Context, id int, patch PatchFunc, pre Precondition) (*models.Todo, error)
+	DeleteTodo(ctx context.Context, id int, permanent bool, pre Precondition) error
+	GetTrash(ctx context.Context) ([]models.Todo, error)
+	RestoreTodo(ctx context.Context, id int, pre Precondition) (*models.Todo, error)
+	PurgeTrash(ctx context.Context, before time.Time) (int, error)
+	GetTodoHistory(ctx context.Context, id int, query HistoryQuery) (models.TodoEventPage, error)
+	Undo(ctx context.Context, n int) ([]models.TodoEvent, error)
+	Redo(ctx context.Context, n int) ([]models.TodoEvent, error)
+	AddDependency(ctx context.Context, id, blockerID int, pre Precondition) (*models.Todo, error)
+	RemoveDependency(ctx context.Context, id, blockerID int, pre Precondition) (*models.Todo, error)
+	MoveTodo(ctx context.Context, id int, move models.MoveRequest, pre Precondition) (*models.Todo, error)
+}
+
+// TagStorage manages tags and their assignment to todos. Attaching or
+// detaching a tag changes the todo, so it takes a Precondition and bumps the
+// todo's version like any other todo mutation.
+type TagStorage interface {
+	GetTags(ctx context.Context) ([]models.Tag, error)
+	GetTagByID(ctx context.Context, id int) (*models.Tag, error)
+	AddTag(ctx context.Context, tagRequest models.TagRequest) (models.Tag, error)
+	UpdateTag(ctx context.Context, id int, tagRequest models.TagRequest) (*models.Tag, error)
+	DeleteTag(ctx context.Context, id int) error
+	AttachTag(ctx context.Context, todoID, tagID int, pre Precondition) (*models.Todo, error)
+	DetachTag(ctx context.Context, todoID, tagID int, pre Precondition) (*models.Todo, error)
+}
+
+// ListStorage manages the lists todos are grouped in. Deleting a list
+// deletes its todos; a user's default list cannot be deleted.
+type ListStorage interface {
+	GetLists(ctx context.Context) ([]models.List, error)
+	GetListByID(ctx context.Context, id int) (*models.List, error)
+	AddList(ctx context.Context, listRequest models.ListRequest) (models.List, error)
+	UpdateList(ctx context.Context, id int, listRequest models.ListRequest) (*models.List, error)
+	DeleteList(ctx context.Context, id int) error
+}
+
+// UserStorage manages user accounts. Emails are compared case-insensitively
+// and adding a user also creates its default list.
+type UserStorage interface {
+	AddUser(ctx context.Context, email, passwordHash string) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+}
+
+// APIKeyStorage manages API keys, which are stored by the hash of their
+// secret. UseAPIKey looks a key up by that hash for whoever presents it,
+// records when it was last used, and does not find expired keys.
+type APIKeyStorage interface {
+	GetAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	AddAPIKey(ctx context.Context, key models.APIKey, hash string) (models.APIKey, error)
+	DeleteAPIKey(ctx context.Context, id int) error
+	UseAPIKey(ctx context.Context, hash string, now time.Time) (*models.APIKey, error)
+}
+
+// ShareStorage manages who a list is shared with, and in which role.
+// Sharing the same list with a user again changes their role. ListAccess and
+// TodoAccess report the access the user ctx acts for has to a list or todo,
+// whoever owns it, including todos in the trash; callers check the role and
+// then act for Access.OwnerID with WithOwner. Lists and todos the user has
+// no access to are not found. GetSharedLists returns the lists other users
+// shared with the user ctx acts for, with the role they have on each.
+type ShareStorage interface {
+	GetShares(ctx context.Context, listID int) ([]models.Share, error)
+	GetSharedLists(ctx context.Context) ([]models.List, error)
+	ShareList(ctx context.Context, listID int, email, role string) (models.Share, error)
+	UnshareList(ctx context.Context, listID, userID int) error
+	ListAccess(ctx context.Context, listID int) (models.Access, error)
+	TodoAccess(ctx context.Context, todoID int) (models.Access, error)
+}
+
+// Store is implemented by every storage backend. Apart from UserStorage and
+// UseAPIKey, its methods act for the user set with WithOwner.
+type Store interface {
+	Storage
+	TagStorage
+	ListStorage
+	UserStorage
+	APIKeyStorage
+	ShareStorage
 }
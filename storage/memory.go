@@ -0,0 +1,1727 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/cmgchess/gotodo/models"
+)
+
+type MemoryStorage struct {
+	mu         sync.RWMutex
+	todos      map[int]models.Todo
+	nextID     int
+	tags       map[int]models.Tag
+	nextTagID  int
+	lists      map[int]models.List
+	nextListID int
+	users      map[int]models.User
+	nextUserID int
+	// tagOwners maps the ID of each tag to the ID of the user owning it.
+	tagOwners map[int]int
+	// apiKeys holds every API key by the hash of its secret.
+	apiKeys      map[string]models.APIKey
+	nextAPIKeyID int
+	shares       map[shareKey]models.Share
+	// occurrences maps the ID of each recurring todo completed so far to the
+	// ID of the next occurrence that created.
+	occurrences map[int]int
+	// events holds the history of every todo in the order it was recorded,
+	// and undo the undo stack, with the undone changes on top.
+	events      []models.TodoEvent
+	nextEventID int
+	undo        []undoEntry
+	nextUndoID  int
+	// undoMu serializes the steps of undos and redos, which take mu for
+	// each change they make.
+	undoMu sync.Mutex
+}
+
+// shareKey identifies the share of a list with a user.
+type shareKey struct {
+	listID int
+	userID int
+}
+
+// undoEntry is a change on the undo stack of a MemoryStorage.
+type undoEntry struct {
+	id     int
+	event  int
+	undone bool
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		todos:        make(map[int]models.Todo),
+		nextID:       1,
+		tags:         make(map[int]models.Tag),
+		nextTagID:    1,
+		lists:        make(map[int]models.List),
+		nextListID:   1,
+		users:        make(map[int]models.User),
+		nextUserID:   1,
+		tagOwners:    make(map[int]int),
+		apiKeys:      make(map[string]models.APIKey),
+		nextAPIKeyID: 1,
+		shares:       make(map[shareKey]models.Share),
+		occurrences:  make(map[int]int),
+		nextEventID:  1,
+		nextUndoID:   1,
+	}
+}
+
+func (s *MemoryStorage) GetTodos(ctx context.Context, query TodoQuery) (models.TodoPage, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return models.TodoPage{}, err
+	}
+	query = query.normalize()
+	if !query.Sort.Valid() {
+		return models.TodoPage{}, fmt.Errorf("invalid sort %q", query.Sort)
+	}
+	after, err := decodeCursor(query)
+	if err != nil {
+		return models.TodoPage{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if list, ok := s.lists[query.ListID]; query.ListID != 0 && (!ok || list.OwnerID != ownerID) {
+		return models.TodoPage{}, listNotFound(query.ListID)
+	}
+	todos := make([]models.Todo, 0)
+	for _, todo := range s.todos {
+		if todo.OwnerID != ownerID || !matchesQuery(query, todo) {
+			continue
+		}
+		if after != nil && compareTodos(query, after.todo(), todo) >= 0 {
+			continue
+		}
+		todos = append(todos, todo)
+	}
+	sort.Slice(todos, func(i, j int) bool { return compareTodos(query, todos[i], todos[j]) < 0 })
+	if len(todos) > query.Limit+1 {
+		todos = todos[:query.Limit+1]
+	}
+	return page(query, todos), nil
+}
+
+// SearchTodos approximates the Postgres full-text search without stemming:
+// every word of q must occur in the name or description, and matches in the
+// name rank higher than matches in the description.
+func (s *MemoryStorage) SearchTodos(ctx context.Context, q string, limit int) ([]models.TodoSearchResult, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]models.TodoSearchResult, 0)
+	terms := searchWords(q)
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, todo := range s.todos {
+		if todo.DeletedAt != nil || todo.OwnerID != ownerID {
+			continue
+		}
+		name, description := searchWords(todo.Name), searchWords(todo.Description)
+		var rank float32
+		for _, term := range terms {
+			n, d := countWord(name, term), countWord(description, term)
+			if n+d == 0 {
+				rank = 0
+				break
+			}
+			rank += float32(n) + 0.4*float32(d)
+		}
+		if rank == 0 {
+			continue
+		}
+		results = append(results, models.TodoSearchResult{
+			Todo:    todo,
+			Rank:    rank,
+			Snippet: highlight(todo.Name+" "+todo.Description, terms),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].ID < results[j].ID
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (s *MemoryStorage) GetTodoByID(ctx context.Context, id int) (*models.Todo, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	todo, ok := s.liveTodo(ownerID, id)
+	if !ok {
+		return nil, notFound(id)
+	}
+	return &todo, nil
+}
+
+func (s *MemoryStorage) GetChildren(ctx context.Context, id int) ([]models.Todo, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.liveTodo(ownerID, id); !ok {
+		return nil, notFound(id)
+	}
+	return s.children(id, liveTodos), nil
+}
+
+func (s *MemoryStorage) GetTodoTree(ctx context.Context, id int) (*models.TodoTree, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	root, ok := s.liveTodo(ownerID, id)
+	if !ok {
+		return nil, notFound(id)
+	}
+	todos := []models.Todo{root}
+	for i := 0; i < len(todos); i++ {
+		todos = append(todos, s.children(todos[i].ID, liveTodos)...)
+	}
+	return buildTree(id, todos), nil
+}
+
+func (s *MemoryStorage) AddTodo(ctx context.Context, todoRequest models.TodoRequest) (models.Todo, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return models.Todo{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	listID := todoRequest.ListID
+	if todoRequest.ParentID != nil {
+		parent, ok := s.liveTodo(ownerID, *todoRequest.ParentID)
+		if !ok {
+			return models.Todo{}, parentNotFound(*todoRequest.ParentID)
+		}
+		if listID == 0 {
+			listID = parent.ListID
+		} else if listID != parent.ListID {
+			return models.Todo{}, subtaskListMismatch(*todoRequest.ParentID, listID)
+		}
+	}
+	if listID == 0 {
+		listID = s.defaultList(ownerID)
+	}
+	if list, ok := s.lists[listID]; !ok || list.OwnerID != ownerID {
+		return models.Todo{}, listNotFound(listID)
+	}
+	now := time.Now().UTC()
+	todo := models.Todo{
+		ID:           s.nextID,
+		OwnerID:      ownerID,
+		ListID:       listID,
+		ParentID:     todoRequest.ParentID,
+		Name:         todoRequest.Name,
+		Description:  todoRequest.Description,
+		Priority:     todoRequest.PriorityOrDefault(),
+		Rank:         s.nextRank(ownerID),
+		DueAt:        todoRequest.DueTime(),
+		Completed:    false,
+		Enabled:      true,
+		AutoComplete: todoRequest.AutoComplete,
+		RRule:        todoRequest.RRule,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		Version:      1,
+		Tags:         []models.Tag{},
+		BlockedBy:    []int{},
+	}
+	s.todos[todo.ID] = todo
+	s.nextID++
+	s.record(ctx, models.EventCreated, nil, &todo)
+	return todo, nil
+}
+
+func (s *MemoryStorage) ChangeEnableStatus(ctx context.Context, id int, enabled bool, pre Precondition) (*models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var state, action = "disabled", models.EventDisabled
+	if enabled {
+		state, action = "enabled", models.EventEnabled
+	}
+	todo, err := s.lockedTodo(ctx, id, pre)
+	if err != nil {
+		return nil, err
+	}
+	if todo.Enabled == enabled {
+		return nil, alreadyInState(id, state)
+	}
+	current := todo
+	todo.Enabled = enabled
+	s.save(&todo, time.Now().UTC())
+	s.record(ctx, action, &current, &todo)
+	return &todo, nil
+}
+
+func (s *MemoryStorage) ChangeCompleteStatus(ctx context.Context, id int, completed, force bool, pre Precondition) (*models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var state, action = "open", models.EventReopened
+	now := time.Now().UTC()
+	var completedAt *time.Time
+	if completed {
+		state, action = "completed", models.EventCompleted
+		completedAt = &now
+	}
+	todo, err := s.lockedTodo(ctx, id, pre)
+	if err != nil {
+		return nil, err
+	}
+	if todo.Completed == completed {
+		return nil, alreadyInState(id, state)
+	}
+	if completed && todo.Blocked && !force {
+		return nil, blocked(id)
+	}
+	current := todo
+	todo.Completed = completed
+	todo.CompletedAt = completedAt
+	s.save(&todo, now)
+	s.record(ctx, action, &current, &todo)
+	s.updateDependents(id, now)
+	if completed {
+		s.addNextOccurrence(ctx, current, now)
+		s.rollUpCompletion(todo.ParentID, now)
+	}
+	return &todo, nil
+}
+
+func (s *MemoryStorage) UpdateTodo(ctx context.Context, id int, todoRequest models.TodoRequest, pre Precondition) (*models.Todo, error) {
+	return s.PatchTodo(ctx, id, func(models.TodoRequest) (models.TodoRequest, error) {
+		return todoRequest, nil
+	}, pre)
+}
+
+func (s *MemoryStorage) PatchTodo(ctx context.Context, id int, patch PatchFunc, pre Precondition) (*models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, err := s.lockedTodo(ctx, id, pre)
+	if err != nil {
+		return nil, err
+	}
+	todoRequest, err := patch(todo.Request())
+	if err != nil {
+		return nil, err
+	}
+	current := todo
+	listID := todoRequest.ListID
+	if listID == 0 {
+		listID = todo.ListID
+	}
+	if todoRequest.ParentID != nil {
+		if err := s.checkParent(todo.OwnerID, id, *todoRequest.ParentID); err != nil {
+			return nil, err
+		}
+		if parent := s.todos[*todoRequest.ParentID]; listID != parent.ListID {
+			if listID != todo.ListID {
+				return nil, subtaskListMismatch(parent.ID, listID)
+			}
+			listID = parent.ListID
+		}
+	}
+	now := time.Now().UTC()
+	if listID != todo.ListID {
+		if list, ok := s.lists[listID]; !ok || list.OwnerID != todo.OwnerID {
+			return nil, listNotFound(listID)
+		}
+		todo.ListID = listID
+		s.moveSubtasks(id, listID, now)
+	}
+	todo.ParentID = todoRequest.ParentID
+	todo.AutoComplete = todoRequest.AutoComplete
+	todo.RRule = todoRequest.RRule
+	todo.Name = todoRequest.Name
+	todo.Description = todoRequest.Description
+	todo.Priority = todoRequest.PriorityOrDefault()
+	todo.DueAt = todoRequest.DueTime()
+	s.save(&todo, now)
+	s.record(ctx, models.EventUpdated, &current, &todo)
+	return &todo, nil
+}
+
+func (s *MemoryStorage) AddDependency(ctx context.Context, id, blockerID int, pre Precondition) (*models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, err := s.lockedTodo(ctx, id, pre)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.liveTodo(todo.OwnerID, blockerID); !ok {
+		return nil, blockerNotFound(blockerID)
+	}
+	if s.waitsFor(blockerID, id) {
+		return nil, cyclicDependency(id, blockerID)
+	}
+	if slices.Contains(todo.BlockedBy, blockerID) {
+		return &todo, nil
+	}
+	current := todo
+	todo.BlockedBy = append(slices.Clone(todo.BlockedBy), blockerID)
+	slices.Sort(todo.BlockedBy)
+	todo.Blocked = s.isBlocked(todo.BlockedBy)
+	s.save(&todo, time.Now().UTC())
+	s.record(ctx, models.EventDependencyAdded, &current, &todo)
+	return &todo, nil
+}
+
+func (s *MemoryStorage) RemoveDependency(ctx context.Context, id, blockerID int, pre Precondition) (*models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, err := s.lockedTodo(ctx, id, pre)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(todo.BlockedBy, blockerID) {
+		return nil, dependencyNotFound(id, blockerID)
+	}
+	current := todo
+	todo.BlockedBy = slices.DeleteFunc(slices.Clone(todo.BlockedBy), func(b int) bool { return b == blockerID })
+	todo.Blocked = s.isBlocked(todo.BlockedBy)
+	s.save(&todo, time.Now().UTC())
+	s.record(ctx, models.EventDependencyRemoved, &current, &todo)
+	return &todo, nil
+}
+
+// DeleteTodo moves a todo along with its subtasks to the trash, or deletes
+// them for good if permanent is set, which also works on todos in the
+// trash. Either way their dependencies are dropped.
+func (s *MemoryStorage) DeleteTodo(ctx context.Context, id int, permanent bool, pre Precondition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filter := liveTodos
+	if permanent {
+		filter = anyTodos
+	}
+	current, err := s.lockedTodoIn(ctx, id, pre, filter)
+	if err != nil {
+		return err
+	}
+	if permanent {
+		s.deleteTodo(id)
+		s.record(ctx, models.EventDeleted, &current, nil)
+		return nil
+	}
+	s.trashTodo(id, time.Now().UTC())
+	todo := s.todos[id]
+	s.record(ctx, models.EventTrashed, &current, &todo)
+	return nil
+}
+
+// GetTrash returns the todos in the trash, most recently deleted first.
+func (s *MemoryStorage) GetTrash(ctx context.Context) ([]models.Todo, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	todos := make([]models.Todo, 0)
+	for _, todo := range s.todos {
+		if todo.DeletedAt != nil && todo.OwnerID == ownerID {
+			todos = append(todos, todo)
+		}
+	}
+	sort.Slice(todos, func(i, j int) bool {
+		if c := todos[i].DeletedAt.Compare(*todos[j].DeletedAt); c != 0 {
+			return c > 0
+		}
+		return todos[i].ID < todos[j].ID
+	})
+	return todos, nil
+}
+
+// RestoreTodo takes a todo out of the trash along with the subtasks that
+// were trashed with it. A subtask cannot be restored while its parent is in
+// the trash.
+func (s *MemoryStorage) RestoreTodo(ctx context.Context, id int, pre Precondition) (*models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, err := s.lockedTodoIn(ctx, id, pre, anyTodos)
+	if err != nil {
+		return nil, err
+	}
+	if todo.DeletedAt == nil {
+		return nil, notTrashed(id)
+	}
+	if todo.ParentID != nil && s.todos[*todo.ParentID].DeletedAt != nil {
+		return nil, parentInTrash(id, *todo.ParentID)
+	}
+	current := todo
+	s.restoreTodo(id, *todo.DeletedAt, time.Now().UTC())
+	todo = s.todos[id]
+	s.record(ctx, models.EventRestored, &current, &todo)
+	return &todo, nil
+}
+
+// PurgeTrash deletes the todos of every user that went to the trash before
+// the given time for good, along with their subtasks, and returns how many
+// todos it deleted, subtasks included.
+func (s *MemoryStorage) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []int
+	for id, todo := range s.todos {
+		if todo.DeletedAt != nil && todo.DeletedAt.Before(before) {
+			expired = append(expired, id)
+		}
+	}
+	n := len(s.todos)
+	for _, id := range expired {
+		s.deleteTodo(id)
+	}
+	return n - len(s.todos), nil
+}
+
+// GetTodoHistory returns a page of the events recorded for a todo, most
+// recent first. The history outlives the todo: it can be read while the
+// todo is in the trash and after it was deleted for good.
+func (s *MemoryStorage) GetTodoHistory(ctx context.Context, id int, query HistoryQuery) (models.TodoEventPage, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return models.TodoEventPage{}, err
+	}
+	query = query.normalize()
+	after, err := query.afterEvent()
+	if err != nil {
+		return models.TodoEventPage{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	todo, exists := s.todos[id]
+	exists = exists && todo.OwnerID == ownerID
+	events := make([]models.TodoEvent, 0)
+	for i := len(s.events) - 1; i >= 0; i-- {
+		event := s.events[i]
+		if event.TodoID != id || event.OwnerID != ownerID {
+			continue
+		}
+		exists = true
+		if (after == 0 || event.ID < after) && len(events) <= query.Limit {
+			events = append(events, event)
+		}
+	}
+	if !exists {
+		return models.TodoEventPage{}, notFound(id)
+	}
+	return eventPage(query, events), nil
+}
+
+// MoveTodo gives the todo a rank between the todos it is moved next to,
+// spreading all ranks out first if there is no room left between them.
+func (s *MemoryStorage) MoveTodo(ctx context.Context, id int, move models.MoveRequest, pre Precondition) (*models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.lockedTodo(ctx, id, pre)
+	if err != nil {
+		return nil, err
+	}
+	lower, upper, err := s.moveBounds(current.OwnerID, id, move)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	rank, ok := placeRank(lower, upper)
+	if !ok {
+		s.rebalanceRanks(current.OwnerID)
+		lower, upper, _ = s.moveBounds(current.OwnerID, id, move)
+		rank, _ = placeRank(lower, upper)
+	}
+	todo := s.todos[id]
+	todo.Rank = rank
+	s.save(&todo, now)
+	s.record(ctx, models.EventMoved, &current, &todo)
+	return &todo, nil
+}
+
+// moveBounds returns the ranks of the todos of the user ownerID right before
+// and after the place the todo id is moved to, empty at either end of the
+// order. Given both Before and After, the todo goes right after After, which
+// must come before Before; given neither, it goes last. The caller must hold
+// s.mu.
+func (s *MemoryStorage) moveBounds(ownerID, id int, move models.MoveRequest) (lower, upper string, err error) {
+	order := make([]models.Todo, 0, len(s.todos))
+	for _, todo := range s.todos {
+		if todo.ID != id && todo.DeletedAt == nil && todo.OwnerID == ownerID {
+			order = append(order, todo)
+		}
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return compareTodos(TodoQuery{Sort: SortRank}, order[i], order[j]) < 0
+	})
+	indexOf := func(target int) (int, error) {
+		if target == id {
+			return 0, movedNextToItself(id)
+		}
+		i := slices.IndexFunc(order, func(todo models.Todo) bool { return todo.ID == target })
+		if i < 0 {
+			return 0, moveTargetNotFound(target)
+		}
+		return i, nil
+	}
+
+	lo, hi := len(order)-1, len(order)
+	if move.After != nil {
+		if lo, err = indexOf(*move.After); err != nil {
+			return "", "", err
+		}
+		hi = lo + 1
+	}
+	if move.Before != nil {
+		before, err := indexOf(*move.Before)
+		if err != nil {
+			return "", "", err
+		}
+		if move.After == nil {
+			lo, hi = before-1, before
+		} else if before <= lo {
+			return "", "", moveOutOfOrder(*move.After, *move.Before)
+		}
+	}
+	if lo >= 0 {
+		lower = order[lo].Rank
+	}
+	if hi < len(order) {
+		upper = order[hi].Rank
+	}
+	return lower, upper, nil
+}
+
+// rebalanceRanks spreads the ranks of all todos of the user ownerID out
+// evenly, keeping their order. Todos whose rank changes get a new version
+// but keep their UpdatedAt, as nobody edited them. The caller must hold s.mu.
+func (s *MemoryStorage) rebalanceRanks(ownerID int) {
+	order := make([]models.Todo, 0, len(s.todos))
+	for _, todo := range s.todos {
+		if todo.OwnerID == ownerID {
+			order = append(order, todo)
+		}
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return compareTodos(TodoQuery{Sort: SortRank}, order[i], order[j]) < 0
+	})
+	for i, rank := range spreadRanks(len(order)) {
+		todo := order[i]
+		if todo.Rank != rank {
+			todo.Rank = rank
+			todo.Version++
+			s.todos[todo.ID] = todo
+		}
+	}
+}
+
+// nextRank returns the rank that places a new todo after all others of the
+// user ownerID, spreading all ranks out first if it would be longer than
+// maxRankLength. The caller must hold s.mu.
+func (s *MemoryStorage) nextRank(ownerID int) string {
+	rank, ok := placeRank(s.lastRank(ownerID), "")
+	if !ok {
+		s.rebalanceRanks(ownerID)
+		rank, _ = placeRank(s.lastRank(ownerID), "")
+	}
+	return rank
+}
+
+// lastRank returns the highest rank of any todo of the user ownerID, or ""
+// if there are none. The caller must hold s.mu.
+func (s *MemoryStorage) lastRank(ownerID int) string {
+	var last string
+	for _, todo := range s.todos {
+		if todo.OwnerID == ownerID {
+			last = max(last, todo.Rank)
+		}
+	}
+	return last
+}
+
+// lockedTodo returns a copy of the todo for modification and checks pre
+// against its version. Todos in the trash or of another user than the one
+// ctx acts for are not found. The caller must hold s.mu.
+func (s *MemoryStorage) lockedTodo(ctx context.Context, id int, pre Precondition) (models.Todo, error) {
+	return s.lockedTodoIn(ctx, id, pre, liveTodos)
+}
+
+// lockedTodoIn is lockedTodo for the todos passing filter. The caller must
+// hold s.mu.
+func (s *MemoryStorage) lockedTodoIn(ctx context.Context, id int, pre Precondition, filter trashFilter) (models.Todo, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	todo, ok := s.todos[id]
+	if !ok || todo.OwnerID != ownerID || !filter.matches(todo.DeletedAt) {
+		return todo, notFound(id)
+	}
+	if !pre.Matches(todo.Version) {
+		return todo, preconditionFailed(id, todo.Version)
+	}
+	return todo, nil
+}
+
+// liveTodo returns the todo unless it is missing, in the trash or not owned
+// by the user ownerID. The caller must hold s.mu.
+func (s *MemoryStorage) liveTodo(ownerID, id int) (models.Todo, bool) {
+	todo, ok := s.todos[id]
+	if !ok || todo.DeletedAt != nil || todo.OwnerID != ownerID {
+		return models.Todo{}, false
+	}
+	return todo, true
+}
+
+// children returns the direct subtasks of a todo passing filter in creation
+// order. The caller must hold s.mu.
+func (s *MemoryStorage) children(id int, filter trashFilter) []models.Todo {
+	children := make([]models.Todo, 0)
+	for _, todo := range s.todos {
+		if todo.ParentID != nil && *todo.ParentID == id && filter.matches(todo.DeletedAt) {
+			children = append(children, todo)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return compareTodos(TodoQuery{Sort: SortCreatedAt}, children[i], children[j]) < 0
+	})
+	return children
+}
+
+// moveSubtasks moves the subtasks of the todo id to the list listID,
+// recursively. The caller must hold s.mu.
+func (s *MemoryStorage) moveSubtasks(id, listID int, now time.Time) {
+	for _, child := range s.children(id, anyTodos) {
+		child.ListID = listID
+		s.save(&child, now)
+		s.moveSubtasks(child.ID, listID, now)
+	}
+}
+
+// checkParent makes sure parentID exists, belongs to the user ownerID and is
+// not the todo id itself or one of its subtasks. The caller must hold s.mu.
+func (s *MemoryStorage) checkParent(ownerID, id, parentID int) error {
+	if _, ok := s.liveTodo(ownerID, parentID); !ok {
+		return parentNotFound(parentID)
+	}
+	for ancestor := &parentID; ancestor != nil; ancestor = s.todos[*ancestor].ParentID {
+		if *ancestor == id {
+			return cyclicParent(id, parentID)
+		}
+	}
+	return nil
+}
+
+// addNextOccurrence adds the occurrence following a recurring todo just
+// completed, with the same fields and tags and the rule carried on, and
+// records its creation. It does nothing if the todo does not recur or was
+// completed before and already has its next occurrence. The caller must
+// hold s.mu.
+func (s *MemoryStorage) addNextOccurrence(ctx context.Context, todo models.Todo, now time.Time) {
+	dueAt, rule, ok := todo.NextOccurrence(now)
+	if !ok {
+		return
+	}
+	if id, ok := s.occurrences[todo.ID]; ok {
+		if _, exists := s.todos[id]; exists {
+			return
+		}
+	}
+	next := models.Todo{
+		ID:           s.nextID,
+		OwnerID:      todo.OwnerID,
+		ListID:       todo.ListID,
+		ParentID:     todo.ParentID,
+		Name:         todo.Name,
+		Description:  todo.Description,
+		Priority:     todo.Priority,
+		Rank:         s.nextRank(todo.OwnerID),
+		DueAt:        &dueAt,
+		Completed:    false,
+		Enabled:      true,
+		AutoComplete: todo.AutoComplete,
+		RRule:        rule,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		Version:      1,
+		Tags:         slices.Clone(todo.Tags),
+		BlockedBy:    []int{},
+	}
+	s.todos[next.ID] = next
+	s.occurrences[todo.ID] = next.ID
+	s.nextID++
+	s.record(ctx, models.EventCreated, nil, &next)
+}
+
+// rollUpCompletion completes the parent of a todo just completed if it has
+// AutoComplete set, is not blocked and has no open subtasks left, and so on
+// upwards. The caller must hold s.mu.
+func (s *MemoryStorage) rollUpCompletion(parentID *int, now time.Time) {
+	for parentID != nil {
+		parent := s.todos[*parentID]
+		if !parent.AutoComplete || parent.Completed || parent.Blocked {
+			return
+		}
+		for _, child := range s.children(parent.ID, liveTodos) {
+			if !child.Completed {
+				return
+			}
+		}
+		parent.Completed = true
+		parent.CompletedAt = &now
+		s.save(&parent, now)
+		s.updateDependents(parent.ID, now)
+		parentID = parent.ParentID
+	}
+}
+
+// deleteTodo deletes a todo along with its subtasks, including those in the
+// trash. The caller must hold s.mu.
+func (s *MemoryStorage) deleteTodo(id int) {
+	delete(s.todos, id)
+	delete(s.occurrences, id)
+	s.updateDependents(id, time.Now().UTC())
+	for _, child := range s.children(id, anyTodos) {
+		s.deleteTodo(child.ID)
+	}
+}
+
+// trashTodo moves a todo along with its subtasks not in the trash yet to
+// the trash, dropping their dependencies. The caller must hold s.mu.
+func (s *MemoryStorage) trashTodo(id int, now time.Time) {
+	todo := s.todos[id]
+	todo.DeletedAt = &now
+	todo.BlockedBy = []int{}
+	todo.Blocked = false
+	s.save(&todo, now)
+	s.updateDependents(id, now)
+	for _, child := range s.children(id, liveTodos) {
+		s.trashTodo(child.ID, now)
+	}
+}
+
+// restoreTodo takes a todo out of the trash along with its subtasks that
+// went to the trash at the same time. The caller must hold s.mu.
+func (s *MemoryStorage) restoreTodo(id int, deletedAt, now time.Time) {
+	todo := s.todos[id]
+	if todo.DeletedAt == nil || !todo.DeletedAt.Equal(deletedAt) {
+		return
+	}
+	todo.DeletedAt = nil
+	s.save(&todo, now)
+	for _, child := range s.children(id, trashedTodos) {
+		s.restoreTodo(child.ID, deletedAt, now)
+	}
+}
+
+// updateDependents recomputes the blocked flag of every todo blocked by
+// blockerID and saves it under a new version, dropping the dependency if the
+// blocker was deleted or trashed. The caller must hold s.mu.
+func (s *MemoryStorage) updateDependents(blockerID int, now time.Time) {
+	blocker, exists := s.todos[blockerID]
+	exists = exists && blocker.DeletedAt == nil
+	for _, todo := range s.todos {
+		if !slices.Contains(todo.BlockedBy, blockerID) {
+			continue
+		}
+		if !exists {
+			todo.BlockedBy = slices.DeleteFunc(slices.Clone(todo.BlockedBy), func(id int) bool { return id == blockerID })
+		}
+		todo.Blocked = s.isBlocked(todo.BlockedBy)
+		s.save(&todo, now)
+	}
+}
+
+// isBlocked reports whether any of the todos in blockedBy is open. The
+// caller must hold s.mu.
+func (s *MemoryStorage) isBlocked(blockedBy []int) bool {
+	for _, id := range blockedBy {
+		if !s.todos[id].Completed {
+			return true
+		}
+	}
+	return false
+}
+
+// waitsFor reports whether the todo id is blockerID itself or is blocking
+// it, directly or transitively. The caller must hold s.mu.
+func (s *MemoryStorage) waitsFor(blockerID, id int) bool {
+	if blockerID == id {
+		return true
+	}
+	for _, next := range s.todos[blockerID].BlockedBy {
+		if s.waitsFor(next, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// record records the change of a todo from before to after, unless it left
+// every recorded field as it was. The caller must hold s.mu.
+func (s *MemoryStorage) record(ctx context.Context, action string, before, after *models.Todo) {
+	event, ok := newEvent(action, before, after, time.Now().UTC())
+	if !ok {
+		return
+	}
+	event.ActorID = actor(ctx)
+	event.ID = s.nextEventID
+	s.nextEventID++
+	s.events = append(s.events, event)
+	if !undoable(action) || undoing(ctx) {
+		return
+	}
+	s.undo = slices.DeleteFunc(s.undo, func(e undoEntry) bool { return e.undone && s.entryActor(e) == event.ActorID })
+	s.undo = append(s.undo, undoEntry{id: s.nextUndoID, event: event.ID})
+	s.nextUndoID++
+	kept := 0
+	for i := len(s.undo) - 1; i >= 0; i-- {
+		if s.entryActor(s.undo[i]) != event.ActorID {
+			continue
+		}
+		if kept++; kept > UndoDepth {
+			s.undo = slices.Delete(s.undo, i, i+1)
+		}
+	}
+}
+
+// entryActor returns the ID of the user whose undo stack e is on. The
+// caller must hold s.mu.
+func (s *MemoryStorage) entryActor(e undoEntry) int {
+	return s.events[e.event-1].ActorID
+}
+
+// Undo reverts the last n undoable changes the actor of ctx made, most
+// recent first. See undoChanges.
+func (s *MemoryStorage) Undo(ctx context.Context, n int) ([]models.TodoEvent, error) {
+	if _, err := owner(ctx); err != nil {
+		return nil, err
+	}
+	return undoChanges(ctx, s, n, false)
+}
+
+// Redo applies the last n undone changes again, in the order they were
+// made.
+func (s *MemoryStorage) Redo(ctx context.Context, n int) ([]models.TodoEvent, error) {
+	if _, err := owner(ctx); err != nil {
+		return nil, err
+	}
+	return undoChanges(ctx, s, n, true)
+}
+
+// undoStep runs fn holding s.undoMu, which serializes the steps of every
+// user.
+func (s *MemoryStorage) undoStep(ctx context.Context, fn func(s Storage, stack undoStack) error) error {
+	s.undoMu.Lock()
+	defer s.undoMu.Unlock()
+
+	return fn(s, s)
+}
+
+func (s *MemoryStorage) nextChange(ctx context.Context, undone bool) (int, models.TodoEvent, bool, error) {
+	if _, err := owner(ctx); err != nil {
+		return 0, models.TodoEvent{}, false, err
+	}
+	actorID := actor(ctx)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stack := slices.DeleteFunc(slices.Clone(s.undo), func(e undoEntry) bool { return s.entryActor(e) != actorID })
+	i := slices.IndexFunc(stack, func(e undoEntry) bool { return e.undone })
+	if !undone {
+		if i < 0 {
+			i = len(stack)
+		}
+		i--
+	}
+	if i < 0 || i >= len(stack) {
+		return 0, models.TodoEvent{}, false, nil
+	}
+	return stack[i].id, s.events[stack[i].event-1], true, nil
+}
+
+func (s *MemoryStorage) markChange(ctx context.Context, entry int, undone bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.undo {
+		if s.undo[i].id == entry {
+			s.undo[i].undone = undone
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStorage) dropChange(ctx context.Context, entry int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.undo = slices.DeleteFunc(s.undo, func(e undoEntry) bool { return e.id == entry })
+	return nil
+}
+
+func (s *MemoryStorage) anyTodo(ctx context.Context, id int) (*models.Todo, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	todo, ok := s.todos[id]
+	if !ok || todo.OwnerID != ownerID {
+		return nil, notFound(id)
+	}
+	return &todo, nil
+}
+
+// save stores a modified todo under a new version. The caller must hold s.mu.
+func (s *MemoryStorage) save(todo *models.Todo, now time.Time) {
+	todo.UpdatedAt = now
+	todo.Version++
+	s.todos[todo.ID] = *todo
+}
+
+func (s *MemoryStorage) GetTags(ctx context.Context) ([]models.Tag, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tags := make([]models.Tag, 0)
+	for _, tag := range s.tags {
+		if s.tagOwners[tag.ID] == ownerID {
+			tags = append(tags, tag)
+		}
+	}
+	sortTags(tags)
+	return tags, nil
+}
+
+func (s *MemoryStorage) GetTagByID(ctx context.Context, id int) (*models.Tag, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tag, ok := s.ownTag(ownerID, id)
+	if !ok {
+		return nil, tagNotFound(id)
+	}
+	return &tag, nil
+}
+
+func (s *MemoryStorage) AddTag(ctx context.Context, tagRequest models.TagRequest) (models.Tag, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return models.Tag{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tagNameTaken(ownerID, tagRequest.Name, 0) {
+		return models.Tag{}, tagExists(tagRequest.Name)
+	}
+	tag := models.Tag{ID: s.nextTagID, Name: tagRequest.Name}
+	s.tags[tag.ID] = tag
+	s.tagOwners[tag.ID] = ownerID
+	s.nextTagID++
+	return tag, nil
+}
+
+func (s *MemoryStorage) UpdateTag(ctx context.Context, id int, tagRequest models.TagRequest) (*models.Tag, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tag, ok := s.ownTag(ownerID, id)
+	if !ok {
+		return nil, tagNotFound(id)
+	}
+	if s.tagNameTaken(ownerID, tagRequest.Name, id) {
+		return nil, tagExists(tagRequest.Name)
+	}
+	tag.Name = tagRequest.Name
+	s.tags[id] = tag
+	s.retagTodos(id, func(tags []models.Tag) []models.Tag {
+		tags = slices.Clone(tags)
+		for i := range tags {
+			if tags[i].ID == id {
+				tags[i] = tag
+			}
+		}
+		sortTags(tags)
+		return tags
+	})
+	return &tag, nil
+}
+
+func (s *MemoryStorage) DeleteTag(ctx context.Context, id int) error {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.ownTag(ownerID, id); !ok {
+		return tagNotFound(id)
+	}
+	delete(s.tags, id)
+	delete(s.tagOwners, id)
+	s.retagTodos(id, func(tags []models.Tag) []models.Tag {
+		return slices.DeleteFunc(slices.Clone(tags), func(tag models.Tag) bool { return tag.ID == id })
+	})
+	return nil
+}
+
+func (s *MemoryStorage) AttachTag(ctx context.Context, todoID, tagID int, pre Precondition) (*models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, err := s.lockedTodo(ctx, todoID, pre)
+	if err != nil {
+		return nil, err
+	}
+	tag, ok := s.ownTag(todo.OwnerID, tagID)
+	if !ok {
+		return nil, tagNotFound(tagID)
+	}
+	if hasTag(todo.Tags, tagID) {
+		return &todo, nil
+	}
+	current := todo
+	todo.Tags = append(slices.Clone(todo.Tags), tag)
+	sortTags(todo.Tags)
+	s.save(&todo, time.Now().UTC())
+	s.record(ctx, models.EventTagged, &current, &todo)
+	return &todo, nil
+}
+
+func (s *MemoryStorage) DetachTag(ctx context.Context, todoID, tagID int, pre Precondition) (*models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, err := s.lockedTodo(ctx, todoID, pre)
+	if err != nil {
+		return nil, err
+	}
+	if !hasTag(todo.Tags, tagID) {
+		return nil, tagNotAttached(todoID, tagID)
+	}
+	current := todo
+	todo.Tags = slices.DeleteFunc(slices.Clone(todo.Tags), func(tag models.Tag) bool { return tag.ID == tagID })
+	s.save(&todo, time.Now().UTC())
+	s.record(ctx, models.EventUntagged, &current, &todo)
+	return &todo, nil
+}
+
+// ownTag returns the tag unless it is missing or not owned by the user
+// ownerID. The caller must hold s.mu.
+func (s *MemoryStorage) ownTag(ownerID, id int) (models.Tag, bool) {
+	tag, ok := s.tags[id]
+	if !ok || s.tagOwners[id] != ownerID {
+		return models.Tag{}, false
+	}
+	return tag, true
+}
+
+// tagNameTaken reports whether a tag of the user ownerID other than id is
+// called name. The caller must hold s.mu.
+func (s *MemoryStorage) tagNameTaken(ownerID int, name string, id int) bool {
+	for _, tag := range s.tags {
+		if tag.Name == name && tag.ID != id && s.tagOwners[tag.ID] == ownerID {
+			return true
+		}
+	}
+	return false
+}
+
+// retagTodos replaces the tags of every todo carrying the tag with the
+// result of update and saves it under a new version. The caller must hold
+// s.mu.
+func (s *MemoryStorage) retagTodos(tagID int, update func([]models.Tag) []models.Tag) {
+	now := time.Now().UTC()
+	for _, todo := range s.todos {
+		if hasTag(todo.Tags, tagID) {
+			todo.Tags = update(todo.Tags)
+			s.save(&todo, now)
+		}
+	}
+}
+
+func hasTag(tags []models.Tag, id int) bool {
+	return slices.ContainsFunc(tags, func(tag models.Tag) bool { return tag.ID == id })
+}
+
+// sortTags orders tags by name, like PostgresStorage does.
+func sortTags(tags []models.Tag) {
+	slices.SortFunc(tags, func(a, b models.Tag) int { return strings.Compare(a.Name, b.Name) })
+}
+
+func (s *MemoryStorage) GetLists(ctx context.Context) ([]models.List, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lists := make([]models.List, 0)
+	for _, list := range s.lists {
+		if list.OwnerID == ownerID {
+			lists = append(lists, list)
+		}
+	}
+	slices.SortFunc(lists, func(a, b models.List) int { return a.ID - b.ID })
+	return lists, nil
+}
+
+func (s *MemoryStorage) GetListByID(ctx context.Context, id int) (*models.List, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list, ok := s.lists[id]
+	if !ok || list.OwnerID != ownerID {
+		return nil, listNotFound(id)
+	}
+	return &list, nil
+}
+
+func (s *MemoryStorage) AddList(ctx context.Context, listRequest models.ListRequest) (models.List, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return models.List{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	list := models.List{
+		ID:          s.nextListID,
+		OwnerID:     ownerID,
+		Name:        listRequest.Name,
+		Description: listRequest.Description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	s.lists[list.ID] = list
+	s.nextListID++
+	return list, nil
+}
+
+func (s *MemoryStorage) UpdateList(ctx context.Context, id int, listRequest models.ListRequest) (*models.List, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, ok := s.lists[id]
+	if !ok || list.OwnerID != ownerID {
+		return nil, listNotFound(id)
+	}
+	list.Name = listRequest.Name
+	list.Description = listRequest.Description
+	list.UpdatedAt = time.Now().UTC()
+	s.lists[id] = list
+	return &list, nil
+}
+
+func (s *MemoryStorage) DeleteList(ctx context.Context, id int) error {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, ok := s.lists[id]
+	if !ok || list.OwnerID != ownerID {
+		return listNotFound(id)
+	}
+	if list.Default {
+		return defaultListDeleted(id)
+	}
+	delete(s.lists, id)
+	for key := range s.shares {
+		if key.listID == id {
+			delete(s.shares, key)
+		}
+	}
+	for todoID, todo := range s.todos {
+		if todo.ListID == id {
+			s.deleteTodo(todoID)
+		}
+	}
+	return nil
+}
+
+// defaultList returns the ID of the default list of the user ownerID. The
+// caller must hold s.mu.
+func (s *MemoryStorage) defaultList(ownerID int) int {
+	for _, list := range s.lists {
+		if list.Default && list.OwnerID == ownerID {
+			return list.ID
+		}
+	}
+	return 0
+}
+
+// AddUser adds a user along with the default list its todos go to.
+func (s *MemoryStorage) AddUser(ctx context.Context, email, passwordHash string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email = normalizeEmail(email)
+	for _, user := range s.users {
+		if user.Email == email {
+			return models.User{}, userExists(email)
+		}
+	}
+	now := time.Now().UTC()
+	user := models.User{ID: s.nextUserID, Email: email, PasswordHash: passwordHash, CreatedAt: now}
+	s.users[user.ID] = user
+	s.nextUserID++
+	s.lists[s.nextListID] = models.List{ID: s.nextListID, OwnerID: user.ID, Name: DefaultListName, Default: true, CreatedAt: now, UpdatedAt: now}
+	s.nextListID++
+	return user, nil
+}
+
+func (s *MemoryStorage) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Email == normalizeEmail(email) {
+			return &user, nil
+		}
+	}
+	return nil, userNotFound(email)
+}
+
+func (s *MemoryStorage) GetAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]models.APIKey, 0)
+	for _, key := range s.apiKeys {
+		if key.OwnerID == ownerID {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b models.APIKey) int { return a.ID - b.ID })
+	return keys, nil
+}
+
+// AddAPIKey stores a key of the user ctx acts for under the hash of its
+// secret.
+func (s *MemoryStorage) AddAPIKey(ctx context.Context, key models.APIKey, hash string) (models.APIKey, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key.ID = s.nextAPIKeyID
+	key.OwnerID = ownerID
+	key.LastUsedAt = nil
+	key.CreatedAt = time.Now().UTC()
+	s.apiKeys[hash] = key
+	s.nextAPIKeyID++
+	return key, nil
+}
+
+// DeleteAPIKey revokes a key. It stops working right away.
+func (s *MemoryStorage) DeleteAPIKey(ctx context.Context, id int) error {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, key := range s.apiKeys {
+		if key.ID == id && key.OwnerID == ownerID {
+			delete(s.apiKeys, hash)
+			return nil
+		}
+	}
+	return apiKeyNotFound(id)
+}
+
+func (s *MemoryStorage) UseAPIKey(ctx context.Context, hash string, now time.Time) (*models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.apiKeys[hash]
+	if !ok || (key.ExpiresAt != nil && !key.ExpiresAt.After(now)) {
+		return nil, errUnknownAPIKey
+	}
+	key.LastUsedAt = &now
+	s.apiKeys[hash] = key
+	return &key, nil
+}
+
+func matchesQuery(query TodoQuery, todo models.Todo) bool {
+	if todo.DeletedAt != nil {
+		return false
+	}
+	if query.ListID != 0 && todo.ListID != query.ListID {
+		return false
+	}
+	if query.Completed != nil && todo.Completed != *query.Completed {
+		return false
+	}
+	if query.Enabled != nil && todo.Enabled != *query.Enabled {
+		return false
+	}
+	if query.CreatedAfter != nil && todo.CreatedAt.Before(*query.CreatedAfter) {
+		return false
+	}
+	if query.CreatedBefore != nil && !todo.CreatedAt.Before(*query.CreatedBefore) {
+		return false
+	}
+	if query.DueAfter != nil && (todo.DueAt == nil || todo.DueAt.Before(*query.DueAfter)) {
+		return false
+	}
+	if query.DueBefore != nil && (todo.DueAt == nil || !todo.DueAt.Before(*query.DueBefore)) {
+		return false
+	}
+	if len(query.Tags) > 0 {
+		matched := 0
+		for _, name := range query.Tags {
+			if slices.ContainsFunc(todo.Tags, func(tag models.Tag) bool { return tag.Name == name }) {
+				matched++
+			}
+		}
+		if matched == 0 || query.MatchAllTags && matched < len(query.Tags) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareTodos orders todos the same way the ORDER BY in
+// PostgresStorage.GetTodos does: by the sort column, then by id.
+func compareTodos(query TodoQuery, a, b models.Todo) int {
+	var c int
+	switch query.Sort {
+	case SortPriority:
+		c = models.PriorityRank(a.Priority) - models.PriorityRank(b.Priority)
+		if c == 0 {
+			c = compareDueDates(a.DueAt, b.DueAt)
+		}
+		if c == 0 {
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		}
+	case SortName:
+		c = strings.Compare(a.Name, b.Name)
+	case SortRank:
+		c = strings.Compare(a.Rank, b.Rank)
+	case SortUpdatedAt:
+		c = a.UpdatedAt.Compare(b.UpdatedAt)
+	default:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if c == 0 {
+		c = a.ID - b.ID
+	}
+	if query.Desc {
+		return -c
+	}
+	return c
+}
+
+// compareDueDates orders due dates ascending with missing ones last, like
+// COALESCE(due_at, 'infinity') does.
+func compareDueDates(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	default:
+		return a.Compare(*b)
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !isWordRune(r) })
+}
+
+func countWord(words []string, word string) int {
+	n := 0
+	for _, w := range words {
+		if w == word {
+			n++
+		}
+	}
+	return n
+}
+
+// highlight wraps every word of text that is one of terms in <mark> tags and
+// escapes the rest as HTML, like PostgresStorage.SearchTodos does.
+func highlight(text string, terms []string) string {
+	var b strings.Builder
+	var word []rune
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		if countWord(terms, strings.ToLower(string(word))) > 0 {
+			b.WriteString("<mark>" + string(word) + "</mark>")
+		} else {
+			b.WriteString(string(word))
+		}
+		word = word[:0]
+	}
+	for _, r := range text {
+		if isWordRune(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		b.WriteString(html.EscapeString(string(r)))
+	}
+	flush()
+	return strings.TrimSpace(b.String())
+}
+
+func (s *MemoryStorage) GetShares(ctx context.Context, listID int) ([]models.Share, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if list, ok := s.lists[listID]; !ok || list.OwnerID != ownerID {
+		return nil, listNotFound(listID)
+	}
+	shares := make([]models.Share, 0)
+	for key, share := range s.shares {
+		if key.listID == listID {
+			shares = append(shares, share)
+		}
+	}
+	slices.SortFunc(shares, func(a, b models.Share) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return a.UserID - b.UserID
+	})
+	return shares, nil
+}
+
+func (s *MemoryStorage) GetSharedLists(ctx context.Context) ([]models.List, error) {
+	userID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lists := make([]models.List, 0)
+	for key, share := range s.shares {
+		if key.userID == userID {
+			list := s.lists[key.listID]
+			list.Role = share.Role
+			lists = append(lists, list)
+		}
+	}
+	slices.SortFunc(lists, func(a, b models.List) int { return a.ID - b.ID })
+	return lists, nil
+}
+
+// ShareList shares a list of the user ctx acts for with the user with the
+// given email, or changes the role it is shared with them in.
+func (s *MemoryStorage) ShareList(ctx context.Context, listID int, email, role string) (models.Share, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return models.Share{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if list, ok := s.lists[listID]; !ok || list.OwnerID != ownerID {
+		return models.Share{}, listNotFound(listID)
+	}
+	share := models.Share{ListID: listID, Email: normalizeEmail(email), Role: role, CreatedAt: time.Now().UTC()}
+	for _, user := range s.users {
+		if user.Email == share.Email {
+			share.UserID = user.ID
+		}
+	}
+	if share.UserID == 0 {
+		return models.Share{}, userNotFound(email)
+	}
+	if share.UserID == ownerID {
+		return models.Share{}, sharedWithOwner(listID)
+	}
+	key := shareKey{listID: listID, userID: share.UserID}
+	if existing, ok := s.shares[key]; ok {
+		share.CreatedAt = existing.CreatedAt
+	}
+	s.shares[key] = share
+	return share, nil
+}
+
+// UnshareList revokes the access of the user userID to a list of the user
+// ctx acts for.
+func (s *MemoryStorage) UnshareList(ctx context.Context, listID, userID int) error {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := shareKey{listID: listID, userID: userID}
+	if _, ok := s.shares[key]; !ok || s.lists[listID].OwnerID != ownerID {
+		return shareNotFound(listID, userID)
+	}
+	delete(s.shares, key)
+	return nil
+}
+
+func (s *MemoryStorage) ListAccess(ctx context.Context, listID int) (models.Access, error) {
+	userID, err := owner(ctx)
+	if err != nil {
+		return models.Access{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list, ok := s.lists[listID]
+	if !ok {
+		return models.Access{}, listNotFound(listID)
+	}
+	access, ok := s.access(userID, list.OwnerID, listID)
+	if !ok {
+		return models.Access{}, listNotFound(listID)
+	}
+	return access, nil
+}
+
+func (s *MemoryStorage) TodoAccess(ctx context.Context, todoID int) (models.Access, error) {
+	userID, err := owner(ctx)
+	if err != nil {
+		return models.Access{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	todo, ok := s.todos[todoID]
+	if !ok {
+		return models.Access{}, notFound(todoID)
+	}
+	access, ok := s.access(userID, todo.OwnerID, todo.ListID)
+	if !ok {
+		return models.Access{}, notFound(todoID)
+	}
+	return access, nil
+}
+
+// access returns the access the user userID has to the list listID of the
+// user ownerID, and whether they have any. The caller must hold s.mu.
+func (s *MemoryStorage) access(userID, ownerID, listID int) (models.Access, bool) {
+	if userID == ownerID {
+		return models.Access{OwnerID: ownerID, Role: models.RoleOwner}, true
+	}
+	share, ok := s.shares[shareKey{listID: listID, userID: userID}]
+	if !ok {
+		return models.Access{}, false
+	}
+	return models.Access{OwnerID: ownerID, Role: share.Role}, true
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"strings"
+)
+
+type ownerContextKey struct{}
+
+// WithOwner returns a context acting for the user with the given ID. Every
+// Store method but PurgeTrash only sees and changes the todos, tags and
+// lists that user owns, and fails with ErrUnauthenticated without one.
+// ListAccess and TodoAccess also see what is shared with the user.
+func WithOwner(ctx context.Context, userID int) context.Context {
+	return context.WithValue(ctx, ownerContextKey{}, userID)
+}
+
+// OwnerFromContext returns the ID of the user ctx acts for, if any.
+func OwnerFromContext(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(ownerContextKey{}).(int)
+	return userID, ok
+}
+
+type actorContextKey struct{}
+
+// WithActor returns a context in which the user with the given ID makes the
+// changes, when it acts with WithOwner for another user who shared their
+// data with them. Changes are recorded as made by their actor, whose undo
+// stack they go on. The actor defaults to the user ctx acts for.
+func WithActor(ctx context.Context, userID int) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, userID)
+}
+
+// actor returns the ID of the user making the changes made with ctx.
+func actor(ctx context.Context) int {
+	if userID, ok := ctx.Value(actorContextKey{}).(int); ok {
+		return userID
+	}
+	userID, _ := OwnerFromContext(ctx)
+	return userID
+}
+
+// owner returns the ID of the user ctx acts for, or ErrUnauthenticated.
+func owner(ctx context.Context) (int, error) {
+	userID, ok := OwnerFromContext(ctx)
+	if !ok {
+		return 0, ErrUnauthenticated
+	}
+	return userID, nil
+}
+
+// DefaultListName is the name of the default list every user starts with.
+const DefaultListName = "Inbox"
+
+// normalizeEmail returns the form emails are stored and looked up in, which
+// makes them case-insensitive.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
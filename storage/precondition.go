@@ -0,0 +1,35 @@
+package storage
+
+import "slices"
+
+// Precondition restricts a mutation to certain versions of a todo, as
+// requested through If-Match and If-None-Match. The zero value allows any
+// version.
+type Precondition struct {
+	// IfMatch lists the allowed versions. Nil allows any version, while an
+	// empty non-nil slice allows none.
+	IfMatch []int
+	// IfNoneMatch lists the versions that are not allowed.
+	IfNoneMatch []int
+	// IfNoneMatchAny fails the precondition whenever the todo exists.
+	IfNoneMatchAny bool
+}
+
+// Matches reports whether a todo at version satisfies the precondition.
+func (p Precondition) Matches(version int) bool {
+	return p.matchesIfMatch(version) && p.matchesIfNoneMatch(version)
+}
+
+// NotModified reports whether a read of a todo at version should be
+// answered with 304 Not Modified: If-Match holds but If-None-Match does not.
+func (p Precondition) NotModified(version int) bool {
+	return p.matchesIfMatch(version) && !p.matchesIfNoneMatch(version)
+}
+
+func (p Precondition) matchesIfMatch(version int) bool {
+	return p.IfMatch == nil || slices.Contains(p.IfMatch, version)
+}
+
+func (p Precondition) matchesIfNoneMatch(version int) bool {
+	return !p.IfNoneMatchAny && !slices.Contains(p.IfNoneMatch, version)
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/cmgchess/gotodo/models"
+)
+
+const (
+	DefaultTodoLimit = 50
+	MaxTodoLimit     = 100
+)
+
+type TodoSort string
+
+const (
+	SortCreatedAt TodoSort = "created_at"
+	SortUpdatedAt TodoSort = "updated_at"
+	SortName      TodoSort = "name"
+	// SortPriority orders by priority, most urgent first, then by due date
+	// with undated todos last, then by creation time.
+	SortPriority TodoSort = "priority"
+	// SortRank orders by the manual order set by moving todos.
+	SortRank TodoSort = "rank"
+)
+
+func (s TodoSort) Valid() bool {
+	switch s {
+	case SortCreatedAt, SortUpdatedAt, SortName, SortPriority, SortRank:
+		return true
+	}
+	return false
+}
+
+// TodoQuery selects a page of todos. Zero values mean "no filter", except
+// Sort and Limit which fall back to SortPriority and DefaultTodoLimit.
+type TodoQuery struct {
+	// ListID restricts the query to one list. Zero means all lists.
+	ListID        int
+	Sort          TodoSort
+	Desc          bool
+	Limit         int
+	Cursor        string
+	Completed     *bool
+	Enabled       *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// DueAfter and DueBefore only match todos that have a due date.
+	DueAfter  *time.Time
+	DueBefore *time.Time
+	// Tags matches todos carrying any of the named tags, or all of them if
+	// MatchAllTags is set.
+	Tags         []string
+	MatchAllTags bool
+}
+
+func (q TodoQuery) normalize() TodoQuery {
+	if q.Sort == "" {
+		q.Sort = SortPriority
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultTodoLimit
+	}
+	if q.Limit > MaxTodoLimit {
+		q.Limit = MaxTodoLimit
+	}
+	if len(q.Tags) > 0 {
+		tags := make([]string, 0, len(q.Tags))
+		seen := make(map[string]bool)
+		for _, tag := range q.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+		q.Tags = tags
+	}
+	return q
+}
+
+// cursor is the position after which the next page starts. It is handed to
+// clients as an opaque base64 string and is only valid for the sort order
+// it was produced with. It keeps every field a sort order can depend on.
+type cursor struct {
+	Sort      TodoSort   `json:"s"`
+	Desc      bool       `json:"d,omitempty"`
+	ID        int        `json:"id"`
+	Name      string     `json:"n,omitempty"`
+	CreatedAt time.Time  `json:"c"`
+	UpdatedAt time.Time  `json:"u"`
+	Priority  string     `json:"p,omitempty"`
+	DueAt     *time.Time `json:"due,omitempty"`
+	Rank      string     `json:"r,omitempty"`
+}
+
+func newCursor(q TodoQuery, todo models.Todo) cursor {
+	return cursor{
+		Sort:      q.Sort,
+		Desc:      q.Desc,
+		ID:        todo.ID,
+		Name:      todo.Name,
+		CreatedAt: todo.CreatedAt,
+		UpdatedAt: todo.UpdatedAt,
+		Priority:  todo.Priority,
+		DueAt:     todo.DueAt,
+		Rank:      todo.Rank,
+	}
+}
+
+// todo returns a todo carrying the fields the cursor was built from.
+func (c cursor) todo() models.Todo {
+	return models.Todo{
+		ID:        c.ID,
+		Name:      c.Name,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+		Priority:  c.Priority,
+		DueAt:     c.DueAt,
+		Rank:      c.Rank,
+	}
+}
+
+func (c cursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(q TodoQuery) (*cursor, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.Sort != q.Sort || c.Desc != q.Desc {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// page trims a result fetched with one extra row to q.Limit and sets the
+// cursor for the next page when that extra row was present.
+func page(q TodoQuery, todos []models.Todo) models.TodoPage {
+	p := models.TodoPage{Todos: todos}
+	if len(todos) > q.Limit {
+		p.Todos = todos[:q.Limit]
+		p.NextCursor = newCursor(q, p.Todos[q.Limit-1]).encode()
+	}
+	return p
+}
@@ -0,0 +1,96 @@
+package storage
+
+import "strings"
+
+// Ranks hold the manual order of todos. They are strings of rankDigits
+// compared byte by byte, so there is always room for a rank between two
+// others and moving a todo only rewrites its own rank. Ranks never end in
+// the zero digit, which keeps room below every rank.
+const rankDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// maxRankLength is the rank length past which a move or an add spreads all
+// ranks out again before placing the todo.
+const maxRankLength = 24
+
+// rankBetween returns a rank strictly between a and b. An empty a means no
+// lower bound and an empty b no upper bound; otherwise a must be less than
+// b.
+func rankBetween(a, b string) string {
+	if b != "" {
+		n := 0
+		for n < len(b) && rankDigitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			return b[:n] + rankBetween(a[min(n, len(a)):], b[n:])
+		}
+	}
+	lo, hi := 0, len(rankDigits)
+	if a != "" {
+		lo = strings.IndexByte(rankDigits, a[0])
+	}
+	if b != "" {
+		hi = strings.IndexByte(rankDigits, b[0])
+	}
+	if hi-lo > 1 {
+		return string(rankDigits[(lo+hi)/2])
+	}
+	if len(b) > 1 {
+		return b[:1]
+	}
+	return string(rankDigits[lo]) + rankBetween(a[min(1, len(a)):], "")
+}
+
+// rankAfter returns a short rank greater than a, for appending a todo after
+// the last one. An empty a means there is no todo yet.
+func rankAfter(a string) string {
+	for i := 0; i < len(a); i++ {
+		if d := strings.IndexByte(rankDigits, a[i]); d < len(rankDigits)-1 {
+			return a[:i] + string(rankDigits[d+1])
+		}
+	}
+	return a + string(rankDigits[len(rankDigits)/2])
+}
+
+// spreadRanks returns n increasing ranks of equal length, evenly spaced so
+// that later moves have room between any two of them.
+func spreadRanks(n int) []string {
+	width, size := 1, len(rankDigits)
+	for size <= n {
+		width++
+		size *= len(rankDigits)
+	}
+	step := size / (n + 1)
+	ranks := make([]string, n)
+	for i := range ranks {
+		rank := make([]byte, width)
+		for j, v := width-1, (i+1)*step; j >= 0; j, v = j-1, v/len(rankDigits) {
+			rank[j] = rankDigits[v%len(rankDigits)]
+		}
+		ranks[i] = strings.TrimRight(string(rank), rankDigits[:1])
+	}
+	return ranks
+}
+
+// placeRank returns the rank of a todo placed between the ranks lower and
+// upper, either of which is empty at that end of the order. ok is false if
+// the two share a rank or the new one would be longer than maxRankLength,
+// in which case ranks must be spread out first.
+func placeRank(lower, upper string) (rank string, ok bool) {
+	switch {
+	case upper == "":
+		rank = rankAfter(lower)
+	case lower < upper:
+		rank = rankBetween(lower, upper)
+	default:
+		return "", false
+	}
+	return rank, len(rank) <= maxRankLength
+}
+
+func rankDigitAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return rankDigits[0]
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRankBetween(t *testing.T) {
+	tests := []struct{ a, b string }{
+		{"", ""},
+		{"", "V"},
+		{"V", ""},
+		{"A", "B"},
+		{"A", "A1"},
+		{"A1", "B"},
+		{"0V", "1"},
+		{"", "01"},
+		{"z", ""},
+		{"zz", ""},
+		{"Az", "B"},
+		{"V", "Vz"},
+	}
+	for _, tt := range tests {
+		got := rankBetween(tt.a, tt.b)
+		if got <= tt.a || tt.b != "" && got >= tt.b || strings.HasSuffix(got, "0") {
+			t.Errorf("rankBetween(%q, %q) = %q, want a rank strictly between them", tt.a, tt.b, got)
+		}
+	}
+}
+
+func TestRankBetweenRepeatedMoves(t *testing.T) {
+	lo, hi := "A", "B"
+	for i := 0; i < 200; i++ {
+		mid := rankBetween(lo, hi)
+		if mid <= lo || mid >= hi {
+			t.Fatalf("rankBetween(%q, %q) = %q, want a rank strictly between them", lo, hi, mid)
+		}
+		if i%2 == 0 {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+}
+
+func TestRankAfter(t *testing.T) {
+	for _, a := range []string{"", "V", "Az", "z", "zz", "zV1"} {
+		if got := rankAfter(a); got <= a || strings.HasSuffix(got, "0") {
+			t.Errorf("rankAfter(%q) = %q, want a greater rank", a, got)
+		}
+	}
+}
+
+func TestSpreadRanks(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 61, 62, 1000} {
+		ranks := spreadRanks(n)
+		if len(ranks) != n {
+			t.Fatalf("spreadRanks(%d) returned %d ranks", n, len(ranks))
+		}
+		for i, rank := range ranks {
+			if rank == "" || strings.HasSuffix(rank, "0") || i > 0 && rank <= ranks[i-1] {
+				t.Errorf("spreadRanks(%d)[%d] = %q, want increasing ranks without trailing zeros", n, i, rank)
+			}
+		}
+	}
+}
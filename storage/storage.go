@@ -4,15 +4,69 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/cmgchess/gotodo/models"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// todoTags selects the tags of the todo in the current row as a JSON array.
+const todoTags = "COALESCE((SELECT json_agg(json_build_object('id', tags.id, 'name', tags.name) ORDER BY tags.name) FROM todo_tags JOIN tags ON tags.id = todo_tags.tag_id WHERE todo_tags.todo_id = todos.id), '[]')"
+
+// todoBlockedBy selects the ids of the todos blocking the todo in the
+// current row, and todoBlocked whether any of them is still open.
+const (
+	todoBlockedBy = "COALESCE((SELECT array_agg(blocked_by_id ORDER BY blocked_by_id) FROM todo_dependencies WHERE todo_dependencies.todo_id = todos.id), '{}')"
+	todoBlocked   = "EXISTS (SELECT 1 FROM todo_dependencies JOIN todos blockers ON blockers.id = todo_dependencies.blocked_by_id WHERE todo_dependencies.todo_id = todos.id AND blockers.completed IS NOT TRUE)"
+)
+
+const todoColumns = "id, owner_id, list_id, parent_id, name, description, priority, rank, completed, completed_at, due_at, enabled, auto_complete, rrule, created_at, updated_at, deleted_at, version, " + todoTags + ", " + todoBlockedBy + ", " + todoBlocked
+
+// todoSubtree selects the ids of the todo $1 and all of its subtasks,
+// whether in the trash or not.
+const todoSubtree = "WITH RECURSIVE subtree AS (SELECT id FROM todos WHERE id = $1 UNION ALL SELECT todos.id FROM todos JOIN subtree ON todos.parent_id = subtree.id) SELECT id FROM subtree"
+
+const tagColumns = "id, name"
+
+const listColumns = "id, owner_id, name, description, is_default, created_at, updated_at"
+
+const apiKeyColumns = "id, owner_id, name, prefix, scope, expires_at, last_used_at, created_at"
+
+// rankLock names the advisory lock that serializes moves and adds, so that
+// two of them never give todos the same rank.
+const rankLock = "todos.rank"
+
+// undoLock names the advisory locks that, along with the ID of a user,
+// serialize the steps of their undos and redos, so that two of them never
+// revert the same change.
+const undoLock = "todo_undo_stack"
+
+// Postgres error codes for constraint violations.
+const (
+	foreignKeyViolation = "23503"
+	uniqueViolation     = "23505"
+)
+
+// querier runs single-row queries on the pool or within a transaction.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// database runs queries on the pool, or within the transaction of an undo
+// step.
+type database interface {
+	querier
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
 type PostgresStorage struct {
-	db *pgxpool.Pool
+	db database
 }
 
 func NewPostgresStorage(db *pgxpool.Pool) *PostgresStorage {
@@ -21,89 +75,1549 @@ func NewPostgresStorage(db *pgxpool.Pool) *PostgresStorage {
 	}
 }
 
-func (s *PostgresStorage) GetTodos(ctx context.Context) ([]models.Todo, error) {
-	rows, err := s.db.Query(ctx, "SELECT id, name, description, completed, enabled, created_at, updated_at FROM todos")
+// scanTodo scans a row selected with todoColumns into todo. Any extra
+// columns selected after todoColumns are scanned into extra.
+func scanTodo(row pgx.Row, todo *models.Todo, extra ...any) error {
+	dest := []any{&todo.ID, &todo.OwnerID, &todo.ListID, &todo.ParentID, &todo.Name, &todo.Description, &todo.Priority, &todo.Rank, &todo.Completed, &todo.CompletedAt, &todo.DueAt, &todo.Enabled, &todo.AutoComplete, &todo.RRule, &todo.CreatedAt, &todo.UpdatedAt, &todo.DeletedAt, &todo.Version, &todo.Tags, &todo.BlockedBy, &todo.Blocked}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// rowToTodo scans a row of todoColumns for pgx.CollectRows.
+func rowToTodo(row pgx.CollectableRow) (models.Todo, error) {
+	var todo models.Todo
+	err := scanTodo(row, &todo)
+	return todo, err
+}
+
+func (s *PostgresStorage) GetTodos(ctx context.Context, query TodoQuery) (models.TodoPage, error) {
+	query = query.normalize()
+	if !query.Sort.Valid() {
+		return models.TodoPage{}, fmt.Errorf("invalid sort %q", query.Sort)
+	}
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return models.TodoPage{}, err
+	}
+	after, err := decodeCursor(query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query todos: %v", err)
+		return models.TodoPage{}, err
 	}
-	defer rows.Close()
 
-	todos := make([]models.Todo, 0)
-	for rows.Next() {
-		var todo models.Todo
-		if err := rows.Scan(&todo.ID, &todo.Name, &todo.Description, &todo.Completed, &todo.Enabled, &todo.CreatedAt, &todo.UpdatedAt); err == nil {
-			todos = append(todos, todo)
+	conds := []string{liveTodos.sql()}
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	conds = append(conds, "owner_id = "+arg(ownerID))
+	if query.ListID != 0 {
+		if _, err := s.GetListByID(ctx, query.ListID); err != nil {
+			return models.TodoPage{}, err
 		}
+		conds = append(conds, "list_id = "+arg(query.ListID))
 	}
-	return todos, nil
+	if query.Completed != nil {
+		conds = append(conds, "completed = "+arg(*query.Completed))
+	}
+	if query.Enabled != nil {
+		conds = append(conds, "enabled = "+arg(*query.Enabled))
+	}
+	if query.CreatedAfter != nil {
+		conds = append(conds, "created_at >= "+arg(query.CreatedAfter.UTC()))
+	}
+	if query.CreatedBefore != nil {
+		conds = append(conds, "created_at < "+arg(query.CreatedBefore.UTC()))
+	}
+	if query.DueAfter != nil {
+		conds = append(conds, "due_at >= "+arg(query.DueAfter.UTC()))
+	}
+	if query.DueBefore != nil {
+		conds = append(conds, "due_at < "+arg(query.DueBefore.UTC()))
+	}
+	if len(query.Tags) > 0 {
+		tagged := "FROM todo_tags JOIN tags ON tags.id = todo_tags.tag_id WHERE todo_tags.todo_id = todos.id AND tags.name = ANY(" + arg(query.Tags) + ")"
+		if query.MatchAllTags {
+			conds = append(conds, "(SELECT count(*) "+tagged+") = "+arg(len(query.Tags)))
+		} else {
+			conds = append(conds, "EXISTS (SELECT 1 "+tagged+")")
+		}
+	}
+
+	keys := sortKeys(query.Sort)
+	order, cmp := "ASC", ">"
+	if query.Desc {
+		order, cmp = "DESC", "<"
+	}
+	if after != nil {
+		var params []string
+		for _, v := range sortValues(query.Sort, after.todo()) {
+			params = append(params, arg(v))
+		}
+		conds = append(conds, fmt.Sprintf("(%s) %s (%s)", strings.Join(keys, ", "), cmp, strings.Join(params, ", ")))
+	}
+	orderBy := make([]string, len(keys))
+	for i, key := range keys {
+		orderBy[i] = key + " " + order
+	}
+
+	sql := "SELECT " + todoColumns + " FROM todos WHERE " + strings.Join(conds, " AND ")
+	sql += fmt.Sprintf(" ORDER BY %s LIMIT %s", strings.Join(orderBy, ", "), arg(query.Limit+1))
+
+	rows, err := s.db.Query(ctx, sql, args...)
+	if err != nil {
+		return models.TodoPage{}, fmt.Errorf("failed to query todos: %w", err)
+	}
+	todos, err := pgx.CollectRows(rows, rowToTodo)
+	if err != nil {
+		return models.TodoPage{}, fmt.Errorf("failed to query todos: %w", err)
+	}
+	return page(query, todos), nil
+}
+
+// priorityRank orders priorities from most to least urgent, matching
+// models.PriorityRank.
+const priorityRank = "CASE priority WHEN 'urgent' THEN 0 WHEN 'high' THEN 1 WHEN 'medium' THEN 2 WHEN 'low' THEN 3 ELSE 4 END"
+
+// sortKeys returns the expressions todos are ordered by for sort. The last
+// key is always id, so the order is total and usable for keyset pagination.
+func sortKeys(sort TodoSort) []string {
+	switch sort {
+	case SortPriority:
+		return []string{priorityRank, "COALESCE(due_at, 'infinity')", "created_at", "id"}
+	default:
+		return []string{string(sort), "id"}
+	}
+}
+
+// sortValues returns the values of the sortKeys expressions for todo.
+func sortValues(sort TodoSort, todo models.Todo) []any {
+	switch sort {
+	case SortPriority:
+		dueAt := pgtype.Timestamp{InfinityModifier: pgtype.Infinity, Valid: true}
+		if todo.DueAt != nil {
+			dueAt = pgtype.Timestamp{Time: *todo.DueAt, Valid: true}
+		}
+		return []any{models.PriorityRank(todo.Priority), dueAt, todo.CreatedAt, todo.ID}
+	case SortName:
+		return []any{todo.Name, todo.ID}
+	case SortRank:
+		return []any{todo.Rank, todo.ID}
+	case SortUpdatedAt:
+		return []any{todo.UpdatedAt, todo.ID}
+	default:
+		return []any{todo.CreatedAt, todo.ID}
+	}
+}
+
+// escapeHTML returns SQL escaping the text expr evaluates to like
+// html.EscapeString, so that ts_headline only adds markup to it.
+func escapeHTML(expr string) string {
+	for _, r := range [][2]string{{"&", "&amp;"}, {"<", "&lt;"}, {">", "&gt;"}, {`"`, "&#34;"}, {"'", "&#39;"}} {
+		expr = fmt.Sprintf("replace(%s, '%s', '%s')", expr, strings.ReplaceAll(r[0], "'", "''"), r[1])
+	}
+	return expr
+}
+
+func (s *PostgresStorage) SearchTodos(ctx context.Context, q string, limit int) ([]models.TodoSearchResult, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx, "SELECT "+todoColumns+", ts_rank(search, query) AS search_rank, ts_headline('english', "+escapeHTML("name || ' ' || coalesce(description, '')")+", query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2') FROM todos, websearch_to_tsquery('english', $1) query WHERE search @@ query AND deleted_at IS NULL AND owner_id = $3 ORDER BY search_rank DESC, id LIMIT $2", q, limit, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search todos: %w", err)
+	}
+	results, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.TodoSearchResult, error) {
+		var result models.TodoSearchResult
+		err := scanTodo(row, &result.Todo, &result.Rank, &result.Snippet)
+		return result, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search todos: %w", err)
+	}
+	return results, nil
 }
 
 func (s *PostgresStorage) GetTodoByID(ctx context.Context, id int) (*models.Todo, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
 	var todo models.Todo
-	err := s.db.QueryRow(ctx, "SELECT id, name, description, completed, enabled, created_at, updated_at FROM todos WHERE id = $1", id).Scan(&todo.ID, &todo.Name, &todo.Description, &todo.Completed, &todo.Enabled, &todo.CreatedAt, &todo.UpdatedAt)
+	err = scanTodo(s.db.QueryRow(ctx, "SELECT "+todoColumns+" FROM todos WHERE id = $1 AND deleted_at IS NULL AND owner_id = $2", id, ownerID), &todo)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, fmt.Errorf("todo with id %d not found", id)
+			return nil, notFound(id)
 		}
-		return nil, fmt.Errorf("failed to query todo: %v", err)
+		return nil, fmt.Errorf("failed to query todo: %w", err)
 	}
 	return &todo, nil
 }
 
+// GetChildren returns the direct subtasks of a todo in creation order.
+func (s *PostgresStorage) GetChildren(ctx context.Context, id int) ([]models.Todo, error) {
+	if _, err := s.GetTodoByID(ctx, id); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx, "SELECT "+todoColumns+" FROM todos WHERE parent_id = $1 AND deleted_at IS NULL ORDER BY created_at, id", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subtasks: %w", err)
+	}
+	todos, err := pgx.CollectRows(rows, rowToTodo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subtasks: %w", err)
+	}
+	return todos, nil
+}
+
+// GetTodoTree returns a todo with all of its subtasks, recursively.
+func (s *PostgresStorage) GetTodoTree(ctx context.Context, id int) (*models.TodoTree, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx, "WITH RECURSIVE tree AS (SELECT * FROM todos WHERE id = $1 AND deleted_at IS NULL AND owner_id = $2 UNION ALL SELECT todos.* FROM todos JOIN tree ON todos.parent_id = tree.id WHERE todos.deleted_at IS NULL) SELECT "+todoColumns+" FROM tree todos ORDER BY created_at, id", id, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query todo tree: %w", err)
+	}
+	todos, err := pgx.CollectRows(rows, rowToTodo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query todo tree: %w", err)
+	}
+	tree := buildTree(id, todos)
+	if tree == nil {
+		return nil, notFound(id)
+	}
+	return tree, nil
+}
+
 func (s *PostgresStorage) AddTodo(ctx context.Context, todoRequest models.TodoRequest) (models.Todo, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return models.Todo{}, err
+	}
 	todo := models.Todo{
-		Name:        todoRequest.Name,
-		Description: todoRequest.Description,
-		Completed:   false,
-		Enabled:     true,
-		CreatedAt:   time.Now().UTC(),
-		UpdatedAt:   time.Now().UTC(),
+		OwnerID:      ownerID,
+		ParentID:     todoRequest.ParentID,
+		Name:         todoRequest.Name,
+		Description:  todoRequest.Description,
+		Priority:     todoRequest.PriorityOrDefault(),
+		DueAt:        todoRequest.DueTime(),
+		Completed:    false,
+		Enabled:      true,
+		AutoComplete: todoRequest.AutoComplete,
+		RRule:        todoRequest.RRule,
+		CreatedAt:    time.Now().UTC(),
+		UpdatedAt:    time.Now().UTC(),
+		Version:      1,
+		Tags:         []models.Tag{},
+		BlockedBy:    []int{},
 	}
-	var id int
-	err := s.db.QueryRow(ctx, "INSERT INTO todos (name, description, completed, enabled, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id", todo.Name, todo.Description, todo.Completed, todo.Enabled, todo.CreatedAt, todo.UpdatedAt).Scan(&id)
+	var listID *int
+	if todoRequest.ListID != 0 {
+		listID = &todoRequest.ListID
+	}
+	err = pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		if listID != nil {
+			if err := checkList(ctx, tx, ownerID, *listID); err != nil {
+				return err
+			}
+		}
+		if todoRequest.ParentID != nil {
+			var parentListID int
+			err := tx.QueryRow(ctx, "SELECT list_id FROM todos WHERE id = $1 AND deleted_at IS NULL AND owner_id = $2", *todoRequest.ParentID, ownerID).Scan(&parentListID)
+			if err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					return parentNotFound(*todoRequest.ParentID)
+				}
+				return fmt.Errorf("failed to query parent todo: %w", err)
+			}
+			if listID == nil {
+				listID = &parentListID
+			} else if *listID != parentListID {
+				return subtaskListMismatch(*todoRequest.ParentID, *listID)
+			}
+		}
+		rank, err := nextRank(ctx, tx, ownerID)
+		if err != nil {
+			return err
+		}
+		todo.Rank = rank
+		err = tx.QueryRow(ctx, "INSERT INTO todos (owner_id, list_id, parent_id, name, description, priority, rank, due_at, completed, enabled, auto_complete, rrule, created_at, updated_at, version) VALUES ($15, COALESCE($1, (SELECT id FROM lists WHERE is_default AND owner_id = $15)), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) RETURNING id, list_id", listID, todo.ParentID, todo.Name, todo.Description, todo.Priority, todo.Rank, todo.DueAt, todo.Completed, todo.Enabled, todo.AutoComplete, todo.RRule, todo.CreatedAt, todo.UpdatedAt, todo.Version, ownerID).Scan(&todo.ID, &todo.ListID)
+		if err != nil {
+			if isForeignKeyViolation(err) {
+				return listNotFound(todoRequest.ListID)
+			}
+			return fmt.Errorf("failed to insert todo: %w", err)
+		}
+		return recordEvent(ctx, tx, models.EventCreated, nil, &todo)
+	})
 	if err != nil {
-		return models.Todo{}, fmt.Errorf("failed to insert todo: %v", err)
+		return models.Todo{}, err
 	}
-	todo.ID = id
 	return todo, nil
 }
 
-func (s *PostgresStorage) ChangeEnableStatus(ctx context.Context, id int, enabled bool) (*models.Todo, error) {
+func (s *PostgresStorage) ChangeEnableStatus(ctx context.Context, id int, enabled bool, pre Precondition) (*models.Todo, error) {
 	var todo models.Todo
-	var status = "enabled"
+	var state, action = "disabled", models.EventDisabled
 	if enabled {
-		status = "disabled"
+		state, action = "enabled", models.EventEnabled
+	}
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		current, err := lockTodo(ctx, tx, id, pre)
+		if err != nil {
+			return err
+		}
+		if current.Enabled == enabled {
+			return alreadyInState(id, state)
+		}
+		err = scanTodo(tx.QueryRow(ctx, "UPDATE todos SET enabled = $1, updated_at = $2, version = version + 1 WHERE id = $3 RETURNING "+todoColumns, enabled, time.Now().UTC(), id), &todo)
+		if err != nil {
+			return fmt.Errorf("failed to change todo enable status: %w", err)
+		}
+		return recordEvent(ctx, tx, action, current, &todo)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+func (s *PostgresStorage) ChangeCompleteStatus(ctx context.Context, id int, completed, force bool, pre Precondition) (*models.Todo, error) {
+	var todo models.Todo
+	var state, action = "open", models.EventReopened
+	now := time.Now().UTC()
+	var completedAt *time.Time
+	if completed {
+		state, action = "completed", models.EventCompleted
+		completedAt = &now
+	}
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		if completed {
+			// Completing a recurring todo adds its next occurrence, which
+			// takes the rank lock before the todo is locked.
+			if err := lockRanks(ctx, tx); err != nil {
+				return err
+			}
+		}
+		current, err := lockTodo(ctx, tx, id, pre)
+		if err != nil {
+			return err
+		}
+		if current.Completed == completed {
+			return alreadyInState(id, state)
+		}
+		if completed && current.Blocked && !force {
+			return blocked(id)
+		}
+		err = scanTodo(tx.QueryRow(ctx, "UPDATE todos SET completed = $1, completed_at = $2, updated_at = $3, version = version + 1 WHERE id = $4 RETURNING "+todoColumns, completed, completedAt, now, id), &todo)
+		if err != nil {
+			return fmt.Errorf("failed to change todo complete status: %w", err)
+		}
+		if err := recordEvent(ctx, tx, action, current, &todo); err != nil {
+			return err
+		}
+		if err := touchDependents(ctx, tx, "SELECT $1::int", id); err != nil {
+			return err
+		}
+		if completed {
+			if err := addNextOccurrence(ctx, tx, *current, now); err != nil {
+				return err
+			}
+			return rollUpCompletion(ctx, tx, todo.ParentID, now)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	err := s.db.QueryRow(ctx, "UPDATE todos SET enabled = $1, updated_at = $2 WHERE id = $3 AND enabled = NOT $1 RETURNING id, name, description, completed, enabled, created_at, updated_at", enabled, time.Now().UTC(), id).Scan(&todo.ID, &todo.Name, &todo.Description, &todo.Completed, &todo.Enabled, &todo.CreatedAt, &todo.UpdatedAt)
+	return &todo, nil
+}
+
+func (s *PostgresStorage) UpdateTodo(ctx context.Context, id int, todoRequest models.TodoRequest, pre Precondition) (*models.Todo, error) {
+	return s.PatchTodo(ctx, id, func(models.TodoRequest) (models.TodoRequest, error) {
+		return todoRequest, nil
+	}, pre)
+}
+
+// PatchTodo locks the todo, computes its new fields with patch and writes
+// them in one transaction. Errors returned by patch are returned as is. A
+// subtask stays in the list of its parent, and moving a todo to another list
+// moves its subtasks with it.
+func (s *PostgresStorage) PatchTodo(ctx context.Context, id int, patch PatchFunc, pre Precondition) (*models.Todo, error) {
+	var todo models.Todo
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		current, err := lockTodo(ctx, tx, id, pre)
+		if err != nil {
+			return err
+		}
+		todoRequest, err := patch(current.Request())
+		if err != nil {
+			return err
+		}
+		listID := todoRequest.ListID
+		if listID == 0 {
+			listID = current.ListID
+		}
+		if todoRequest.ParentID != nil {
+			if current.ParentID == nil || *current.ParentID != *todoRequest.ParentID {
+				if err := checkParent(ctx, tx, current.OwnerID, id, *todoRequest.ParentID); err != nil {
+					return err
+				}
+			}
+			var parentListID int
+			if err := tx.QueryRow(ctx, "SELECT list_id FROM todos WHERE id = $1", *todoRequest.ParentID).Scan(&parentListID); err != nil {
+				return fmt.Errorf("failed to query parent todo: %w", err)
+			}
+			if listID != parentListID {
+				if listID != current.ListID {
+					return subtaskListMismatch(*todoRequest.ParentID, listID)
+				}
+				listID = parentListID
+			}
+		}
+		now := time.Now().UTC()
+		if listID != current.ListID {
+			if err := checkList(ctx, tx, current.OwnerID, listID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, "UPDATE todos SET list_id = $2, updated_at = $3, version = version + 1 WHERE id IN ("+todoSubtree+") AND id <> $1", id, listID, now); err != nil {
+				return fmt.Errorf("failed to move subtasks: %w", err)
+			}
+		}
+		err = scanTodo(tx.QueryRow(ctx, "UPDATE todos SET list_id = $1, parent_id = $2, name = $3, description = $4, priority = $5, due_at = $6, auto_complete = $7, rrule = $8, updated_at = $9, version = version + 1 WHERE id = $10 RETURNING "+todoColumns, listID, todoRequest.ParentID, todoRequest.Name, todoRequest.Description, todoRequest.PriorityOrDefault(), todoRequest.DueTime(), todoRequest.AutoComplete, todoRequest.RRule, now, id), &todo)
+		if err != nil {
+			if isForeignKeyViolation(err) {
+				return listNotFound(listID)
+			}
+			return fmt.Errorf("failed to update todo: %w", err)
+		}
+		return recordEvent(ctx, tx, models.EventUpdated, current, &todo)
+	})
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, fmt.Errorf("%s todo with id %d not found", status, id)
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// DeleteTodo moves a todo along with its subtasks to the trash, or deletes
+// them for good if permanent is set, which also works on todos in the
+// trash. Either way their dependencies are dropped, so todos they were
+// blocking are no longer blocked by them.
+func (s *PostgresStorage) DeleteTodo(ctx context.Context, id int, permanent bool, pre Precondition) error {
+	return pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		filter := liveTodos
+		if permanent {
+			filter = anyTodos
+		}
+		current, err := lockTodoIn(ctx, tx, id, pre, filter)
+		if err != nil {
+			return err
+		}
+		if err := touchDependents(ctx, tx, todoSubtree, id); err != nil {
+			return err
+		}
+		if permanent {
+			if _, err := tx.Exec(ctx, "DELETE FROM todos WHERE id = $1", id); err != nil {
+				return fmt.Errorf("failed to delete todo: %w", err)
+			}
+			return recordEvent(ctx, tx, models.EventDeleted, current, nil)
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM todo_dependencies WHERE todo_id IN ("+todoSubtree+") OR blocked_by_id IN ("+todoSubtree+")", id); err != nil {
+			return fmt.Errorf("failed to drop dependencies: %w", err)
+		}
+		if _, err := tx.Exec(ctx, "UPDATE todos SET deleted_at = $2, updated_at = $2, version = version + 1 WHERE id IN ("+todoSubtree+") AND deleted_at IS NULL", id, time.Now().UTC()); err != nil {
+			return fmt.Errorf("failed to trash todo: %w", err)
+		}
+		var todo models.Todo
+		if err := scanTodo(tx.QueryRow(ctx, "SELECT "+todoColumns+" FROM todos WHERE id = $1", id), &todo); err != nil {
+			return fmt.Errorf("failed to query todo: %w", err)
+		}
+		return recordEvent(ctx, tx, models.EventTrashed, current, &todo)
+	})
+}
+
+// GetTrash returns the todos in the trash, most recently deleted first.
+func (s *PostgresStorage) GetTrash(ctx context.Context) ([]models.Todo, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx, "SELECT "+todoColumns+" FROM todos WHERE deleted_at IS NOT NULL AND owner_id = $1 ORDER BY deleted_at DESC, id", ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trash: %w", err)
+	}
+	todos, err := pgx.CollectRows(rows, rowToTodo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trash: %w", err)
+	}
+	return todos, nil
+}
+
+// RestoreTodo takes a todo out of the trash along with the subtasks that
+// were trashed with it. A subtask cannot be restored while its parent is in
+// the trash.
+func (s *PostgresStorage) RestoreTodo(ctx context.Context, id int, pre Precondition) (*models.Todo, error) {
+	var todo models.Todo
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		current, err := lockTodoIn(ctx, tx, id, pre, anyTodos)
+		if err != nil {
+			return err
+		}
+		if current.DeletedAt == nil {
+			return notTrashed(id)
+		}
+		if current.ParentID != nil {
+			var parentTrashed bool
+			if err := tx.QueryRow(ctx, "SELECT deleted_at IS NOT NULL FROM todos WHERE id = $1", *current.ParentID).Scan(&parentTrashed); err != nil {
+				return fmt.Errorf("failed to query parent todo: %w", err)
+			}
+			if parentTrashed {
+				return parentInTrash(id, *current.ParentID)
+			}
+		}
+		if _, err := tx.Exec(ctx, "UPDATE todos SET deleted_at = NULL, updated_at = $2, version = version + 1 WHERE id IN ("+todoSubtree+") AND deleted_at = $3", id, time.Now().UTC(), *current.DeletedAt); err != nil {
+			return fmt.Errorf("failed to restore todo: %w", err)
+		}
+		if err := scanTodo(tx.QueryRow(ctx, "SELECT "+todoColumns+" FROM todos WHERE id = $1", id), &todo); err != nil {
+			return fmt.Errorf("failed to query todo: %w", err)
+		}
+		return recordEvent(ctx, tx, models.EventRestored, current, &todo)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// PurgeTrash deletes the todos of every user that went to the trash before
+// the given time for good, along with their subtasks, and returns how many
+// todos it deleted, subtasks included.
+func (s *PostgresStorage) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.Exec(ctx, "WITH RECURSIVE purged AS (SELECT id FROM todos WHERE deleted_at < $1 UNION SELECT todos.id FROM todos JOIN purged ON todos.parent_id = purged.id) DELETE FROM todos WHERE id IN (SELECT id FROM purged)", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge trash: %w", err)
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// MoveTodo gives the todo a rank between the todos it is moved next to,
+// spreading all ranks out first if there is no room left between them.
+func (s *PostgresStorage) MoveTodo(ctx context.Context, id int, move models.MoveRequest, pre Precondition) (*models.Todo, error) {
+	var todo models.Todo
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		if err := lockRanks(ctx, tx); err != nil {
+			return err
+		}
+		current, err := lockTodo(ctx, tx, id, pre)
+		if err != nil {
+			return err
+		}
+		lower, upper, err := moveBounds(ctx, tx, current.OwnerID, id, move)
+		if err != nil {
+			return err
 		}
-		return nil, fmt.Errorf("failed to change todo enable status: %v", err)
+		rank, ok := placeRank(lower, upper)
+		if !ok {
+			if err := rebalanceRanks(ctx, tx, current.OwnerID); err != nil {
+				return err
+			}
+			if lower, upper, err = moveBounds(ctx, tx, current.OwnerID, id, move); err != nil {
+				return err
+			}
+			rank, _ = placeRank(lower, upper)
+		}
+		err = scanTodo(tx.QueryRow(ctx, "UPDATE todos SET rank = $1, updated_at = $2, version = version + 1 WHERE id = $3 RETURNING "+todoColumns, rank, time.Now().UTC(), id), &todo)
+		if err != nil {
+			return fmt.Errorf("failed to move todo: %w", err)
+		}
+		return recordEvent(ctx, tx, models.EventMoved, current, &todo)
+	})
+	if err != nil {
+		return nil, err
 	}
 	return &todo, nil
 }
 
-func (s *PostgresStorage) UpdateTodo(ctx context.Context, id int, todoRequest models.TodoRequest) (*models.Todo, error) {
+// moveBounds returns the ranks of the todos right before and after the
+// place the todo id is moved to, empty at either end of the order. Given
+// both Before and After, the todo goes right after After, which must come
+// before Before; given neither, it goes last.
+func moveBounds(ctx context.Context, tx pgx.Tx, ownerID, id int, move models.MoveRequest) (lower, upper string, err error) {
+	targetRank := func(target int) (string, error) {
+		if target == id {
+			return "", movedNextToItself(id)
+		}
+		var rank string
+		err := tx.QueryRow(ctx, "SELECT rank FROM todos WHERE id = $1 AND deleted_at IS NULL AND owner_id = $2", target, ownerID).Scan(&rank)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return "", moveTargetNotFound(target)
+			}
+			return "", fmt.Errorf("failed to query todo to move next to: %w", err)
+		}
+		return rank, nil
+	}
+	neighborRank := func(sql string, args ...any) (string, error) {
+		var rank string
+		err := tx.QueryRow(ctx, sql, args...).Scan(&rank)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("failed to query neighboring todo: %w", err)
+		}
+		return rank, nil
+	}
+
+	switch {
+	case move.After != nil:
+		if lower, err = targetRank(*move.After); err != nil {
+			return "", "", err
+		}
+		if move.Before != nil {
+			before, err := targetRank(*move.Before)
+			if err != nil {
+				return "", "", err
+			}
+			if c := strings.Compare(before, lower); c < 0 || c == 0 && *move.Before < *move.After {
+				return "", "", moveOutOfOrder(*move.After, *move.Before)
+			}
+		}
+		upper, err = neighborRank("SELECT rank FROM todos WHERE (rank, id) > ($1, $2) AND id <> $3 AND deleted_at IS NULL AND owner_id = $4 ORDER BY rank, id LIMIT 1", lower, *move.After, id, ownerID)
+	case move.Before != nil:
+		if upper, err = targetRank(*move.Before); err != nil {
+			return "", "", err
+		}
+		lower, err = neighborRank("SELECT rank FROM todos WHERE (rank, id) < ($1, $2) AND id <> $3 AND deleted_at IS NULL AND owner_id = $4 ORDER BY rank DESC, id DESC LIMIT 1", upper, *move.Before, id, ownerID)
+	default:
+		lower, err = neighborRank("SELECT rank FROM todos WHERE id <> $1 AND deleted_at IS NULL AND owner_id = $2 ORDER BY rank DESC, id DESC LIMIT 1", id, ownerID)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return lower, upper, nil
+}
+
+// rebalanceRanks spreads the ranks of all todos of the user ownerID out
+// evenly within tx, keeping their order. Todos whose rank changes get a new
+// version but keep their updated_at, as nobody edited them.
+func rebalanceRanks(ctx context.Context, tx pgx.Tx, ownerID int) error {
+	rows, err := tx.Query(ctx, "SELECT id FROM todos WHERE owner_id = $1 ORDER BY rank, id", ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to query ranks: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return fmt.Errorf("failed to query ranks: %w", err)
+	}
+	_, err = tx.Exec(ctx, "UPDATE todos SET rank = spread.rank, version = version + 1 FROM unnest($1::int[], $2::text[]) AS spread(id, rank) WHERE todos.id = spread.id AND todos.rank <> spread.rank", ids, spreadRanks(len(ids)))
+	if err != nil {
+		return fmt.Errorf("failed to rebalance ranks: %w", err)
+	}
+	return nil
+}
+
+// lockRanks takes the rank lock until tx ends. It must be taken before any
+// todo is locked, as MoveTodo does.
+func lockRanks(ctx context.Context, tx pgx.Tx) error {
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", rankLock); err != nil {
+		return fmt.Errorf("failed to lock ranks: %w", err)
+	}
+	return nil
+}
+
+// nextRank returns the rank that places a new todo after all others of the
+// user ownerID within tx, spreading all ranks out first if it would be longer
+// than maxRankLength. It takes the rank lock.
+func nextRank(ctx context.Context, tx pgx.Tx, ownerID int) (string, error) {
+	if err := lockRanks(ctx, tx); err != nil {
+		return "", err
+	}
+	lastRank := func() (string, error) {
+		var last string
+		if err := tx.QueryRow(ctx, "SELECT COALESCE(max(rank), '') FROM todos WHERE owner_id = $1", ownerID).Scan(&last); err != nil {
+			return "", fmt.Errorf("failed to query ranks: %w", err)
+		}
+		return last, nil
+	}
+	last, err := lastRank()
+	if err != nil {
+		return "", err
+	}
+	rank, ok := placeRank(last, "")
+	if !ok {
+		if err := rebalanceRanks(ctx, tx, ownerID); err != nil {
+			return "", err
+		}
+		if last, err = lastRank(); err != nil {
+			return "", err
+		}
+		rank, _ = placeRank(last, "")
+	}
+	return rank, nil
+}
+
+// lockTodo selects the todo for update within tx and checks pre against its
+// current version. Todos in the trash or of another user than the one ctx
+// acts for are not found.
+func lockTodo(ctx context.Context, tx pgx.Tx, id int, pre Precondition) (*models.Todo, error) {
+	return lockTodoIn(ctx, tx, id, pre, liveTodos)
+}
+
+// lockTodoIn is lockTodo for the todos passing filter.
+func lockTodoIn(ctx context.Context, tx pgx.Tx, id int, pre Precondition, filter trashFilter) (*models.Todo, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
 	var todo models.Todo
-	err := s.db.QueryRow(ctx, "UPDATE todos SET name = $1, description = $2, updated_at = $3 WHERE id = $4 RETURNING id, name, description, completed, enabled, created_at, updated_at", todoRequest.Name, todoRequest.Description, time.Now().UTC(), id).Scan(&todo.ID, &todo.Name, &todo.Description, &todo.Completed, &todo.Enabled, &todo.CreatedAt, &todo.UpdatedAt)
+	err = scanTodo(tx.QueryRow(ctx, "SELECT "+todoColumns+" FROM todos WHERE id = $1 AND owner_id = $2 AND "+filter.sql()+" FOR UPDATE", id, ownerID), &todo)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, fmt.Errorf("todo with id %d not found", id)
+			return nil, notFound(id)
 		}
-		return nil, fmt.Errorf("failed to update todo: %v", err)
+		return nil, fmt.Errorf("failed to query todo: %w", err)
+	}
+	if !pre.Matches(todo.Version) {
+		return nil, preconditionFailed(id, todo.Version)
 	}
 	return &todo, nil
 }
 
-func (s *PostgresStorage) DeleteTodo(ctx context.Context, id int) error {
-	res, err := s.db.Exec(ctx, "DELETE FROM todos WHERE id = $1", id)
+// checkParent makes sure parentID exists, belongs to the user ownerID and is
+// not the todo id itself or one of its subtasks.
+func checkParent(ctx context.Context, tx pgx.Tx, ownerID, id, parentID int) error {
+	var exists, cyclic bool
+	err := tx.QueryRow(ctx, "WITH RECURSIVE ancestors AS (SELECT id, parent_id FROM todos WHERE id = $1 AND deleted_at IS NULL AND owner_id = $3 UNION ALL SELECT todos.id, todos.parent_id FROM todos JOIN ancestors ON todos.id = ancestors.parent_id) SELECT count(*) > 0, COALESCE(bool_or(id = $2), FALSE) FROM ancestors", parentID, id, ownerID).Scan(&exists, &cyclic)
+	if err != nil {
+		return fmt.Errorf("failed to query parent todo: %w", err)
+	}
+	if !exists {
+		return parentNotFound(parentID)
+	}
+	if cyclic {
+		return cyclicParent(id, parentID)
+	}
+	return nil
+}
+
+// checkList makes sure the list exists and belongs to the user ownerID.
+func checkList(ctx context.Context, q querier, ownerID, listID int) error {
+	var exists bool
+	if err := q.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM lists WHERE id = $1 AND owner_id = $2)", listID, ownerID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to query list: %w", err)
+	}
+	if !exists {
+		return listNotFound(listID)
+	}
+	return nil
+}
+
+// addNextOccurrence adds the occurrence following a recurring todo just
+// completed within tx, with the same fields and tags and the rule carried
+// on, and records its creation. It does nothing if the todo does not recur
+// or was completed before and already has its next occurrence.
+func addNextOccurrence(ctx context.Context, tx pgx.Tx, todo models.Todo, now time.Time) error {
+	dueAt, rule, ok := todo.NextOccurrence(now)
+	if !ok {
+		return nil
+	}
+	var exists bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM todos WHERE recurs_from = $1)", todo.ID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to query next occurrence: %w", err)
+	}
+	if exists {
+		return nil
+	}
+	rank, err := nextRank(ctx, tx, todo.OwnerID)
+	if err != nil {
+		return err
+	}
+	var id int
+	err = tx.QueryRow(ctx, "INSERT INTO todos (owner_id, list_id, parent_id, name, description, priority, rank, due_at, completed, enabled, auto_complete, rrule, recurs_from, created_at, updated_at, version) VALUES ($11, $1, $2, $3, $4, $5, $6, $7, FALSE, TRUE, $8, $9, $12, $10, $10, 1) RETURNING id", todo.ListID, todo.ParentID, todo.Name, todo.Description, todo.Priority, rank, dueAt, todo.AutoComplete, rule, now, todo.OwnerID, todo.ID).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("failed to insert next occurrence: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO todo_tags (todo_id, tag_id) SELECT $1, tag_id FROM todo_tags WHERE todo_id = $2", id, todo.ID); err != nil {
+		return fmt.Errorf("failed to tag next occurrence: %w", err)
+	}
+	next, err := lockTodo(ctx, tx, id, Precondition{})
 	if err != nil {
-		return fmt.Errorf("failed to delete todo: %v", err)
+		return err
 	}
-	rowsAffected := res.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("todo with id %d not found", id)
+	return recordEvent(ctx, tx, models.EventCreated, nil, next)
+}
+
+// rollUpCompletion completes the parent of a todo just completed within tx
+// if it has AutoComplete set, is not blocked and has no open subtasks left,
+// and so on upwards.
+func rollUpCompletion(ctx context.Context, tx pgx.Tx, parentID *int, now time.Time) error {
+	for parentID != nil {
+		parent, err := lockTodo(ctx, tx, *parentID, Precondition{})
+		if err != nil {
+			return err
+		}
+		if !parent.AutoComplete || parent.Completed || parent.Blocked {
+			return nil
+		}
+		var open bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM todos WHERE parent_id = $1 AND completed IS NOT TRUE AND deleted_at IS NULL)", parent.ID).Scan(&open); err != nil {
+			return fmt.Errorf("failed to query subtasks: %w", err)
+		}
+		if open {
+			return nil
+		}
+		if _, err := tx.Exec(ctx, "UPDATE todos SET completed = TRUE, completed_at = $1, updated_at = $1, version = version + 1 WHERE id = $2", now, parent.ID); err != nil {
+			return fmt.Errorf("failed to complete parent todo: %w", err)
+		}
+		if err := touchDependents(ctx, tx, "SELECT $1::int", parent.ID); err != nil {
+			return err
+		}
+		parentID = parent.ParentID
 	}
 	return nil
 }
+
+// AddDependency marks the todo id as blocked by blockerID. Adding a
+// dependency that already exists leaves the todo unchanged.
+func (s *PostgresStorage) AddDependency(ctx context.Context, id, blockerID int, pre Precondition) (*models.Todo, error) {
+	var todo models.Todo
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		current, err := lockTodo(ctx, tx, id, pre)
+		if err != nil {
+			return err
+		}
+		var exists, cyclic bool
+		err = tx.QueryRow(ctx, "WITH RECURSIVE blockers AS (SELECT $1::int AS id UNION SELECT todo_dependencies.blocked_by_id FROM todo_dependencies JOIN blockers ON todo_dependencies.todo_id = blockers.id) SELECT EXISTS (SELECT 1 FROM todos WHERE id = $1 AND deleted_at IS NULL AND owner_id = $3), EXISTS (SELECT 1 FROM blockers WHERE id = $2)", blockerID, id, current.OwnerID).Scan(&exists, &cyclic)
+		if err != nil {
+			return fmt.Errorf("failed to query blocking todo: %w", err)
+		}
+		if !exists {
+			return blockerNotFound(blockerID)
+		}
+		if cyclic {
+			return cyclicDependency(id, blockerID)
+		}
+		result, err := tx.Exec(ctx, "INSERT INTO todo_dependencies (todo_id, blocked_by_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", id, blockerID)
+		if err != nil {
+			return fmt.Errorf("failed to add dependency: %w", err)
+		}
+		if result.RowsAffected() == 0 {
+			todo = *current
+			return nil
+		}
+		if err := touchTodo(ctx, tx, id, &todo); err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, models.EventDependencyAdded, current, &todo)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+func (s *PostgresStorage) RemoveDependency(ctx context.Context, id, blockerID int, pre Precondition) (*models.Todo, error) {
+	var todo models.Todo
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		current, err := lockTodo(ctx, tx, id, pre)
+		if err != nil {
+			return err
+		}
+		result, err := tx.Exec(ctx, "DELETE FROM todo_dependencies WHERE todo_id = $1 AND blocked_by_id = $2", id, blockerID)
+		if err != nil {
+			return fmt.Errorf("failed to remove dependency: %w", err)
+		}
+		if result.RowsAffected() == 0 {
+			return dependencyNotFound(id, blockerID)
+		}
+		if err := touchTodo(ctx, tx, id, &todo); err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, models.EventDependencyRemoved, current, &todo)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// GetTodoHistory returns a page of the events recorded for a todo, most
+// recent first. The history outlives the todo: it can be read while the
+// todo is in the trash and after it was deleted for good.
+func (s *PostgresStorage) GetTodoHistory(ctx context.Context, id int, query HistoryQuery) (models.TodoEventPage, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return models.TodoEventPage{}, err
+	}
+	query = query.normalize()
+	after, err := query.afterEvent()
+	if err != nil {
+		return models.TodoEventPage{}, err
+	}
+	var exists bool
+	if err := s.db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM todos WHERE id = $1 AND owner_id = $2) OR EXISTS (SELECT 1 FROM todo_events WHERE todo_id = $1 AND owner_id = $2)", id, ownerID).Scan(&exists); err != nil {
+		return models.TodoEventPage{}, fmt.Errorf("failed to query todo: %w", err)
+	}
+	if !exists {
+		return models.TodoEventPage{}, notFound(id)
+	}
+	rows, err := s.db.Query(ctx, "SELECT id, todo_id, actor_id, action, before, after, version, created_at FROM todo_events WHERE todo_id = $1 AND owner_id = $4 AND ($2 = 0 OR id < $2) ORDER BY id DESC LIMIT $3", id, after, query.Limit+1, ownerID)
+	if err != nil {
+		return models.TodoEventPage{}, fmt.Errorf("failed to query todo history: %w", err)
+	}
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.TodoEvent, error) {
+		var event models.TodoEvent
+		err := row.Scan(&event.ID, &event.TodoID, &event.ActorID, &event.Action, &event.Before, &event.After, &event.Version, &event.CreatedAt)
+		return event, err
+	})
+	if err != nil {
+		return models.TodoEventPage{}, fmt.Errorf("failed to query todo history: %w", err)
+	}
+	return eventPage(query, events), nil
+}
+
+// recordEvent records the change of a todo from before to after within tx,
+// unless it left every recorded field as it was. Undoable changes go on the
+// undo stack of their actor.
+func recordEvent(ctx context.Context, tx pgx.Tx, action string, before, after *models.Todo) error {
+	event, ok := newEvent(action, before, after, time.Now().UTC())
+	if !ok {
+		return nil
+	}
+	event.ActorID = actor(ctx)
+	err := tx.QueryRow(ctx, "INSERT INTO todo_events (todo_id, owner_id, actor_id, action, before, after, version, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id", event.TodoID, event.OwnerID, event.ActorID, event.Action, event.Before, event.After, event.Version, event.CreatedAt).Scan(&event.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record todo event: %w", err)
+	}
+	if !undoable(action) || undoing(ctx) {
+		return nil
+	}
+	const ownStack = "event_id IN (SELECT id FROM todo_events WHERE actor_id = $1)"
+	if _, err := tx.Exec(ctx, "DELETE FROM todo_undo_stack WHERE undone AND "+ownStack, event.ActorID); err != nil {
+		return fmt.Errorf("failed to drop undone changes: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO todo_undo_stack (event_id) VALUES ($1)", event.ID); err != nil {
+		return fmt.Errorf("failed to push undo stack: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM todo_undo_stack WHERE "+ownStack+" AND id <= (SELECT id FROM todo_undo_stack WHERE "+ownStack+" ORDER BY id DESC OFFSET $2 LIMIT 1)", event.ActorID, UndoDepth); err != nil {
+		return fmt.Errorf("failed to trim undo stack: %w", err)
+	}
+	return nil
+}
+
+// Undo reverts the last n undoable changes the actor of ctx made, most
+// recent first. See undoChanges.
+func (s *PostgresStorage) Undo(ctx context.Context, n int) ([]models.TodoEvent, error) {
+	if _, err := owner(ctx); err != nil {
+		return nil, err
+	}
+	return undoChanges(ctx, s, n, false)
+}
+
+// Redo applies the last n undone changes again, in the order they were
+// made.
+func (s *PostgresStorage) Redo(ctx context.Context, n int) ([]models.TodoEvent, error) {
+	if _, err := owner(ctx); err != nil {
+		return nil, err
+	}
+	return undoChanges(ctx, s, n, true)
+}
+
+// undoStep runs fn within a transaction holding the undo lock of the actor
+// of ctx.
+func (s *PostgresStorage) undoStep(ctx context.Context, fn func(s Storage, stack undoStack) error) error {
+	if _, err := owner(ctx); err != nil {
+		return err
+	}
+	return pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1), $2)", undoLock, actor(ctx)); err != nil {
+			return fmt.Errorf("failed to lock undo stack: %w", err)
+		}
+		step := &PostgresStorage{db: tx}
+		return fn(step, step)
+	})
+}
+
+func (s *PostgresStorage) nextChange(ctx context.Context, undone bool) (int, models.TodoEvent, bool, error) {
+	if _, err := owner(ctx); err != nil {
+		return 0, models.TodoEvent{}, false, err
+	}
+	order := "DESC"
+	if undone {
+		order = "ASC"
+	}
+	var entry int
+	var event models.TodoEvent
+	err := s.db.QueryRow(ctx, "SELECT todo_undo_stack.id, todo_events.id, todo_id, owner_id, actor_id, action, before, after, version, created_at FROM todo_undo_stack JOIN todo_events ON todo_events.id = todo_undo_stack.event_id WHERE undone = $1 AND actor_id = $2 ORDER BY todo_undo_stack.id "+order+" LIMIT 1", undone, actor(ctx)).Scan(&entry, &event.ID, &event.TodoID, &event.OwnerID, &event.ActorID, &event.Action, &event.Before, &event.After, &event.Version, &event.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, event, false, nil
+		}
+		return 0, event, false, fmt.Errorf("failed to query undo stack: %w", err)
+	}
+	return entry, event, true, nil
+}
+
+func (s *PostgresStorage) markChange(ctx context.Context, entry int, undone bool) error {
+	if _, err := s.db.Exec(ctx, "UPDATE todo_undo_stack SET undone = $1 WHERE id = $2", undone, entry); err != nil {
+		return fmt.Errorf("failed to update undo stack: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStorage) dropChange(ctx context.Context, entry int) error {
+	if _, err := s.db.Exec(ctx, "DELETE FROM todo_undo_stack WHERE id = $1", entry); err != nil {
+		return fmt.Errorf("failed to update undo stack: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStorage) anyTodo(ctx context.Context, id int) (*models.Todo, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var todo models.Todo
+	if err := scanTodo(s.db.QueryRow(ctx, "SELECT "+todoColumns+" FROM todos WHERE id = $1 AND owner_id = $2", id, ownerID), &todo); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, notFound(id)
+		}
+		return nil, fmt.Errorf("failed to query todo: %w", err)
+	}
+	return &todo, nil
+}
+
+// touchDependents bumps the version of every todo blocked by one of the
+// todos selected by blockers, since their blocked flag may change.
+func touchDependents(ctx context.Context, tx pgx.Tx, blockers string, args ...any) error {
+	_, err := tx.Exec(ctx, "UPDATE todos SET updated_at = now() AT TIME ZONE 'UTC', version = version + 1 WHERE id IN (SELECT todo_id FROM todo_dependencies WHERE blocked_by_id IN ("+blockers+"))", args...)
+	if err != nil {
+		return fmt.Errorf("failed to update dependent todos: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStorage) GetTags(ctx context.Context) ([]models.Tag, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx, "SELECT "+tagColumns+" FROM tags WHERE owner_id = $1 ORDER BY name", ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+	tags, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Tag, error) {
+		var tag models.Tag
+		err := row.Scan(&tag.ID, &tag.Name)
+		return tag, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+	return tags, nil
+}
+
+func (s *PostgresStorage) GetTagByID(ctx context.Context, id int) (*models.Tag, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var tag models.Tag
+	err = s.db.QueryRow(ctx, "SELECT "+tagColumns+" FROM tags WHERE id = $1 AND owner_id = $2", id, ownerID).Scan(&tag.ID, &tag.Name)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, tagNotFound(id)
+		}
+		return nil, fmt.Errorf("failed to query tag: %w", err)
+	}
+	return &tag, nil
+}
+
+func (s *PostgresStorage) AddTag(ctx context.Context, tagRequest models.TagRequest) (models.Tag, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return models.Tag{}, err
+	}
+	tag := models.Tag{Name: tagRequest.Name}
+	err = s.db.QueryRow(ctx, "INSERT INTO tags (owner_id, name) VALUES ($1, $2) RETURNING id", ownerID, tag.Name).Scan(&tag.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.Tag{}, tagExists(tag.Name)
+		}
+		return models.Tag{}, fmt.Errorf("failed to insert tag: %w", err)
+	}
+	return tag, nil
+}
+
+// UpdateTag renames a tag. Every todo carrying it gets a new version, since
+// the tag is part of its representation.
+func (s *PostgresStorage) UpdateTag(ctx context.Context, id int, tagRequest models.TagRequest) (*models.Tag, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var tag models.Tag
+	err = pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, "UPDATE tags SET name = $1 WHERE id = $2 AND owner_id = $3 RETURNING "+tagColumns, tagRequest.Name, id, ownerID).Scan(&tag.ID, &tag.Name)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return tagNotFound(id)
+			}
+			if isUniqueViolation(err) {
+				return tagExists(tagRequest.Name)
+			}
+			return fmt.Errorf("failed to update tag: %w", err)
+		}
+		return touchTaggedTodos(ctx, tx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func (s *PostgresStorage) DeleteTag(ctx context.Context, id int) error {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return err
+	}
+	return pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		if err := touchTaggedTodos(ctx, tx, id); err != nil {
+			return err
+		}
+		result, err := tx.Exec(ctx, "DELETE FROM tags WHERE id = $1 AND owner_id = $2", id, ownerID)
+		if err != nil {
+			return fmt.Errorf("failed to delete tag: %w", err)
+		}
+		if result.RowsAffected() == 0 {
+			return tagNotFound(id)
+		}
+		return nil
+	})
+}
+
+// AttachTag adds a tag to a todo. Attaching a tag the todo already carries
+// leaves the todo unchanged.
+func (s *PostgresStorage) AttachTag(ctx context.Context, todoID, tagID int, pre Precondition) (*models.Todo, error) {
+	var todo models.Todo
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		current, err := lockTodo(ctx, tx, todoID, pre)
+		if err != nil {
+			return err
+		}
+		var exists bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM tags WHERE id = $1 AND owner_id = $2)", tagID, current.OwnerID).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to query tag: %w", err)
+		}
+		if !exists {
+			return tagNotFound(tagID)
+		}
+		result, err := tx.Exec(ctx, "INSERT INTO todo_tags (todo_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", todoID, tagID)
+		if err != nil {
+			return fmt.Errorf("failed to attach tag: %w", err)
+		}
+		if result.RowsAffected() == 0 {
+			todo = *current
+			return nil
+		}
+		if err := touchTodo(ctx, tx, todoID, &todo); err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, models.EventTagged, current, &todo)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+func (s *PostgresStorage) DetachTag(ctx context.Context, todoID, tagID int, pre Precondition) (*models.Todo, error) {
+	var todo models.Todo
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		current, err := lockTodo(ctx, tx, todoID, pre)
+		if err != nil {
+			return err
+		}
+		result, err := tx.Exec(ctx, "DELETE FROM todo_tags WHERE todo_id = $1 AND tag_id = $2", todoID, tagID)
+		if err != nil {
+			return fmt.Errorf("failed to detach tag: %w", err)
+		}
+		if result.RowsAffected() == 0 {
+			return tagNotAttached(todoID, tagID)
+		}
+		if err := touchTodo(ctx, tx, todoID, &todo); err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, models.EventUntagged, current, &todo)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// touchTodo bumps the version of a todo whose tags or dependencies changed
+// within tx and scans the result into todo.
+func touchTodo(ctx context.Context, tx pgx.Tx, id int, todo *models.Todo) error {
+	err := scanTodo(tx.QueryRow(ctx, "UPDATE todos SET updated_at = $1, version = version + 1 WHERE id = $2 RETURNING "+todoColumns, time.Now().UTC(), id), todo)
+	if err != nil {
+		return fmt.Errorf("failed to update todo: %w", err)
+	}
+	return nil
+}
+
+// touchTaggedTodos bumps the version of every todo carrying the tag.
+func touchTaggedTodos(ctx context.Context, tx pgx.Tx, tagID int) error {
+	_, err := tx.Exec(ctx, "UPDATE todos SET updated_at = $1, version = version + 1 WHERE id IN (SELECT todo_id FROM todo_tags WHERE tag_id = $2)", time.Now().UTC(), tagID)
+	if err != nil {
+		return fmt.Errorf("failed to update tagged todos: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStorage) GetLists(ctx context.Context) ([]models.List, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx, "SELECT "+listColumns+" FROM lists WHERE owner_id = $1 ORDER BY id", ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query lists: %w", err)
+	}
+	lists, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.List, error) {
+		var list models.List
+		err := scanList(row, &list)
+		return list, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query lists: %w", err)
+	}
+	return lists, nil
+}
+
+func (s *PostgresStorage) GetListByID(ctx context.Context, id int) (*models.List, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var list models.List
+	err = scanList(s.db.QueryRow(ctx, "SELECT "+listColumns+" FROM lists WHERE id = $1 AND owner_id = $2", id, ownerID), &list)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, listNotFound(id)
+		}
+		return nil, fmt.Errorf("failed to query list: %w", err)
+	}
+	return &list, nil
+}
+
+func (s *PostgresStorage) AddList(ctx context.Context, listRequest models.ListRequest) (models.List, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return models.List{}, err
+	}
+	list := models.List{
+		OwnerID:     ownerID,
+		Name:        listRequest.Name,
+		Description: listRequest.Description,
+		CreatedAt:   time.Now().UTC(),
+		UpdatedAt:   time.Now().UTC(),
+	}
+	err = s.db.QueryRow(ctx, "INSERT INTO lists (owner_id, name, description, created_at, updated_at) VALUES ($1, $2, $3, $4, $5) RETURNING id", list.OwnerID, list.Name, list.Description, list.CreatedAt, list.UpdatedAt).Scan(&list.ID)
+	if err != nil {
+		return models.List{}, fmt.Errorf("failed to insert list: %w", err)
+	}
+	return list, nil
+}
+
+func (s *PostgresStorage) UpdateList(ctx context.Context, id int, listRequest models.ListRequest) (*models.List, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var list models.List
+	err = scanList(s.db.QueryRow(ctx, "UPDATE lists SET name = $1, description = $2, updated_at = $3 WHERE id = $4 AND owner_id = $5 RETURNING "+listColumns, listRequest.Name, listRequest.Description, time.Now().UTC(), id, ownerID), &list)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, listNotFound(id)
+		}
+		return nil, fmt.Errorf("failed to update list: %w", err)
+	}
+	return &list, nil
+}
+
+func (s *PostgresStorage) DeleteList(ctx context.Context, id int) error {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return err
+	}
+	return pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		var isDefault bool
+		err := tx.QueryRow(ctx, "SELECT is_default FROM lists WHERE id = $1 AND owner_id = $2 FOR UPDATE", id, ownerID).Scan(&isDefault)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return listNotFound(id)
+			}
+			return fmt.Errorf("failed to query list: %w", err)
+		}
+		if isDefault {
+			return defaultListDeleted(id)
+		}
+		if err := touchDependents(ctx, tx, "SELECT id FROM todos WHERE list_id = $1", id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM lists WHERE id = $1", id); err != nil {
+			return fmt.Errorf("failed to delete list: %w", err)
+		}
+		return nil
+	})
+}
+
+// AddUser adds a user along with the default list its todos go to.
+func (s *PostgresStorage) AddUser(ctx context.Context, email, passwordHash string) (models.User, error) {
+	user := models.User{
+		Email:        normalizeEmail(email),
+		PasswordHash: passwordHash,
+		CreatedAt:    time.Now().UTC(),
+	}
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, "INSERT INTO users (email, password_hash, created_at) VALUES ($1, $2, $3) RETURNING id", user.Email, user.PasswordHash, user.CreatedAt).Scan(&user.ID)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return userExists(user.Email)
+			}
+			return fmt.Errorf("failed to insert user: %w", err)
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO lists (owner_id, name, description, is_default, created_at, updated_at) VALUES ($1, $2, '', TRUE, $3, $3)", user.ID, DefaultListName, user.CreatedAt); err != nil {
+			return fmt.Errorf("failed to insert list: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func (s *PostgresStorage) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	err := s.db.QueryRow(ctx, "SELECT id, email, password_hash, created_at FROM users WHERE email = $1", normalizeEmail(email)).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, userNotFound(email)
+		}
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+	return &user, nil
+}
+
+func (s *PostgresStorage) GetAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE owner_id = $1 ORDER BY id", ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	keys, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.APIKey, error) {
+		var key models.APIKey
+		err := scanAPIKey(row, &key)
+		return key, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// AddAPIKey stores a key of the user ctx acts for under the hash of its
+// secret.
+func (s *PostgresStorage) AddAPIKey(ctx context.Context, key models.APIKey, hash string) (models.APIKey, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	key.OwnerID = ownerID
+	key.LastUsedAt = nil
+	key.CreatedAt = time.Now().UTC()
+	err = s.db.QueryRow(ctx, "INSERT INTO api_keys (owner_id, name, prefix, key_hash, scope, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id", key.OwnerID, key.Name, key.Prefix, hash, key.Scope, key.ExpiresAt, key.CreatedAt).Scan(&key.ID)
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("failed to insert API key: %w", err)
+	}
+	return key, nil
+}
+
+// DeleteAPIKey revokes a key. It stops working right away.
+func (s *PostgresStorage) DeleteAPIKey(ctx context.Context, id int) error {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.Exec(ctx, "DELETE FROM api_keys WHERE id = $1 AND owner_id = $2", id, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete API key: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return apiKeyNotFound(id)
+	}
+	return nil
+}
+
+func (s *PostgresStorage) UseAPIKey(ctx context.Context, hash string, now time.Time) (*models.APIKey, error) {
+	var key models.APIKey
+	err := scanAPIKey(s.db.QueryRow(ctx, "UPDATE api_keys SET last_used_at = $2 WHERE key_hash = $1 AND (expires_at IS NULL OR expires_at > $2) RETURNING "+apiKeyColumns, hash, now), &key)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errUnknownAPIKey
+		}
+		return nil, fmt.Errorf("failed to update API key: %w", err)
+	}
+	return &key, nil
+}
+
+func (s *PostgresStorage) GetShares(ctx context.Context, listID int) ([]models.Share, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkList(ctx, s.db, ownerID, listID); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx, "SELECT s.list_id, s.user_id, u.email, s.role, s.created_at FROM list_shares s JOIN users u ON u.id = s.user_id WHERE s.list_id = $1 ORDER BY s.created_at, s.user_id", listID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shares: %w", err)
+	}
+	shares, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Share, error) {
+		var share models.Share
+		err := row.Scan(&share.ListID, &share.UserID, &share.Email, &share.Role, &share.CreatedAt)
+		return share, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shares: %w", err)
+	}
+	return shares, nil
+}
+
+func (s *PostgresStorage) GetSharedLists(ctx context.Context) ([]models.List, error) {
+	userID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx, "SELECT "+listColumns+", role FROM lists JOIN (SELECT list_id, role FROM list_shares WHERE user_id = $1) s ON s.list_id = lists.id ORDER BY id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shared lists: %w", err)
+	}
+	lists, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.List, error) {
+		var list models.List
+		err := scanList(row, &list, &list.Role)
+		return list, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shared lists: %w", err)
+	}
+	return lists, nil
+}
+
+// ShareList shares a list of the user ctx acts for with the user with the
+// given email, or changes the role it is shared with them in.
+func (s *PostgresStorage) ShareList(ctx context.Context, listID int, email, role string) (models.Share, error) {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return models.Share{}, err
+	}
+	share := models.Share{ListID: listID, Email: normalizeEmail(email), Role: role}
+	err = pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		if err := checkList(ctx, tx, ownerID, listID); err != nil {
+			return err
+		}
+		if err := tx.QueryRow(ctx, "SELECT id FROM users WHERE email = $1", share.Email).Scan(&share.UserID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return userNotFound(email)
+			}
+			return fmt.Errorf("failed to query user: %w", err)
+		}
+		if share.UserID == ownerID {
+			return sharedWithOwner(listID)
+		}
+		err := tx.QueryRow(ctx, "INSERT INTO list_shares (list_id, user_id, role, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT (list_id, user_id) DO UPDATE SET role = EXCLUDED.role RETURNING created_at", listID, share.UserID, role, time.Now().UTC()).Scan(&share.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert share: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Share{}, err
+	}
+	return share, nil
+}
+
+// UnshareList revokes the access of the user userID to a list of the user
+// ctx acts for.
+func (s *PostgresStorage) UnshareList(ctx context.Context, listID, userID int) error {
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.Exec(ctx, "DELETE FROM list_shares s USING lists l WHERE s.list_id = $1 AND s.user_id = $2 AND l.id = s.list_id AND l.owner_id = $3", listID, userID, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete share: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return shareNotFound(listID, userID)
+	}
+	return nil
+}
+
+func (s *PostgresStorage) ListAccess(ctx context.Context, listID int) (models.Access, error) {
+	userID, err := owner(ctx)
+	if err != nil {
+		return models.Access{}, err
+	}
+	var access models.Access
+	err = s.db.QueryRow(ctx, "SELECT l.owner_id, CASE WHEN l.owner_id = $2 THEN $3 ELSE s.role END FROM lists l LEFT JOIN list_shares s ON s.list_id = l.id AND s.user_id = $2 WHERE l.id = $1 AND (l.owner_id = $2 OR s.user_id IS NOT NULL)", listID, userID, models.RoleOwner).Scan(&access.OwnerID, &access.Role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Access{}, listNotFound(listID)
+		}
+		return models.Access{}, fmt.Errorf("failed to query list access: %w", err)
+	}
+	return access, nil
+}
+
+func (s *PostgresStorage) TodoAccess(ctx context.Context, todoID int) (models.Access, error) {
+	userID, err := owner(ctx)
+	if err != nil {
+		return models.Access{}, err
+	}
+	var access models.Access
+	err = s.db.QueryRow(ctx, "SELECT t.owner_id, CASE WHEN t.owner_id = $2 THEN $3 ELSE s.role END FROM todos t LEFT JOIN list_shares s ON s.list_id = t.list_id AND s.user_id = $2 WHERE t.id = $1 AND (t.owner_id = $2 OR s.user_id IS NOT NULL)", todoID, userID, models.RoleOwner).Scan(&access.OwnerID, &access.Role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Access{}, notFound(todoID)
+		}
+		return models.Access{}, fmt.Errorf("failed to query todo access: %w", err)
+	}
+	return access, nil
+}
+
+func scanAPIKey(row pgx.Row, key *models.APIKey) error {
+	return row.Scan(&key.ID, &key.OwnerID, &key.Name, &key.Prefix, &key.Scope, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt)
+}
+
+// scanList scans a row selected with listColumns into list. Any extra
+// columns selected after listColumns are scanned into extra.
+func scanList(row pgx.Row, list *models.List, extra ...any) error {
+	dest := []any{&list.ID, &list.OwnerID, &list.Name, &list.Description, &list.Default, &list.CreatedAt, &list.UpdatedAt}
+	return row.Scan(append(dest, extra...)...)
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation
+}
@@ -0,0 +1,33 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/cmgchess/gotodo/db"
+	"github.com/cmgchess/gotodo/storage"
+	"github.com/cmgchess/gotodo/storage/storagetest"
+)
+
+// TestPostgresStorage runs against the migrated database in TEST_DSN.
+// All tables are emptied between subtests, so never point it at real data.
+func TestPostgresStorage(t *testing.T) {
+	dsn := os.Getenv("TEST_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DSN not set, skipping postgres storage tests")
+	}
+
+	pool, err := db.NewPostgreSQLStorage(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		if _, err := pool.Exec(context.Background(), "TRUNCATE todos, tags, lists, list_shares, users, api_keys, todo_events, todo_undo_stack RESTART IDENTITY CASCADE"); err != nil {
+			t.Fatal(err)
+		}
+		return storage.NewPostgresStorage(pool)
+	})
+}
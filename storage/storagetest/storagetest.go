@@ -0,0 +1,2233 @@
+// Package storagetest provides a behavioral test suite that every
+// storage.Store implementation is expected to pass.
+package storagetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cmgchess/gotodo/models"
+	"github.com/cmgchess/gotodo/storage"
+)
+
+// Factory returns an empty store. It is called once per subtest, so
+// implementations backed by shared resources must reset them here.
+type Factory func(t *testing.T) storage.Store
+
+// Run executes the full suite against stores created by newStore.
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Store)
+	}{
+		{"AddTodo", testAddTodo},
+		{"GetTodos", testGetTodos},
+		{"GetTodosPagination", testGetTodosPagination},
+		{"GetTodosFilters", testGetTodosFilters},
+		{"DueDates", testDueDates},
+		{"Priorities", testPriorities},
+		{"SearchTodos", testSearchTodos},
+		{"GetTodoByID", testGetTodoByID},
+		{"UpdateTodo", testUpdateTodo},
+		{"PatchTodo", testPatchTodo},
+		{"ChangeEnableStatus", testChangeEnableStatus},
+		{"ChangeCompleteStatus", testChangeCompleteStatus},
+		{"DeleteTodo", testDeleteTodo},
+		{"Trash", testTrash},
+		{"History", testHistory},
+		{"Undo", testUndo},
+		{"ConcurrentUndo", testConcurrentUndo},
+		{"SharedUndo", testSharedUndo},
+		{"Preconditions", testPreconditions},
+		{"Tags", testTags},
+		{"TagTodos", testTagTodos},
+		{"Lists", testLists},
+		{"ListTodos", testListTodos},
+		{"Subtasks", testSubtasks},
+		{"SubtaskLists", testSubtaskLists},
+		{"SubtaskCompletion", testSubtaskCompletion},
+		{"Dependencies", testDependencies},
+		{"Recurrence", testRecurrence},
+		{"MoveTodo", testMoveTodo},
+		{"AppendRankLength", testAppendRankLength},
+		{"ConcurrentAddTodo", testConcurrentAddTodo},
+		{"Users", testUsers},
+		{"Ownership", testOwnership},
+		{"APIKeys", testAPIKeys},
+		{"Sharing", testSharing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func testAddTodo(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	first := mustAdd(ctx, t, s, "first")
+	second := mustAdd(ctx, t, s, "second")
+
+	if first.ID != 1 || second.ID != 2 {
+		t.Errorf("expected sequential ids 1 and 2, got %d and %d", first.ID, second.ID)
+	}
+	if first.Name != "first" || first.Description != "first description" {
+		t.Errorf("unexpected name or description: %+v", first)
+	}
+	if first.Completed || first.CompletedAt != nil {
+		t.Errorf("expected new todo to be open, got %+v", first)
+	}
+	if !first.Enabled {
+		t.Errorf("expected new todo to be enabled")
+	}
+	if first.CreatedAt.IsZero() || !sameTime(first.CreatedAt, first.UpdatedAt) {
+		t.Errorf("expected created_at and updated_at to be set and equal, got %v and %v", first.CreatedAt, first.UpdatedAt)
+	}
+
+	stored, err := s.GetTodoByID(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("failed to get added todo: %v", err)
+	}
+	if stored.Name != first.Name || !sameTime(stored.CreatedAt, first.CreatedAt) {
+		t.Errorf("stored todo %+v does not match added todo %+v", stored, first)
+	}
+}
+
+func testGetTodos(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	page, err := s.GetTodos(ctx, storage.TodoQuery{})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	if page.Todos == nil || len(page.Todos) != 0 || page.NextCursor != "" {
+		t.Errorf("expected empty page, got %#v", page)
+	}
+
+	mustAdd(ctx, t, s, "first")
+	mustAdd(ctx, t, s, "second")
+	mustAdd(ctx, t, s, "third")
+
+	page, err = s.GetTodos(ctx, storage.TodoQuery{})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	assertNames(t, page.Todos, "first", "second", "third")
+	if page.NextCursor != "" {
+		t.Errorf("expected no next cursor, got %q", page.NextCursor)
+	}
+}
+
+func testGetTodosPagination(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	for _, name := range []string{"c", "a", "e", "b", "d"} {
+		mustAdd(ctx, t, s, name)
+	}
+
+	query := storage.TodoQuery{Sort: storage.SortName, Desc: true, Limit: 2}
+	var names []string
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("expected pagination to stop after 3 pages")
+		}
+		page, err := s.GetTodos(ctx, query)
+		if err != nil {
+			t.Fatalf("failed to get todos: %v", err)
+		}
+		for _, todo := range page.Todos {
+			names = append(names, todo.Name)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	if strings.Join(names, ",") != "e,d,c,b,a" {
+		t.Errorf("expected e,d,c,b,a, got %s", strings.Join(names, ","))
+	}
+
+	page, err := s.GetTodos(ctx, storage.TodoQuery{Sort: storage.SortCreatedAt, Limit: 3})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	assertNames(t, page.Todos, "c", "a", "e")
+
+	if _, err := s.GetTodos(ctx, storage.TodoQuery{Sort: storage.SortName, Cursor: page.NextCursor}); !errors.Is(err, storage.ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor for cursor of another sort, got %v", err)
+	}
+	if _, err := s.GetTodos(ctx, storage.TodoQuery{Cursor: "not-a-cursor"}); !errors.Is(err, storage.ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor for garbage cursor, got %v", err)
+	}
+}
+
+func testGetTodosFilters(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	open := mustAdd(ctx, t, s, "open")
+	done := mustAdd(ctx, t, s, "done")
+	disabled := mustAdd(ctx, t, s, "disabled")
+	if _, err := s.ChangeCompleteStatus(ctx, done.ID, true, false, storage.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ChangeEnableStatus(ctx, disabled.ID, false, storage.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+
+	yes, no := true, false
+	page, err := s.GetTodos(ctx, storage.TodoQuery{Completed: &yes})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	assertNames(t, page.Todos, "done")
+
+	page, err = s.GetTodos(ctx, storage.TodoQuery{Completed: &no, Enabled: &yes})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	assertNames(t, page.Todos, "open")
+
+	after := open.CreatedAt.Add(-time.Minute)
+	before := open.CreatedAt.Add(time.Minute)
+	page, err = s.GetTodos(ctx, storage.TodoQuery{CreatedAfter: &after, CreatedBefore: &before})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	assertNames(t, page.Todos, "open", "done", "disabled")
+
+	page, err = s.GetTodos(ctx, storage.TodoQuery{CreatedAfter: &before})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	assertNames(t, page.Todos)
+}
+
+func testDueDates(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	add := func(name, dueAt string) models.Todo {
+		todoRequest := models.TodoRequest{Name: name}
+		if dueAt != "" {
+			todoRequest.DueAt = &dueAt
+		}
+		todo, err := s.AddTodo(ctx, todoRequest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return todo
+	}
+	past := add("past", "2020-01-01T10:00:00Z")
+	add("future", "2999-01-01T10:00:00+02:00")
+	add("undated", "")
+
+	if past.DueAt == nil || !past.DueAt.Equal(time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected due_at to be stored, got %v", past.DueAt)
+	}
+	stored, err := s.GetTodoByID(ctx, past.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.DueAt == nil || !stored.DueAt.Equal(*past.DueAt) {
+		t.Errorf("expected stored due_at %v, got %v", past.DueAt, stored.DueAt)
+	}
+
+	now := time.Now()
+	page, err := s.GetTodos(ctx, storage.TodoQuery{DueBefore: &now})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	assertNames(t, page.Todos, "past")
+
+	page, err = s.GetTodos(ctx, storage.TodoQuery{DueAfter: &now})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	assertNames(t, page.Todos, "future")
+
+	updated, err := s.UpdateTodo(ctx, past.ID, models.TodoRequest{Name: "past"}, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to update todo: %v", err)
+	}
+	if updated.DueAt != nil {
+		t.Errorf("expected due_at to be cleared, got %v", updated.DueAt)
+	}
+}
+
+func testPriorities(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	add := func(name, priority, dueAt string) models.Todo {
+		todoRequest := models.TodoRequest{Name: name, Priority: priority}
+		if dueAt != "" {
+			todoRequest.DueAt = &dueAt
+		}
+		todo, err := s.AddTodo(ctx, todoRequest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pause()
+		return todo
+	}
+	plain := add("plain", "", "")
+	add("low", models.PriorityLow, "2030-01-01T00:00:00Z")
+	add("urgent undated", models.PriorityUrgent, "")
+	add("urgent later", models.PriorityUrgent, "2030-06-01T00:00:00Z")
+	add("urgent sooner", models.PriorityUrgent, "2030-01-01T00:00:00Z")
+	add("medium", models.PriorityMedium, "")
+	add("urgent undated again", models.PriorityUrgent, "")
+
+	if plain.Priority != models.PriorityNone {
+		t.Errorf("expected default priority %q, got %q", models.PriorityNone, plain.Priority)
+	}
+
+	want := []string{"urgent sooner", "urgent later", "urgent undated", "urgent undated again", "medium", "low", "plain"}
+	page, err := s.GetTodos(ctx, storage.TodoQuery{})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	assertNames(t, page.Todos, want...)
+
+	query := storage.TodoQuery{Limit: 2}
+	var names []string
+	for pages := 0; ; pages++ {
+		if pages > 4 {
+			t.Fatalf("expected pagination to stop after 4 pages")
+		}
+		page, err := s.GetTodos(ctx, query)
+		if err != nil {
+			t.Fatalf("failed to get todos: %v", err)
+		}
+		for _, todo := range page.Todos {
+			names = append(names, todo.Name)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("expected pages [%s], got [%s]", strings.Join(want, ","), strings.Join(names, ","))
+	}
+
+	updated, err := s.UpdateTodo(ctx, plain.ID, models.TodoRequest{Name: "plain", Priority: models.PriorityHigh}, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to update todo: %v", err)
+	}
+	if updated.Priority != models.PriorityHigh {
+		t.Errorf("expected priority %q, got %q", models.PriorityHigh, updated.Priority)
+	}
+}
+
+func testSearchTodos(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	add := func(name, description string) models.Todo {
+		todo, err := s.AddTodo(ctx, models.TodoRequest{Name: name, Description: description})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return todo
+	}
+	inDescription := add("groceries", "pick up milk and bread")
+	inName := add("milk the cow", "before sunrise")
+	add("bread", "from the bakery")
+	markup := add("<b>cheese</b>", `"aged" & 'sharp'`)
+
+	results, err := s.SearchTodos(ctx, "milk", 10)
+	if err != nil {
+		t.Fatalf("failed to search todos: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].ID != inName.ID || results[1].ID != inDescription.ID {
+		t.Errorf("expected name match to rank above description match, got ids %d, %d", results[0].ID, results[1].ID)
+	}
+	if results[0].Rank <= results[1].Rank {
+		t.Errorf("expected descending ranks, got %v, %v", results[0].Rank, results[1].Rank)
+	}
+	for _, result := range results {
+		if !strings.Contains(result.Snippet, "<mark>milk</mark>") {
+			t.Errorf("expected highlighted snippet, got %q", result.Snippet)
+		}
+	}
+
+	results, err = s.SearchTodos(ctx, "milk bread", 10)
+	if err != nil {
+		t.Fatalf("failed to search todos: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != inDescription.ID {
+		t.Errorf("expected only todos matching every word, got %+v", results)
+	}
+
+	results, err = s.SearchTodos(ctx, "milk", 1)
+	if err != nil {
+		t.Fatalf("failed to search todos: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("expected limit to be applied, got %d results", len(results))
+	}
+
+	results, err = s.SearchTodos(ctx, "cheese", 10)
+	if err != nil {
+		t.Fatalf("failed to search todos: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != markup.ID {
+		t.Fatalf("expected the todo with markup, got %+v", results)
+	}
+	if snippet := results[0].Snippet; !strings.Contains(snippet, "&lt;b&gt;<mark>cheese</mark>&lt;/b&gt;") || strings.ContainsAny(strings.ReplaceAll(strings.ReplaceAll(snippet, "<mark>", ""), "</mark>", ""), `<>"'`) {
+		t.Errorf("expected an escaped snippet, got %q", snippet)
+	}
+
+	results, err = s.SearchTodos(ctx, "nothing", 10)
+	if err != nil {
+		t.Fatalf("failed to search todos: %v", err)
+	}
+	if results == nil || len(results) != 0 {
+		t.Errorf("expected empty non-nil results, got %#v", results)
+	}
+}
+
+func testGetTodoByID(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	if _, err := s.GetTodoByID(ctx, 1); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for missing todo, got %v", err)
+	}
+
+	added := mustAdd(ctx, t, s, "first")
+	todo, err := s.GetTodoByID(ctx, added.ID)
+	if err != nil {
+		t.Fatalf("failed to get todo: %v", err)
+	}
+	if todo.ID != added.ID {
+		t.Errorf("expected id %d, got %d", added.ID, todo.ID)
+	}
+}
+
+func testUpdateTodo(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	added := mustAdd(ctx, t, s, "first")
+	pause()
+
+	updated, err := s.UpdateTodo(ctx, added.ID, models.TodoRequest{Name: "renamed", Description: "changed"}, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to update todo: %v", err)
+	}
+	if updated.Name != "renamed" || updated.Description != "changed" {
+		t.Errorf("expected updated fields, got %+v", updated)
+	}
+	if !sameTime(updated.CreatedAt, added.CreatedAt) {
+		t.Errorf("expected created_at to be unchanged, got %v want %v", updated.CreatedAt, added.CreatedAt)
+	}
+	if !updated.UpdatedAt.After(added.UpdatedAt) {
+		t.Errorf("expected updated_at to advance past %v, got %v", added.UpdatedAt, updated.UpdatedAt)
+	}
+
+	if _, err := s.UpdateTodo(ctx, added.ID+100, models.TodoRequest{Name: "missing"}, storage.Precondition{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when updating missing todo, got %v", err)
+	}
+}
+
+func testPatchTodo(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	added := mustAdd(ctx, t, s, "first")
+	pause()
+
+	patched, err := s.PatchTodo(ctx, added.ID, func(current models.TodoRequest) (models.TodoRequest, error) {
+		if current.Name != "first" || current.Description != "first description" {
+			t.Errorf("expected current fields to be passed to patch, got %+v", current)
+		}
+		current.Description = "patched"
+		return current, nil
+	}, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to patch todo: %v", err)
+	}
+	if patched.Name != "first" || patched.Description != "patched" {
+		t.Errorf("expected only description to change, got %+v", patched)
+	}
+	if !patched.UpdatedAt.After(added.UpdatedAt) {
+		t.Errorf("expected updated_at to advance on patch")
+	}
+
+	errPatch := errors.New("patch failed")
+	_, err = s.PatchTodo(ctx, added.ID, func(current models.TodoRequest) (models.TodoRequest, error) {
+		return models.TodoRequest{Name: "ignored"}, errPatch
+	}, storage.Precondition{})
+	if !errors.Is(err, errPatch) {
+		t.Errorf("expected patch error to be returned, got %v", err)
+	}
+	stored, err := s.GetTodoByID(ctx, added.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Name != "first" {
+		t.Errorf("expected failed patch to leave todo unchanged, got %+v", stored)
+	}
+
+	_, err = s.PatchTodo(ctx, added.ID+100, func(current models.TodoRequest) (models.TodoRequest, error) {
+		t.Errorf("expected patch not to be called for missing todo")
+		return current, nil
+	}, storage.Precondition{})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when patching missing todo, got %v", err)
+	}
+}
+
+func testChangeEnableStatus(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	added := mustAdd(ctx, t, s, "first")
+
+	if _, err := s.ChangeEnableStatus(ctx, added.ID, true, storage.Precondition{}); !errors.Is(err, storage.ErrAlreadyInState) {
+		t.Errorf("expected ErrAlreadyInState when enabling an enabled todo, got %v", err)
+	}
+
+	pause()
+	disabled, err := s.ChangeEnableStatus(ctx, added.ID, false, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to disable todo: %v", err)
+	}
+	if disabled.Enabled {
+		t.Errorf("expected todo to be disabled")
+	}
+	if !disabled.UpdatedAt.After(added.UpdatedAt) {
+		t.Errorf("expected updated_at to advance on disable")
+	}
+
+	if _, err := s.ChangeEnableStatus(ctx, added.ID, false, storage.Precondition{}); !errors.Is(err, storage.ErrAlreadyInState) {
+		t.Errorf("expected ErrAlreadyInState when disabling a disabled todo, got %v", err)
+	}
+
+	enabled, err := s.ChangeEnableStatus(ctx, added.ID, true, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to enable todo: %v", err)
+	}
+	if !enabled.Enabled {
+		t.Errorf("expected todo to be enabled")
+	}
+
+	if _, err := s.ChangeEnableStatus(ctx, added.ID+100, false, storage.Precondition{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when disabling missing todo, got %v", err)
+	}
+}
+
+func testChangeCompleteStatus(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	added := mustAdd(ctx, t, s, "first")
+
+	if _, err := s.ChangeCompleteStatus(ctx, added.ID, false, false, storage.Precondition{}); !errors.Is(err, storage.ErrAlreadyInState) {
+		t.Errorf("expected ErrAlreadyInState when reopening an open todo, got %v", err)
+	}
+
+	pause()
+	completed, err := s.ChangeCompleteStatus(ctx, added.ID, true, false, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to complete todo: %v", err)
+	}
+	if !completed.Completed || completed.CompletedAt == nil {
+		t.Errorf("expected todo to be completed with completed_at set, got %+v", completed)
+	}
+	if !completed.UpdatedAt.After(added.UpdatedAt) {
+		t.Errorf("expected updated_at to advance on complete")
+	}
+
+	if _, err := s.ChangeCompleteStatus(ctx, added.ID, true, false, storage.Precondition{}); !errors.Is(err, storage.ErrAlreadyInState) {
+		t.Errorf("expected ErrAlreadyInState when completing a completed todo, got %v", err)
+	}
+
+	reopened, err := s.ChangeCompleteStatus(ctx, added.ID, false, false, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to reopen todo: %v", err)
+	}
+	if reopened.Completed || reopened.CompletedAt != nil {
+		t.Errorf("expected todo to be open with completed_at cleared, got %+v", reopened)
+	}
+
+	if _, err := s.ChangeCompleteStatus(ctx, added.ID+100, true, false, storage.Precondition{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when completing missing todo, got %v", err)
+	}
+}
+
+func testDeleteTodo(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	added := mustAdd(ctx, t, s, "first")
+	kept := mustAdd(ctx, t, s, "second")
+
+	if err := s.DeleteTodo(ctx, added.ID, false, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to delete todo: %v", err)
+	}
+	if _, err := s.GetTodoByID(ctx, added.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected deleted todo to be gone, got %v", err)
+	}
+	if err := s.DeleteTodo(ctx, added.ID, false, storage.Precondition{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when deleting a deleted todo, got %v", err)
+	}
+	if _, err := s.GetTodoByID(ctx, kept.ID); err != nil {
+		t.Errorf("expected other todos to be kept: %v", err)
+	}
+}
+
+func testTrash(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	root := mustAdd(ctx, t, s, "root")
+	child := mustAddSubtask(ctx, t, s, "child", root.ID)
+	grandchild := mustAddSubtask(ctx, t, s, "grandchild", child.ID)
+	other := mustAdd(ctx, t, s, "other")
+	if _, err := s.AddDependency(ctx, other.ID, child.ID, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to add dependency: %v", err)
+	}
+
+	if err := s.DeleteTodo(ctx, grandchild.ID, false, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to trash todo: %v", err)
+	}
+	pause()
+	if err := s.DeleteTodo(ctx, root.ID, false, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to trash todo: %v", err)
+	}
+
+	page, err := s.GetTodos(ctx, storage.TodoQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNames(t, page.Todos, "other")
+	if results, err := s.SearchTodos(ctx, "child", 10); err != nil || len(results) != 0 {
+		t.Errorf("expected trashed todos to be left out of search, got %+v, %v", results, err)
+	}
+	if _, err := s.GetChildren(ctx, root.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for children of a trashed todo, got %v", err)
+	}
+	if _, err := s.ChangeCompleteStatus(ctx, child.ID, true, false, storage.Precondition{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound completing a trashed todo, got %v", err)
+	}
+	if _, err := s.AddTodo(ctx, models.TodoRequest{Name: "orphan", ParentID: &root.ID}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound adding a subtask to a trashed todo, got %v", err)
+	}
+	got, err := s.GetTodoByID(ctx, other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.BlockedBy) != 0 || got.Blocked {
+		t.Errorf("expected trashed blocker to be dropped, got %+v", got)
+	}
+
+	trash, err := s.GetTrash(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 3 || trash[2].ID != grandchild.ID || trash[0].DeletedAt == nil {
+		t.Errorf("expected the three trashed todos, most recent first, got %+v", trash)
+	}
+
+	if _, err := s.RestoreTodo(ctx, grandchild.ID, storage.Precondition{}); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict restoring a todo whose parent is in the trash, got %v", err)
+	}
+	restored, err := s.RestoreTodo(ctx, root.ID, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to restore todo: %v", err)
+	}
+	if restored.DeletedAt != nil || restored.Version <= root.Version {
+		t.Errorf("expected restored todo with a new version, got %+v", restored)
+	}
+	if _, err := s.RestoreTodo(ctx, root.ID, storage.Precondition{}); !errors.Is(err, storage.ErrAlreadyInState) {
+		t.Errorf("expected ErrAlreadyInState restoring a live todo, got %v", err)
+	}
+	children, err := s.GetChildren(ctx, child.ID)
+	if err != nil {
+		t.Fatalf("expected subtask trashed with its parent to be restored: %v", err)
+	}
+	if len(children) != 0 {
+		t.Errorf("expected subtask trashed earlier to stay in the trash, got %+v", children)
+	}
+
+	if err := s.DeleteTodo(ctx, other.ID, true, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to delete todo for good: %v", err)
+	}
+	if err := s.DeleteTodo(ctx, grandchild.ID, true, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to delete trashed todo for good: %v", err)
+	}
+	trash, err = s.GetTrash(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 0 {
+		t.Errorf("expected permanently deleted todos to skip the trash, got %+v", trash)
+	}
+
+	if err := s.DeleteTodo(ctx, root.ID, false, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to trash todo: %v", err)
+	}
+	n, err := s.PurgeTrash(ctx, time.Now().Add(-time.Hour))
+	if err != nil || n != 0 {
+		t.Errorf("expected nothing to purge yet, got %d, %v", n, err)
+	}
+	n, err = s.PurgeTrash(ctx, time.Now().Add(time.Hour))
+	if err != nil || n != 2 {
+		t.Errorf("expected the trashed todo and its subtask to be purged and counted, got %d, %v", n, err)
+	}
+	if _, err := s.RestoreTodo(ctx, root.ID, storage.Precondition{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound restoring a purged todo, got %v", err)
+	}
+
+	parent := mustAdd(ctx, t, s, "parent")
+	sub := mustAddSubtask(ctx, t, s, "sub", parent.ID)
+	if err := s.DeleteTodo(ctx, sub.ID, false, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to trash todo: %v", err)
+	}
+	pause()
+	cutoff := time.Now()
+	pause()
+	if err := s.DeleteTodo(ctx, parent.ID, false, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to trash todo: %v", err)
+	}
+	n, err = s.PurgeTrash(ctx, cutoff)
+	if err != nil || n != 1 {
+		t.Errorf("expected only the subtask trashed earlier to be purged, got %d, %v", n, err)
+	}
+	if _, err := s.RestoreTodo(ctx, parent.ID, storage.Precondition{}); err != nil {
+		t.Errorf("expected todo trashed later to stay in the trash: %v", err)
+	}
+}
+
+func testHistory(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	todo := mustAdd(ctx, t, s, "history")
+	other := mustAdd(ctx, t, s, "other")
+	if _, err := s.UpdateTodo(ctx, todo.ID, models.TodoRequest{Name: "renamed", Description: todo.Description}, storage.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpdateTodo(ctx, todo.ID, models.TodoRequest{Name: "renamed", Description: todo.Description}, storage.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ChangeEnableStatus(ctx, todo.ID, false, storage.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	tag := mustAddTag(ctx, t, s, "work")
+	if _, err := s.AttachTag(ctx, todo.ID, tag.ID, storage.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteTodo(ctx, todo.ID, false, storage.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := s.GetTodoHistory(ctx, todo.ID, storage.HistoryQuery{})
+	if err != nil {
+		t.Fatalf("failed to get history: %v", err)
+	}
+	want := []string{models.EventTrashed, models.EventTagged, models.EventDisabled, models.EventUpdated, models.EventCreated}
+	if len(page.Events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), page.Events)
+	}
+	for i, event := range page.Events {
+		if event.Action != want[i] || event.TodoID != todo.ID {
+			t.Errorf("event %d: expected %s of todo %d, got %+v", i, want[i], todo.ID, event)
+		}
+	}
+
+	var before, after map[string]any
+	updated := page.Events[3]
+	if err := json.Unmarshal(updated.Before, &before); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(updated.After, &after); err != nil {
+		t.Fatal(err)
+	}
+	if len(before) != 1 || before["name"] != "history" || len(after) != 1 || after["name"] != "renamed" {
+		t.Errorf("expected only the name in the update diff, got %s and %s", updated.Before, updated.After)
+	}
+	if updated.Version != 2 {
+		t.Errorf("expected the update to leave version 2, got %d", updated.Version)
+	}
+	if created := page.Events[4]; string(created.Before) != "null" || !strings.Contains(string(created.After), `"name":`) {
+		t.Errorf("expected a null before and the full todo after on creation, got %s and %s", created.Before, created.After)
+	}
+
+	first, err := s.GetTodoHistory(ctx, todo.ID, storage.HistoryQuery{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Events) != 2 || first.NextCursor == "" {
+		t.Fatalf("expected a first page of 2 with a cursor, got %+v", first)
+	}
+	second, err := s.GetTodoHistory(ctx, todo.ID, storage.HistoryQuery{Limit: 2, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Events) != 2 || second.Events[0].Action != models.EventDisabled {
+		t.Errorf("expected the second page to continue after the first, got %+v", second.Events)
+	}
+	if _, err := s.GetTodoHistory(ctx, todo.ID, storage.HistoryQuery{Cursor: "bogus"}); !errors.Is(err, storage.ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+
+	if err := s.DeleteTodo(ctx, todo.ID, true, storage.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	page, err = s.GetTodoHistory(ctx, todo.ID, storage.HistoryQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("expected history to outlive the todo, got %v", err)
+	}
+	if len(page.Events) != 1 || page.Events[0].Action != models.EventDeleted || string(page.Events[0].After) != "null" {
+		t.Errorf("expected a deleted event last, got %+v", page.Events)
+	}
+
+	page, err = s.GetTodoHistory(ctx, other.ID, storage.HistoryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Events) != 1 || page.Events[0].Action != models.EventCreated {
+		t.Errorf("expected only the creation of the other todo, got %+v", page.Events)
+	}
+	if _, err := s.GetTodoHistory(ctx, 9999, storage.HistoryQuery{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func testUndo(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	if _, err := s.Undo(ctx, 1); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict with nothing to undo, got %v", err)
+	}
+
+	todo := mustAdd(ctx, t, s, "undo me")
+	dueAt := "2025-07-01T09:00:00Z"
+	if _, err := s.UpdateTodo(ctx, todo.ID, models.TodoRequest{Name: "renamed", Priority: models.PriorityHigh, DueAt: &dueAt}, storage.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ChangeEnableStatus(ctx, todo.ID, false, storage.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ChangeCompleteStatus(ctx, todo.ID, true, false, storage.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteTodo(ctx, todo.ID, false, storage.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+
+	undone, err := s.Undo(ctx, 2)
+	if err != nil {
+		t.Fatalf("failed to undo: %v", err)
+	}
+	if len(undone) != 2 || undone[0].Action != models.EventTrashed || undone[1].Action != models.EventCompleted {
+		t.Errorf("expected the trashing and the completion to be undone, got %+v", undone)
+	}
+	got, err := s.GetTodoByID(ctx, todo.ID)
+	if err != nil {
+		t.Fatalf("expected the todo out of the trash, got %v", err)
+	}
+	if got.Completed || got.CompletedAt != nil || got.Enabled {
+		t.Errorf("expected an open, disabled todo, got %+v", got)
+	}
+
+	undone, err = s.Undo(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(undone) != 2 {
+		t.Errorf("expected the remaining 2 changes to be undone, got %+v", undone)
+	}
+	got, err = s.GetTodoByID(ctx, todo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "undo me" || got.Priority != models.PriorityNone || got.DueAt != nil || !got.Enabled {
+		t.Errorf("expected the todo as it was added, got %+v", got)
+	}
+	if _, err := s.Undo(ctx, 1); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict with nothing left to undo, got %v", err)
+	}
+
+	redone, err := s.Redo(ctx, 2)
+	if err != nil {
+		t.Fatalf("failed to redo: %v", err)
+	}
+	if len(redone) != 2 || redone[0].Action != models.EventUpdated || redone[1].Action != models.EventDisabled {
+		t.Errorf("expected the update and disabling to be redone in order, got %+v", redone)
+	}
+	got, err = s.GetTodoByID(ctx, todo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "renamed" || got.DueAt == nil || got.Enabled {
+		t.Errorf("expected the update and disabling to be applied again, got %+v", got)
+	}
+
+	if _, err := s.ChangeEnableStatus(ctx, todo.ID, true, storage.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Redo(ctx, 1); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected a new change to drop the undone ones, got %v", err)
+	}
+
+	other := mustAdd(ctx, t, s, "other")
+	if err := s.DeleteTodo(ctx, other.ID, false, storage.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RestoreTodo(ctx, other.ID, storage.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Undo(ctx, 1); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict undoing a change to a todo modified since, got %v", err)
+	}
+	undone, err = s.Undo(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(undone) != 1 || undone[0].Action != models.EventEnabled {
+		t.Errorf("expected the stale change to be dropped and the one below undone, got %+v", undone)
+	}
+}
+
+func testConcurrentUndo(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	const n = 5
+	todo := mustAdd(ctx, t, s, "rename 0")
+	for i := 1; i <= n; i++ {
+		if _, err := s.UpdateTodo(ctx, todo.ID, models.TodoRequest{Name: fmt.Sprintf("rename %d", i)}, storage.Precondition{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	undone := make([][]models.TodoEvent, n)
+	errs := make([]error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			undone[i], errs[i] = s.Undo(ctx, 1)
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[int]bool)
+	for i := range n {
+		if errs[i] != nil {
+			t.Fatalf("expected every concurrent undo to succeed, got %v", errs[i])
+		}
+		if len(undone[i]) != 1 || seen[undone[i][0].ID] {
+			t.Fatalf("expected each undo to revert a change of its own, got %+v", undone)
+		}
+		seen[undone[i][0].ID] = true
+	}
+	got, err := s.GetTodoByID(ctx, todo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "rename 0" {
+		t.Errorf("expected every rename to be undone, got %q", got.Name)
+	}
+	if redone, err := s.Redo(ctx, n); err != nil || len(redone) != n {
+		t.Errorf("expected the %d changes to be redone, got %+v, %v", n, redone, err)
+	}
+}
+
+func testSharedUndo(t *testing.T, s storage.Store) {
+	alice := userContext(t, s, "alice@example.com")
+	bob := userContext(t, s, "bob@example.com")
+	aliceID, _ := storage.OwnerFromContext(alice)
+	bobID, _ := storage.OwnerFromContext(bob)
+
+	list, err := s.AddList(alice, models.ListRequest{Name: "Team"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo, err := s.AddTodo(alice, models.TodoRequest{ListID: list.ID, Name: "shared"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ShareList(alice, list.ID, "bob@example.com", models.RoleEditor); err != nil {
+		t.Fatal(err)
+	}
+	asBob := storage.WithOwner(storage.WithActor(context.Background(), bobID), aliceID)
+	if _, err := s.UpdateTodo(asBob, todo.ID, models.TodoRequest{ListID: list.ID, Name: "renamed by bob"}, storage.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := s.GetTodoHistory(alice, todo.ID, storage.HistoryQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Events) != 2 || history.Events[0].ActorID != bobID || history.Events[1].ActorID != aliceID {
+		t.Errorf("expected the update made by bob after alice created the todo, got %+v", history.Events)
+	}
+	if _, err := s.Undo(alice, 1); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected nothing for alice to undo, got %v", err)
+	}
+	undone, err := s.Undo(bob, 1)
+	if err != nil {
+		t.Fatalf("failed to undo bob's change: %v", err)
+	}
+	if len(undone) != 1 || undone[0].TodoID != todo.ID {
+		t.Errorf("expected bob's change to be undone, got %+v", undone)
+	}
+	got, err := s.GetTodoByID(alice, todo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "shared" {
+		t.Errorf("expected the todo as alice added it, got %q", got.Name)
+	}
+
+	if err := s.UnshareList(alice, list.ID, bobID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Redo(bob, 1); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound redoing a change to a todo no longer shared, got %v", err)
+	}
+	if _, err := s.Redo(bob, 1); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected the change to be dropped, got %v", err)
+	}
+}
+
+func testPreconditions(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	added := mustAdd(ctx, t, s, "first")
+	if added.Version != 1 {
+		t.Errorf("expected new todo at version 1, got %d", added.Version)
+	}
+
+	stale := storage.Precondition{IfMatch: []int{added.Version}}
+	updated, err := s.UpdateTodo(ctx, added.ID, models.TodoRequest{Name: "second"}, stale)
+	if err != nil {
+		t.Fatalf("failed to update todo at matching version: %v", err)
+	}
+	if updated.Version != added.Version+1 {
+		t.Errorf("expected version to be incremented to %d, got %d", added.Version+1, updated.Version)
+	}
+
+	if _, err := s.UpdateTodo(ctx, added.ID, models.TodoRequest{Name: "third"}, stale); !errors.Is(err, storage.ErrPreconditionFailed) {
+		t.Errorf("expected ErrPreconditionFailed for stale update, got %v", err)
+	}
+	if _, err := s.PatchTodo(ctx, added.ID, func(current models.TodoRequest) (models.TodoRequest, error) {
+		return current, nil
+	}, stale); !errors.Is(err, storage.ErrPreconditionFailed) {
+		t.Errorf("expected ErrPreconditionFailed for stale patch, got %v", err)
+	}
+	if _, err := s.ChangeEnableStatus(ctx, added.ID, false, stale); !errors.Is(err, storage.ErrPreconditionFailed) {
+		t.Errorf("expected ErrPreconditionFailed for stale disable, got %v", err)
+	}
+	if _, err := s.ChangeCompleteStatus(ctx, added.ID, true, false, stale); !errors.Is(err, storage.ErrPreconditionFailed) {
+		t.Errorf("expected ErrPreconditionFailed for stale complete, got %v", err)
+	}
+	if err := s.DeleteTodo(ctx, added.ID, false, stale); !errors.Is(err, storage.ErrPreconditionFailed) {
+		t.Errorf("expected ErrPreconditionFailed for stale delete, got %v", err)
+	}
+	if err := s.DeleteTodo(ctx, added.ID, false, storage.Precondition{IfNoneMatchAny: true}); !errors.Is(err, storage.ErrPreconditionFailed) {
+		t.Errorf("expected ErrPreconditionFailed for If-None-Match: *, got %v", err)
+	}
+
+	stored, err := s.GetTodoByID(ctx, added.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Name != "second" || stored.Version != updated.Version {
+		t.Errorf("expected failed preconditions to leave todo unchanged, got %+v", stored)
+	}
+
+	current := storage.Precondition{IfMatch: []int{updated.Version}, IfNoneMatch: []int{added.Version}}
+	disabled, err := s.ChangeEnableStatus(ctx, added.ID, false, current)
+	if err != nil {
+		t.Fatalf("failed to disable todo at matching version: %v", err)
+	}
+	if disabled.Version != updated.Version+1 {
+		t.Errorf("expected version to be incremented to %d, got %d", updated.Version+1, disabled.Version)
+	}
+	if err := s.DeleteTodo(ctx, added.ID, false, storage.Precondition{IfMatch: []int{disabled.Version}}); err != nil {
+		t.Errorf("failed to delete todo at matching version: %v", err)
+	}
+}
+
+func testConcurrentAddTodo(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+	const n = 50
+
+	var wg sync.WaitGroup
+	ids := make(chan int, n)
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			todo, err := s.AddTodo(ctx, models.TodoRequest{Name: "concurrent"})
+			if err != nil {
+				errs <- err
+				return
+			}
+			ids <- todo.ID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("failed to add todo concurrently: %v", err)
+	}
+	seen := make(map[int]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("duplicate id %d", id)
+		}
+		seen[id] = true
+	}
+
+	page, err := s.GetTodos(ctx, storage.TodoQuery{Limit: storage.MaxTodoLimit})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	if len(page.Todos) != n {
+		t.Errorf("expected %d todos, got %d", n, len(page.Todos))
+	}
+	ranks := make(map[string]bool)
+	for _, todo := range page.Todos {
+		if ranks[todo.Rank] {
+			t.Errorf("duplicate rank %q", todo.Rank)
+		}
+		ranks[todo.Rank] = true
+	}
+}
+
+func testTags(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	tags, err := s.GetTags(ctx)
+	if err != nil {
+		t.Fatalf("failed to get tags: %v", err)
+	}
+	if tags == nil || len(tags) != 0 {
+		t.Errorf("expected no tags, got %#v", tags)
+	}
+
+	work := mustAddTag(ctx, t, s, "work")
+	mustAddTag(ctx, t, s, "home")
+	if _, err := s.AddTag(ctx, models.TagRequest{Name: "work"}); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict for duplicate tag, got %v", err)
+	}
+
+	tags, err = s.GetTags(ctx)
+	if err != nil {
+		t.Fatalf("failed to get tags: %v", err)
+	}
+	if len(tags) != 2 || tags[0].Name != "home" || tags[1].Name != "work" {
+		t.Errorf("expected tags sorted by name, got %+v", tags)
+	}
+
+	if _, err := s.UpdateTag(ctx, work.ID, models.TagRequest{Name: "home"}); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict when renaming to an existing tag, got %v", err)
+	}
+	renamed, err := s.UpdateTag(ctx, work.ID, models.TagRequest{Name: "office"})
+	if err != nil {
+		t.Fatalf("failed to update tag: %v", err)
+	}
+	got, err := s.GetTagByID(ctx, work.ID)
+	if err != nil {
+		t.Fatalf("failed to get tag: %v", err)
+	}
+	if renamed.Name != "office" || got.Name != "office" {
+		t.Errorf("expected tag to be renamed, got %+v and %+v", renamed, got)
+	}
+
+	if err := s.DeleteTag(ctx, work.ID); err != nil {
+		t.Fatalf("failed to delete tag: %v", err)
+	}
+	if _, err := s.GetTagByID(ctx, work.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+	if err := s.DeleteTag(ctx, work.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+	}
+	if _, err := s.UpdateTag(ctx, work.ID, models.TagRequest{Name: "work"}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound updating a deleted tag, got %v", err)
+	}
+}
+
+func testTagTodos(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	work := mustAddTag(ctx, t, s, "work")
+	home := mustAddTag(ctx, t, s, "home")
+	both := mustAdd(ctx, t, s, "both")
+	workOnly := mustAdd(ctx, t, s, "work only")
+	mustAdd(ctx, t, s, "untagged")
+
+	if both.Tags == nil || len(both.Tags) != 0 {
+		t.Errorf("expected new todo to have no tags, got %#v", both.Tags)
+	}
+
+	attached, err := s.AttachTag(ctx, both.ID, work.ID, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to attach tag: %v", err)
+	}
+	if attached.Version != both.Version+1 {
+		t.Errorf("expected version %d, got %d", both.Version+1, attached.Version)
+	}
+	attached, err = s.AttachTag(ctx, both.ID, home.ID, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to attach tag: %v", err)
+	}
+	if len(attached.Tags) != 2 || attached.Tags[0] != home || attached.Tags[1] != work {
+		t.Errorf("expected tags [home work], got %+v", attached.Tags)
+	}
+	again, err := s.AttachTag(ctx, both.ID, home.ID, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to attach tag again: %v", err)
+	}
+	if again.Version != attached.Version || len(again.Tags) != 2 {
+		t.Errorf("expected attaching twice to change nothing, got %+v", again)
+	}
+	if _, err := s.AttachTag(ctx, workOnly.ID, work.ID, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to attach tag: %v", err)
+	}
+
+	if _, err := s.AttachTag(ctx, both.ID, 999, storage.Precondition{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for missing tag, got %v", err)
+	}
+	if _, err := s.AttachTag(ctx, 999, work.ID, storage.Precondition{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for missing todo, got %v", err)
+	}
+	if _, err := s.AttachTag(ctx, workOnly.ID, home.ID, storage.Precondition{IfMatch: []int{}}); !errors.Is(err, storage.ErrPreconditionFailed) {
+		t.Errorf("expected ErrPreconditionFailed, got %v", err)
+	}
+
+	page, err := s.GetTodos(ctx, storage.TodoQuery{Sort: storage.SortCreatedAt, Tags: []string{"work", "home"}})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	assertNames(t, page.Todos, "both", "work only")
+	page, err = s.GetTodos(ctx, storage.TodoQuery{Sort: storage.SortCreatedAt, Tags: []string{"work", "home", "work"}, MatchAllTags: true})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	assertNames(t, page.Todos, "both")
+	page, err = s.GetTodos(ctx, storage.TodoQuery{Tags: []string{"missing"}})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	assertNames(t, page.Todos)
+
+	before, err := s.GetTodoByID(ctx, both.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpdateTag(ctx, work.ID, models.TagRequest{Name: "office"}); err != nil {
+		t.Fatalf("failed to update tag: %v", err)
+	}
+	after, err := s.GetTodoByID(ctx, both.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Version != before.Version+1 || len(after.Tags) != 2 || after.Tags[1].Name != "office" {
+		t.Errorf("expected renamed tag on todo with a new version, got %+v", after)
+	}
+
+	detached, err := s.DetachTag(ctx, both.ID, home.ID, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to detach tag: %v", err)
+	}
+	if len(detached.Tags) != 1 || detached.Tags[0].Name != "office" || detached.Version != after.Version+1 {
+		t.Errorf("expected only office tag left with a new version, got %+v", detached)
+	}
+	if _, err := s.DetachTag(ctx, both.ID, home.ID, storage.Precondition{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound detaching twice, got %v", err)
+	}
+
+	if err := s.DeleteTag(ctx, work.ID); err != nil {
+		t.Fatalf("failed to delete tag: %v", err)
+	}
+	stored, err := s.GetTodoByID(ctx, workOnly.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Tags) != 0 {
+		t.Errorf("expected deleted tag to be removed from todos, got %+v", stored.Tags)
+	}
+
+	if _, err := s.AttachTag(ctx, both.ID, home.ID, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to attach tag: %v", err)
+	}
+	updated, err := s.UpdateTodo(ctx, both.ID, models.TodoRequest{Name: "both renamed"}, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to update todo: %v", err)
+	}
+	if len(updated.Tags) != 1 || updated.Tags[0] != home {
+		t.Errorf("expected updated todo to keep its tags, got %+v", updated.Tags)
+	}
+}
+
+func mustAddTag(ctx context.Context, t *testing.T, s storage.Store, name string) models.Tag {
+	t.Helper()
+	tag, err := s.AddTag(ctx, models.TagRequest{Name: name})
+	if err != nil {
+		t.Fatalf("failed to add tag %q: %v", name, err)
+	}
+	return tag
+}
+
+func testLists(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	lists, err := s.GetLists(ctx)
+	if err != nil {
+		t.Fatalf("failed to get lists: %v", err)
+	}
+	if len(lists) != 1 || !lists[0].Default {
+		t.Fatalf("expected only the default list, got %+v", lists)
+	}
+	inbox := lists[0]
+
+	sprint, err := s.AddList(ctx, models.ListRequest{Name: "Sprint", Description: "Team work"})
+	if err != nil {
+		t.Fatalf("failed to add list: %v", err)
+	}
+	if sprint.ID == 0 || sprint.Default || sprint.CreatedAt.IsZero() {
+		t.Errorf("unexpected list %+v", sprint)
+	}
+
+	updated, err := s.UpdateList(ctx, sprint.ID, models.ListRequest{Name: "Sprint 2"})
+	if err != nil {
+		t.Fatalf("failed to update list: %v", err)
+	}
+	got, err := s.GetListByID(ctx, sprint.ID)
+	if err != nil {
+		t.Fatalf("failed to get list: %v", err)
+	}
+	if updated.Name != "Sprint 2" || got.Name != "Sprint 2" || got.Description != "" {
+		t.Errorf("expected list to be updated, got %+v and %+v", updated, got)
+	}
+
+	lists, err = s.GetLists(ctx)
+	if err != nil {
+		t.Fatalf("failed to get lists: %v", err)
+	}
+	if len(lists) != 2 || lists[0].ID != inbox.ID || lists[1].ID != sprint.ID {
+		t.Errorf("expected lists in creation order, got %+v", lists)
+	}
+
+	if err := s.DeleteList(ctx, inbox.ID); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict deleting the default list, got %v", err)
+	}
+	if err := s.DeleteList(ctx, sprint.ID); err != nil {
+		t.Fatalf("failed to delete list: %v", err)
+	}
+	if _, err := s.GetListByID(ctx, sprint.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+	if err := s.DeleteList(ctx, sprint.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+	}
+	if _, err := s.UpdateList(ctx, sprint.ID, models.ListRequest{Name: "Sprint 3"}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound updating a deleted list, got %v", err)
+	}
+}
+
+func testListTodos(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	lists, err := s.GetLists(ctx)
+	if err != nil {
+		t.Fatalf("failed to get lists: %v", err)
+	}
+	inbox := lists[0]
+	sprint, err := s.AddList(ctx, models.ListRequest{Name: "Sprint"})
+	if err != nil {
+		t.Fatalf("failed to add list: %v", err)
+	}
+
+	chore := mustAdd(ctx, t, s, "chore")
+	if chore.ListID != inbox.ID {
+		t.Errorf("expected todo in default list %d, got %d", inbox.ID, chore.ListID)
+	}
+	task, err := s.AddTodo(ctx, models.TodoRequest{Name: "task", ListID: sprint.ID})
+	if err != nil {
+		t.Fatalf("failed to add todo: %v", err)
+	}
+	if task.ListID != sprint.ID {
+		t.Errorf("expected todo in list %d, got %d", sprint.ID, task.ListID)
+	}
+	if _, err := s.AddTodo(ctx, models.TodoRequest{Name: "lost", ListID: 999}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound adding to a missing list, got %v", err)
+	}
+
+	page, err := s.GetTodos(ctx, storage.TodoQuery{ListID: sprint.ID})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	assertNames(t, page.Todos, "task")
+	page, err = s.GetTodos(ctx, storage.TodoQuery{Sort: storage.SortCreatedAt})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	assertNames(t, page.Todos, "chore", "task")
+	if _, err := s.GetTodos(ctx, storage.TodoQuery{ListID: 999}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound listing a missing list, got %v", err)
+	}
+
+	kept, err := s.UpdateTodo(ctx, chore.ID, models.TodoRequest{Name: "chore"}, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to update todo: %v", err)
+	}
+	if kept.ListID != inbox.ID {
+		t.Errorf("expected todo to stay in list %d, got %d", inbox.ID, kept.ListID)
+	}
+	moved, err := s.UpdateTodo(ctx, chore.ID, models.TodoRequest{Name: "chore", ListID: sprint.ID}, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to update todo: %v", err)
+	}
+	if moved.ListID != sprint.ID {
+		t.Errorf("expected todo to move to list %d, got %d", sprint.ID, moved.ListID)
+	}
+	if _, err := s.UpdateTodo(ctx, chore.ID, models.TodoRequest{Name: "chore", ListID: 999}, storage.Precondition{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound moving to a missing list, got %v", err)
+	}
+
+	if err := s.DeleteList(ctx, sprint.ID); err != nil {
+		t.Fatalf("failed to delete list: %v", err)
+	}
+	if _, err := s.GetTodoByID(ctx, task.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected todos of a deleted list to be deleted, got %v", err)
+	}
+}
+
+func testSubtasks(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	sprint, err := s.AddList(ctx, models.ListRequest{Name: "Sprint"})
+	if err != nil {
+		t.Fatalf("failed to add list: %v", err)
+	}
+	root, err := s.AddTodo(ctx, models.TodoRequest{Name: "root", ListID: sprint.ID})
+	if err != nil {
+		t.Fatalf("failed to add todo: %v", err)
+	}
+	child := mustAddSubtask(ctx, t, s, "child", root.ID)
+	pause()
+	mustAddSubtask(ctx, t, s, "second child", root.ID)
+	grandchild := mustAddSubtask(ctx, t, s, "grandchild", child.ID)
+
+	if child.ParentID == nil || *child.ParentID != root.ID || child.ListID != sprint.ID {
+		t.Errorf("expected subtask of %d in list %d, got %+v", root.ID, sprint.ID, child)
+	}
+	if _, err := s.AddTodo(ctx, models.TodoRequest{Name: "orphan", ParentID: intPtr(999)}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for missing parent, got %v", err)
+	}
+
+	children, err := s.GetChildren(ctx, root.ID)
+	if err != nil {
+		t.Fatalf("failed to get children: %v", err)
+	}
+	assertNames(t, children, "child", "second child")
+	if _, err := s.GetChildren(ctx, 999); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for missing todo, got %v", err)
+	}
+
+	tree, err := s.GetTodoTree(ctx, root.ID)
+	if err != nil {
+		t.Fatalf("failed to get todo tree: %v", err)
+	}
+	if tree.Name != "root" || len(tree.Children) != 2 || tree.Children[0].Name != "child" || len(tree.Children[0].Children) != 1 || tree.Children[0].Children[0].Name != "grandchild" {
+		t.Errorf("unexpected tree %+v", tree)
+	}
+	if tree.Children[1].Children == nil || len(tree.Children[1].Children) != 0 {
+		t.Errorf("expected leaf to have empty children, got %#v", tree.Children[1].Children)
+	}
+	if _, err := s.GetTodoTree(ctx, 999); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for missing todo, got %v", err)
+	}
+
+	for _, parentID := range []int{root.ID, grandchild.ID} {
+		_, err := s.UpdateTodo(ctx, root.ID, models.TodoRequest{Name: "root", ParentID: &parentID}, storage.Precondition{})
+		if !errors.Is(err, storage.ErrConflict) {
+			t.Errorf("expected ErrConflict re-parenting under %d, got %v", parentID, err)
+		}
+	}
+	moved, err := s.UpdateTodo(ctx, grandchild.ID, models.TodoRequest{Name: "grandchild", ParentID: &root.ID}, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to re-parent todo: %v", err)
+	}
+	if moved.ParentID == nil || *moved.ParentID != root.ID {
+		t.Errorf("expected parent %d, got %v", root.ID, moved.ParentID)
+	}
+	detached, err := s.UpdateTodo(ctx, grandchild.ID, models.TodoRequest{Name: "grandchild"}, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to detach todo: %v", err)
+	}
+	if detached.ParentID != nil {
+		t.Errorf("expected top-level todo, got parent %d", *detached.ParentID)
+	}
+
+	if err := s.DeleteTodo(ctx, root.ID, false, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to delete todo: %v", err)
+	}
+	if _, err := s.GetTodoByID(ctx, child.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected subtasks to be deleted with their parent, got %v", err)
+	}
+	if _, err := s.GetTodoByID(ctx, grandchild.ID); err != nil {
+		t.Errorf("expected detached todo to survive, got %v", err)
+	}
+}
+
+func testSubtaskLists(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	sprint, err := s.AddList(ctx, models.ListRequest{Name: "Sprint"})
+	if err != nil {
+		t.Fatalf("failed to add list: %v", err)
+	}
+	inbox := mustAdd(ctx, t, s, "inbox")
+	root, err := s.AddTodo(ctx, models.TodoRequest{Name: "root", ListID: sprint.ID})
+	if err != nil {
+		t.Fatalf("failed to add todo: %v", err)
+	}
+	child := mustAddSubtask(ctx, t, s, "child", root.ID)
+	grandchild := mustAddSubtask(ctx, t, s, "grandchild", child.ID)
+
+	if _, err := s.AddTodo(ctx, models.TodoRequest{Name: "stray", ListID: inbox.ListID, ParentID: &root.ID}); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict adding a subtask to another list than its parent's, got %v", err)
+	}
+	if _, err := s.UpdateTodo(ctx, child.ID, models.TodoRequest{Name: "child", ListID: inbox.ListID, ParentID: &root.ID}, storage.Precondition{}); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict moving a subtask away from its parent's list, got %v", err)
+	}
+
+	moved, err := s.UpdateTodo(ctx, grandchild.ID, models.TodoRequest{Name: "grandchild", ParentID: &inbox.ID}, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to re-parent todo: %v", err)
+	}
+	if moved.ListID != inbox.ListID {
+		t.Errorf("expected a re-parented subtask to follow its parent to list %d, got %d", inbox.ListID, moved.ListID)
+	}
+	if _, err := s.UpdateTodo(ctx, grandchild.ID, models.TodoRequest{Name: "grandchild", ParentID: &child.ID}, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to re-parent todo: %v", err)
+	}
+
+	if _, err := s.UpdateTodo(ctx, root.ID, models.TodoRequest{Name: "root", ListID: inbox.ListID}, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to move todo: %v", err)
+	}
+	for _, id := range []int{child.ID, grandchild.ID} {
+		got, err := s.GetTodoByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ListID != inbox.ListID || got.Version < 2 {
+			t.Errorf("expected subtask %d to move to list %d with its parent, got %+v", id, inbox.ListID, got)
+		}
+	}
+}
+
+func testSubtaskCompletion(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	top, err := s.AddTodo(ctx, models.TodoRequest{Name: "top", AutoComplete: true})
+	if err != nil {
+		t.Fatalf("failed to add todo: %v", err)
+	}
+	parent, err := s.AddTodo(ctx, models.TodoRequest{Name: "parent", ParentID: &top.ID, AutoComplete: true})
+	if err != nil {
+		t.Fatalf("failed to add todo: %v", err)
+	}
+	first := mustAddSubtask(ctx, t, s, "first", parent.ID)
+	second := mustAddSubtask(ctx, t, s, "second", parent.ID)
+	manual := mustAdd(ctx, t, s, "manual")
+	manualChild := mustAddSubtask(ctx, t, s, "manual child", manual.ID)
+
+	if _, err := s.ChangeCompleteStatus(ctx, first.ID, true, false, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to complete todo: %v", err)
+	}
+	got, err := s.GetTodoByID(ctx, parent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Completed {
+		t.Errorf("expected parent to stay open while a subtask is open")
+	}
+
+	if _, err := s.ChangeCompleteStatus(ctx, second.ID, true, false, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to complete todo: %v", err)
+	}
+	for _, todo := range []models.Todo{parent, top} {
+		got, err := s.GetTodoByID(ctx, todo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Completed || got.CompletedAt == nil || got.Version != todo.Version+1 {
+			t.Errorf("expected %q to be completed with a new version, got %+v", todo.Name, got)
+		}
+	}
+
+	if _, err := s.ChangeCompleteStatus(ctx, manualChild.ID, true, false, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to complete todo: %v", err)
+	}
+	got, err = s.GetTodoByID(ctx, manual.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Completed {
+		t.Errorf("expected parent without auto_complete to stay open")
+	}
+}
+
+func testDependencies(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	design := mustAdd(ctx, t, s, "design")
+	build := mustAdd(ctx, t, s, "build")
+	ship := mustAdd(ctx, t, s, "ship")
+
+	if build.BlockedBy == nil || len(build.BlockedBy) != 0 || build.Blocked {
+		t.Errorf("expected new todo to be unblocked, got %+v", build)
+	}
+
+	got, err := s.AddDependency(ctx, build.ID, design.ID, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to add dependency: %v", err)
+	}
+	if !got.Blocked || len(got.BlockedBy) != 1 || got.BlockedBy[0] != design.ID || got.Version != build.Version+1 {
+		t.Errorf("expected build to be blocked by design with a new version, got %+v", got)
+	}
+	again, err := s.AddDependency(ctx, build.ID, design.ID, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to add dependency again: %v", err)
+	}
+	if again.Version != got.Version {
+		t.Errorf("expected adding a dependency twice to change nothing, got version %d", again.Version)
+	}
+	if _, err := s.AddDependency(ctx, ship.ID, build.ID, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to add dependency: %v", err)
+	}
+
+	for _, tt := range []struct{ id, blockerID int }{{design.ID, ship.ID}, {design.ID, build.ID}, {design.ID, design.ID}} {
+		if _, err := s.AddDependency(ctx, tt.id, tt.blockerID, storage.Precondition{}); !errors.Is(err, storage.ErrConflict) {
+			t.Errorf("expected ErrConflict for %d blocked by %d, got %v", tt.id, tt.blockerID, err)
+		}
+	}
+	if _, err := s.AddDependency(ctx, build.ID, 999, storage.Precondition{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for missing blocker, got %v", err)
+	}
+
+	if _, err := s.ChangeCompleteStatus(ctx, build.ID, true, false, storage.Precondition{}); !errors.Is(err, storage.ErrBlocked) {
+		t.Errorf("expected ErrBlocked completing a blocked todo, got %v", err)
+	}
+
+	before, err := s.GetTodoByID(ctx, build.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ChangeCompleteStatus(ctx, design.ID, true, false, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to complete todo: %v", err)
+	}
+	after, err := s.GetTodoByID(ctx, build.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Blocked || after.Version != before.Version+1 {
+		t.Errorf("expected build to be unblocked with a new version, got %+v", after)
+	}
+
+	forced, err := s.ChangeCompleteStatus(ctx, ship.ID, true, true, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to force completion: %v", err)
+	}
+	if !forced.Completed {
+		t.Errorf("expected forced todo to be completed")
+	}
+
+	removed, err := s.RemoveDependency(ctx, ship.ID, build.ID, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to remove dependency: %v", err)
+	}
+	if len(removed.BlockedBy) != 0 || removed.Blocked {
+		t.Errorf("expected ship to be unblocked, got %+v", removed)
+	}
+	if _, err := s.RemoveDependency(ctx, ship.ID, build.ID, storage.Precondition{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound removing twice, got %v", err)
+	}
+
+	if _, err := s.AddDependency(ctx, ship.ID, build.ID, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to add dependency: %v", err)
+	}
+	if err := s.DeleteTodo(ctx, build.ID, false, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to delete todo: %v", err)
+	}
+	got, err = s.GetTodoByID(ctx, ship.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.BlockedBy) != 0 || got.Blocked {
+		t.Errorf("expected deleted blocker to be dropped, got %+v", got)
+	}
+}
+
+func testRecurrence(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	dueAt := "2025-06-02T09:00:00Z"
+	standup, err := s.AddTodo(ctx, models.TodoRequest{Name: "standup", Priority: models.PriorityHigh, DueAt: &dueAt, RRule: "FREQ=DAILY;COUNT=2"})
+	if err != nil {
+		t.Fatalf("failed to add recurring todo: %v", err)
+	}
+	if standup.RRule != "FREQ=DAILY;COUNT=2" {
+		t.Errorf("expected rrule to be stored, got %q", standup.RRule)
+	}
+	tag := mustAddTag(ctx, t, s, "meetings")
+	if _, err := s.AttachTag(ctx, standup.ID, tag.ID, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to attach tag: %v", err)
+	}
+
+	completed, err := s.ChangeCompleteStatus(ctx, standup.ID, true, false, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to complete recurring todo: %v", err)
+	}
+	if completed.RRule != "FREQ=DAILY;COUNT=2" {
+		t.Errorf("expected completed occurrence to keep its rule, got %q", completed.RRule)
+	}
+	reopened, err := s.ChangeCompleteStatus(ctx, standup.ID, false, false, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to reopen recurring todo: %v", err)
+	}
+	if reopened.RRule != "FREQ=DAILY;COUNT=2" {
+		t.Errorf("expected reopened occurrence to keep its rule, got %q", reopened.RRule)
+	}
+	if _, err := s.ChangeCompleteStatus(ctx, standup.ID, true, false, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to complete recurring todo again: %v", err)
+	}
+
+	completedFalse := false
+	page, err := s.GetTodos(ctx, storage.TodoQuery{Completed: &completedFalse})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Todos) != 1 {
+		t.Fatalf("expected one open occurrence, got %+v", page.Todos)
+	}
+	next := page.Todos[0]
+	want := time.Date(2025, 6, 3, 9, 0, 0, 0, time.UTC)
+	if next.ID == standup.ID || next.DueAt == nil || !sameTime(*next.DueAt, want) {
+		t.Errorf("expected next occurrence due %v, got %+v", want, next)
+	}
+	if next.RRule != "FREQ=DAILY;COUNT=1" || next.Priority != models.PriorityHigh || len(next.Tags) != 1 || next.Tags[0].ID != tag.ID {
+		t.Errorf("expected next occurrence to copy the todo with one occurrence left, got %+v", next)
+	}
+	history, err := s.GetTodoHistory(ctx, next.ID, storage.HistoryQuery{})
+	if err != nil {
+		t.Fatalf("failed to get history: %v", err)
+	}
+	if len(history.Events) != 1 || history.Events[0].Action != models.EventCreated || history.Events[0].TodoID != next.ID {
+		t.Errorf("expected next occurrence to record its creation, got %+v", history.Events)
+	}
+
+	if _, err := s.ChangeCompleteStatus(ctx, next.ID, true, false, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to complete last occurrence: %v", err)
+	}
+	page, err = s.GetTodos(ctx, storage.TodoQuery{Completed: &completedFalse})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNames(t, page.Todos)
+
+	weekly := mustAdd(ctx, t, s, "review")
+	patched, err := s.PatchTodo(ctx, weekly.ID, func(r models.TodoRequest) (models.TodoRequest, error) {
+		r.RRule = "FREQ=WEEKLY"
+		return r, nil
+	}, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to set rrule: %v", err)
+	}
+	if patched.RRule != "FREQ=WEEKLY" {
+		t.Errorf("expected patched rrule, got %q", patched.RRule)
+	}
+	if _, err := s.ChangeCompleteStatus(ctx, weekly.ID, true, false, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to complete todo: %v", err)
+	}
+	page, err = s.GetTodos(ctx, storage.TodoQuery{Completed: &completedFalse})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNames(t, page.Todos, "review")
+	if len(page.Todos) == 1 && (page.Todos[0].DueAt == nil || page.Todos[0].DueAt.Before(time.Now().Add(6*24*time.Hour))) {
+		t.Errorf("expected undated occurrence to be due a week after completion, got %+v", page.Todos[0])
+	}
+}
+
+func testMoveTodo(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+
+	a := mustAdd(ctx, t, s, "a")
+	b := mustAdd(ctx, t, s, "b")
+	c := mustAdd(ctx, t, s, "c")
+	d := mustAdd(ctx, t, s, "d")
+	assertOrder := func(names ...string) {
+		t.Helper()
+		page, err := s.GetTodos(ctx, storage.TodoQuery{Sort: storage.SortRank})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertNames(t, page.Todos, names...)
+		for i := 1; i < len(page.Todos); i++ {
+			if page.Todos[i].Rank <= page.Todos[i-1].Rank {
+				t.Errorf("expected strictly increasing ranks, got %q after %q", page.Todos[i].Rank, page.Todos[i-1].Rank)
+			}
+		}
+	}
+	assertOrder("a", "b", "c", "d")
+
+	moved, err := s.MoveTodo(ctx, d.ID, models.MoveRequest{Before: &a.ID}, storage.Precondition{})
+	if err != nil {
+		t.Fatalf("failed to move todo: %v", err)
+	}
+	if moved.Version != d.Version+1 {
+		t.Errorf("expected moved todo to get a new version, got %d", moved.Version)
+	}
+	assertOrder("d", "a", "b", "c")
+
+	if _, err := s.MoveTodo(ctx, a.ID, models.MoveRequest{After: &c.ID}, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to move todo: %v", err)
+	}
+	assertOrder("d", "b", "c", "a")
+
+	if _, err := s.MoveTodo(ctx, b.ID, models.MoveRequest{After: &c.ID, Before: &a.ID}, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to move todo: %v", err)
+	}
+	assertOrder("d", "c", "b", "a")
+
+	page, err := s.GetTodos(ctx, storage.TodoQuery{Sort: storage.SortRank, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err = s.GetTodos(ctx, storage.TodoQuery{Sort: storage.SortRank, Limit: 2, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNames(t, page.Todos, "b", "a")
+
+	if _, err := s.MoveTodo(ctx, b.ID, models.MoveRequest{After: &a.ID, Before: &d.ID}, storage.Precondition{}); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict moving after a todo that comes later, got %v", err)
+	}
+	if _, err := s.MoveTodo(ctx, b.ID, models.MoveRequest{Before: &b.ID}, storage.Precondition{}); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict moving next to itself, got %v", err)
+	}
+	if _, err := s.MoveTodo(ctx, b.ID, models.MoveRequest{After: intPtr(999)}, storage.Precondition{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound moving next to a missing todo, got %v", err)
+	}
+	if _, err := s.MoveTodo(ctx, 999, models.MoveRequest{After: &a.ID}, storage.Precondition{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound moving a missing todo, got %v", err)
+	}
+	if _, err := s.MoveTodo(ctx, b.ID, models.MoveRequest{After: &a.ID}, storage.Precondition{IfMatch: []int{1}}); !errors.Is(err, storage.ErrPreconditionFailed) {
+		t.Errorf("expected ErrPreconditionFailed, got %v", err)
+	}
+
+	// Moving two todos around each other keeps halving the gap before a,
+	// until ranks are spread out again.
+	for i := 0; i < 100; i++ {
+		if _, err := s.MoveTodo(ctx, c.ID, models.MoveRequest{After: &b.ID}, storage.Precondition{}); err != nil {
+			t.Fatalf("failed to move todo: %v", err)
+		}
+		if _, err := s.MoveTodo(ctx, b.ID, models.MoveRequest{After: &c.ID}, storage.Precondition{}); err != nil {
+			t.Fatalf("failed to move todo: %v", err)
+		}
+	}
+	assertOrder("d", "c", "b", "a")
+	got, err := s.GetTodoByID(ctx, b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Rank) > 24 {
+		t.Errorf("expected ranks to be spread out again, got %q", got.Rank)
+	}
+
+	e := mustAdd(ctx, t, s, "e")
+	if e.Rank <= got.Rank {
+		t.Errorf("expected new todo to be ranked last, got %q", e.Rank)
+	}
+}
+
+func testUsers(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+
+	user, err := s.AddUser(ctx, " Alice@Example.com", "hash")
+	if err != nil {
+		t.Fatalf("failed to add user: %v", err)
+	}
+	if user.ID == 0 || user.Email != "alice@example.com" || user.PasswordHash != "hash" || user.CreatedAt.IsZero() {
+		t.Errorf("unexpected user %+v", user)
+	}
+	if _, err := s.AddUser(ctx, "ALICE@example.com", "other"); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict for a taken email, got %v", err)
+	}
+
+	got, err := s.GetUserByEmail(ctx, "alice@EXAMPLE.com")
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if got.ID != user.ID || got.PasswordHash != "hash" {
+		t.Errorf("expected %+v, got %+v", user, got)
+	}
+	if _, err := s.GetUserByEmail(ctx, "bob@example.com"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown email, got %v", err)
+	}
+
+	lists, err := s.GetLists(storage.WithOwner(ctx, user.ID))
+	if err != nil {
+		t.Fatalf("failed to get lists: %v", err)
+	}
+	if len(lists) != 1 || !lists[0].Default || lists[0].Name != storage.DefaultListName || lists[0].OwnerID != user.ID {
+		t.Errorf("expected a default list for the new user, got %+v", lists)
+	}
+
+	if _, err := s.GetTodos(ctx, storage.TodoQuery{}); !errors.Is(err, storage.ErrUnauthenticated) {
+		t.Errorf("expected ErrUnauthenticated without an owner, got %v", err)
+	}
+	if _, err := s.AddTodo(ctx, models.TodoRequest{Name: "a"}); !errors.Is(err, storage.ErrUnauthenticated) {
+		t.Errorf("expected ErrUnauthenticated without an owner, got %v", err)
+	}
+}
+
+func testOwnership(t *testing.T, s storage.Store) {
+	alice := userContext(t, s, "alice@example.com")
+	bob := userContext(t, s, "bob@example.com")
+
+	todo := mustAdd(alice, t, s, "a")
+	tag := mustAddTag(alice, t, s, "work")
+	list, err := s.AddList(alice, models.ListRequest{Name: "Sprint"})
+	if err != nil {
+		t.Fatalf("failed to add list: %v", err)
+	}
+	if todo.OwnerID == 0 || list.OwnerID != todo.OwnerID {
+		t.Errorf("expected todo and list to be owned by alice, got %+v and %+v", todo, list)
+	}
+
+	page, err := s.GetTodos(bob, storage.TodoQuery{})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	assertNames(t, page.Todos)
+	if results, err := s.SearchTodos(bob, "a", 10); err != nil || len(results) != 0 {
+		t.Errorf("expected no search results for bob, got %+v, %v", results, err)
+	}
+	if tags, err := s.GetTags(bob); err != nil || len(tags) != 0 {
+		t.Errorf("expected no tags for bob, got %+v, %v", tags, err)
+	}
+	if lists, err := s.GetLists(bob); err != nil || len(lists) != 1 || !lists[0].Default {
+		t.Errorf("expected only bob's default list, got %+v, %v", lists, err)
+	}
+
+	notFound := map[string]error{}
+	_, notFound["GetTodoByID"] = s.GetTodoByID(bob, todo.ID)
+	_, notFound["GetChildren"] = s.GetChildren(bob, todo.ID)
+	_, notFound["GetTodoTree"] = s.GetTodoTree(bob, todo.ID)
+	_, notFound["GetTodoHistory"] = s.GetTodoHistory(bob, todo.ID, storage.HistoryQuery{})
+	_, notFound["UpdateTodo"] = s.UpdateTodo(bob, todo.ID, models.TodoRequest{Name: "b"}, storage.Precondition{})
+	_, notFound["ChangeEnableStatus"] = s.ChangeEnableStatus(bob, todo.ID, false, storage.Precondition{})
+	_, notFound["ChangeCompleteStatus"] = s.ChangeCompleteStatus(bob, todo.ID, true, false, storage.Precondition{})
+	_, notFound["MoveTodo"] = s.MoveTodo(bob, todo.ID, models.MoveRequest{}, storage.Precondition{})
+	notFound["DeleteTodo"] = s.DeleteTodo(bob, todo.ID, true, storage.Precondition{})
+	_, notFound["GetTagByID"] = s.GetTagByID(bob, tag.ID)
+	_, notFound["UpdateTag"] = s.UpdateTag(bob, tag.ID, models.TagRequest{Name: "home"})
+	notFound["DeleteTag"] = s.DeleteTag(bob, tag.ID)
+	_, notFound["GetListByID"] = s.GetListByID(bob, list.ID)
+	_, notFound["UpdateList"] = s.UpdateList(bob, list.ID, models.ListRequest{Name: "Mine"})
+	notFound["DeleteList"] = s.DeleteList(bob, list.ID)
+	_, notFound["GetTodos"] = s.GetTodos(bob, storage.TodoQuery{ListID: list.ID})
+	_, notFound["AddTodo list"] = s.AddTodo(bob, models.TodoRequest{Name: "b", ListID: list.ID})
+	_, notFound["AddTodo parent"] = s.AddTodo(bob, models.TodoRequest{Name: "b", ParentID: &todo.ID})
+	for name, err := range notFound {
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("%s: expected ErrNotFound for another user's data, got %v", name, err)
+		}
+	}
+
+	mine := mustAdd(bob, t, s, "b")
+	if _, err := s.AttachTag(bob, mine.ID, tag.ID, storage.Precondition{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound attaching another user's tag, got %v", err)
+	}
+	if _, err := s.AddDependency(bob, mine.ID, todo.ID, storage.Precondition{}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound depending on another user's todo, got %v", err)
+	}
+	if _, err := s.AddTag(bob, models.TagRequest{Name: "work"}); err != nil {
+		t.Errorf("expected tag names to be unique per user, got %v", err)
+	}
+	if _, err := s.Undo(bob, 1); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected bob to have nothing to undo, got %v", err)
+	}
+
+	got, err := s.GetTodoByID(alice, todo.ID)
+	if err != nil {
+		t.Fatalf("failed to get todo: %v", err)
+	}
+	if got.Version != todo.Version || got.Name != "a" {
+		t.Errorf("expected alice's todo to be untouched, got %+v", got)
+	}
+}
+
+func testAppendRankLength(t *testing.T, s storage.Store) {
+	ctx := userContext(t, s, "alice@example.com")
+	// Enough appends to grow a rank past its maximum length of 24 digits.
+	const n = 1000
+
+	for i := 0; i < n; i++ {
+		if _, err := s.AddTodo(ctx, models.TodoRequest{Name: fmt.Sprintf("todo %d", i)}); err != nil {
+			t.Fatalf("failed to add todo %d: %v", i, err)
+		}
+	}
+
+	var todos []models.Todo
+	query := storage.TodoQuery{Sort: storage.SortRank, Limit: storage.MaxTodoLimit}
+	for {
+		page, err := s.GetTodos(ctx, query)
+		if err != nil {
+			t.Fatalf("failed to get todos: %v", err)
+		}
+		todos = append(todos, page.Todos...)
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	if len(todos) != n {
+		t.Fatalf("expected %d todos, got %d", n, len(todos))
+	}
+	for i, todo := range todos {
+		if want := fmt.Sprintf("todo %d", i); todo.Name != want {
+			t.Fatalf("expected %q at position %d, got %q", want, i, todo.Name)
+		}
+		if len(todo.Rank) > 24 {
+			t.Errorf("expected rank of at most 24 digits, got %q", todo.Rank)
+		}
+	}
+}
+
+func mustAddSubtask(ctx context.Context, t *testing.T, s storage.Store, name string, parentID int) models.Todo {
+	t.Helper()
+	todo, err := s.AddTodo(ctx, models.TodoRequest{Name: name, ParentID: &parentID})
+	if err != nil {
+		t.Fatalf("failed to add subtask %q: %v", name, err)
+	}
+	return todo
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func mustAdd(ctx context.Context, t *testing.T, s storage.Storage, name string) models.Todo {
+	t.Helper()
+	todo, err := s.AddTodo(ctx, models.TodoRequest{Name: name, Description: name + " description"})
+	if err != nil {
+		t.Fatalf("failed to add todo %q: %v", name, err)
+	}
+	return todo
+}
+
+func testAPIKeys(t *testing.T, s storage.Store) {
+	alice := userContext(t, s, "alice@example.com")
+	bob := userContext(t, s, "bob@example.com")
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	expired := now.Add(-time.Hour)
+
+	key, err := s.AddAPIKey(alice, models.APIKey{Name: "backup", Prefix: "gtd_abc", Scope: models.ScopeRead}, "hash1")
+	if err != nil {
+		t.Fatalf("failed to add API key: %v", err)
+	}
+	if key.ID == 0 || key.OwnerID == 0 || key.Name != "backup" || key.Scope != models.ScopeRead || key.CreatedAt.IsZero() || key.LastUsedAt != nil {
+		t.Errorf("unexpected API key %+v", key)
+	}
+	if _, err := s.AddAPIKey(alice, models.APIKey{Name: "old", Prefix: "gtd_def", Scope: models.ScopeReadWrite, ExpiresAt: &expired}, "hash2"); err != nil {
+		t.Fatalf("failed to add API key: %v", err)
+	}
+
+	keys, err := s.GetAPIKeys(alice)
+	if err != nil {
+		t.Fatalf("failed to get API keys: %v", err)
+	}
+	if len(keys) != 2 || keys[0].ID != key.ID || keys[1].ExpiresAt == nil {
+		t.Errorf("expected both API keys of alice, got %+v", keys)
+	}
+	if keys, err := s.GetAPIKeys(bob); err != nil || len(keys) != 0 {
+		t.Errorf("expected no API keys for bob, got %+v, %v", keys, err)
+	}
+
+	used, err := s.UseAPIKey(context.Background(), "hash1", now)
+	if err != nil {
+		t.Fatalf("failed to use API key: %v", err)
+	}
+	if used.ID != key.ID || used.OwnerID != key.OwnerID || used.LastUsedAt == nil || !used.LastUsedAt.Equal(now) {
+		t.Errorf("expected API key %d used at %v, got %+v", key.ID, now, used)
+	}
+	if _, err := s.UseAPIKey(context.Background(), "hash2", now); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an expired API key, got %v", err)
+	}
+	if _, err := s.UseAPIKey(context.Background(), "unknown", now); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown API key, got %v", err)
+	}
+
+	if err := s.DeleteAPIKey(bob, key.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for another user's API key, got %v", err)
+	}
+	if err := s.DeleteAPIKey(alice, key.ID); err != nil {
+		t.Fatalf("failed to delete API key: %v", err)
+	}
+	if _, err := s.UseAPIKey(context.Background(), "hash1", now); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a revoked API key, got %v", err)
+	}
+	if err := s.DeleteAPIKey(alice, key.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a deleted API key, got %v", err)
+	}
+}
+
+func testSharing(t *testing.T, s storage.Store) {
+	alice := userContext(t, s, "alice@example.com")
+	bob := userContext(t, s, "bob@example.com")
+	carol := userContext(t, s, "carol@example.com")
+
+	list, err := s.AddList(alice, models.ListRequest{Name: "Team"})
+	if err != nil {
+		t.Fatalf("failed to add list: %v", err)
+	}
+	todo, err := s.AddTodo(alice, models.TodoRequest{ListID: list.ID, Name: "shared", Description: "shared"})
+	if err != nil {
+		t.Fatalf("failed to add todo: %v", err)
+	}
+	private := mustAdd(alice, t, s, "private")
+
+	if _, err := s.ListAccess(bob, list.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound before sharing, got %v", err)
+	}
+	share, err := s.ShareList(alice, list.ID, "Bob@example.com", models.RoleViewer)
+	if err != nil {
+		t.Fatalf("failed to share list: %v", err)
+	}
+	if share.ListID != list.ID || share.UserID == 0 || share.Email != "bob@example.com" || share.Role != models.RoleViewer || share.CreatedAt.IsZero() {
+		t.Errorf("unexpected share %+v", share)
+	}
+	if _, err := s.ShareList(alice, list.ID, "alice@example.com", models.RoleEditor); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict sharing with the owner, got %v", err)
+	}
+	if _, err := s.ShareList(alice, list.ID, "dave@example.com", models.RoleEditor); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound sharing with an unknown user, got %v", err)
+	}
+	if _, err := s.ShareList(bob, list.ID, "carol@example.com", models.RoleEditor); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound sharing another user's list, got %v", err)
+	}
+
+	owner := models.Access{OwnerID: todo.OwnerID, Role: models.RoleOwner}
+	viewer := models.Access{OwnerID: todo.OwnerID, Role: models.RoleViewer}
+	if access, err := s.ListAccess(alice, list.ID); err != nil || access != owner {
+		t.Errorf("expected %+v for the owner, got %+v, %v", owner, access, err)
+	}
+	if access, err := s.ListAccess(bob, list.ID); err != nil || access != viewer {
+		t.Errorf("expected %+v for bob, got %+v, %v", viewer, access, err)
+	}
+	if access, err := s.TodoAccess(bob, todo.ID); err != nil || access != viewer {
+		t.Errorf("expected %+v for bob, got %+v, %v", viewer, access, err)
+	}
+	if _, err := s.TodoAccess(bob, private.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a todo in another list, got %v", err)
+	}
+	if _, err := s.TodoAccess(carol, todo.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for carol, got %v", err)
+	}
+	if err := s.DeleteTodo(alice, todo.ID, false, storage.Precondition{}); err != nil {
+		t.Fatalf("failed to trash todo: %v", err)
+	}
+	if access, err := s.TodoAccess(bob, todo.ID); err != nil || access != viewer {
+		t.Errorf("expected %+v for a todo in the trash, got %+v, %v", viewer, access, err)
+	}
+
+	if _, err := s.ShareList(alice, list.ID, "bob@example.com", models.RoleEditor); err != nil {
+		t.Fatalf("failed to change role: %v", err)
+	}
+	if _, err := s.ShareList(alice, list.ID, "carol@example.com", models.RoleOwner); err != nil {
+		t.Fatalf("failed to share list: %v", err)
+	}
+	shares, err := s.GetShares(alice, list.ID)
+	if err != nil {
+		t.Fatalf("failed to get shares: %v", err)
+	}
+	if len(shares) != 2 || shares[0].Email != "bob@example.com" || shares[0].Role != models.RoleEditor || shares[1].Role != models.RoleOwner {
+		t.Errorf("expected bob as editor and carol as owner, got %+v", shares)
+	}
+	if _, err := s.GetShares(bob, list.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for the shares of another user's list, got %v", err)
+	}
+	shared, err := s.GetSharedLists(bob)
+	if err != nil {
+		t.Fatalf("failed to get shared lists: %v", err)
+	}
+	if len(shared) != 1 || shared[0].ID != list.ID || shared[0].Name != "Team" || shared[0].Role != models.RoleEditor {
+		t.Errorf("expected the list shared with bob as editor, got %+v", shared)
+	}
+	if shared, err := s.GetSharedLists(alice); err != nil || len(shared) != 0 {
+		t.Errorf("expected no lists shared with alice, got %+v, %v", shared, err)
+	}
+
+	if err := s.UnshareList(bob, list.ID, share.UserID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound unsharing another user's list, got %v", err)
+	}
+	if err := s.UnshareList(alice, list.ID, share.UserID); err != nil {
+		t.Fatalf("failed to unshare list: %v", err)
+	}
+	if _, err := s.ListAccess(bob, list.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after unsharing, got %v", err)
+	}
+	if err := s.UnshareList(alice, list.ID, share.UserID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound unsharing again, got %v", err)
+	}
+
+	if err := s.DeleteList(alice, list.ID); err != nil {
+		t.Fatalf("failed to delete list: %v", err)
+	}
+	if _, err := s.ListAccess(carol, list.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a deleted list, got %v", err)
+	}
+}
+
+// userContext registers a user with the given email and returns a context
+// acting for it.
+func userContext(t *testing.T, s storage.Store, email string) context.Context {
+	t.Helper()
+	user, err := s.AddUser(context.Background(), email, "hash")
+	if err != nil {
+		t.Fatalf("failed to add user %q: %v", email, err)
+	}
+	return storage.WithOwner(context.Background(), user.ID)
+}
+
+// assertNames checks that todos have exactly the given names, in order.
+func assertNames(t *testing.T, todos []models.Todo, names ...string) {
+	t.Helper()
+	got := make([]string, 0, len(todos))
+	for _, todo := range todos {
+		got = append(got, todo.Name)
+	}
+	if strings.Join(got, ",") != strings.Join(names, ",") {
+		t.Errorf("expected todos [%s], got [%s]", strings.Join(names, ","), strings.Join(got, ","))
+	}
+}
+
+// sameTime compares timestamps loosely, since databases may store them
+// with less precision than time.Now.
+func sameTime(a, b time.Time) bool {
+	d := a.Sub(b)
+	return d > -time.Millisecond && d < time.Millisecond
+}
+
+// pause makes sure the next mutation gets a strictly later timestamp.
+func pause() {
+	time.Sleep(5 * time.Millisecond)
+}
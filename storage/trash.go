@@ -0,0 +1,38 @@
+package storage
+
+import "time"
+
+// trashFilter selects todos by whether they are in the trash. Reads and
+// most mutations only consider live todos.
+type trashFilter int
+
+const (
+	liveTodos trashFilter = iota
+	trashedTodos
+	anyTodos
+)
+
+// matches reports whether a todo with the given deletion time passes the
+// filter.
+func (f trashFilter) matches(deletedAt *time.Time) bool {
+	switch f {
+	case liveTodos:
+		return deletedAt == nil
+	case trashedTodos:
+		return deletedAt != nil
+	default:
+		return true
+	}
+}
+
+// sql returns the filter as a condition on the todos table.
+func (f trashFilter) sql() string {
+	switch f {
+	case liveTodos:
+		return "deleted_at IS NULL"
+	case trashedTodos:
+		return "deleted_at IS NOT NULL"
+	default:
+		return "TRUE"
+	}
+}
@@ -0,0 +1,31 @@
+package storage
+
+import "github.com/cmgchess/gotodo/models"
+
+// buildTree assembles the tree rooted at rootID from todos, which must hold
+// the root and all of its descendants in the order children should appear.
+func buildTree(rootID int, todos []models.Todo) *models.TodoTree {
+	children := make(map[int][]models.Todo)
+	var root *models.Todo
+	for i, todo := range todos {
+		if todo.ID == rootID {
+			root = &todos[i]
+		} else if todo.ParentID != nil {
+			children[*todo.ParentID] = append(children[*todo.ParentID], todo)
+		}
+	}
+	if root == nil {
+		return nil
+	}
+
+	var build func(todo models.Todo) models.TodoTree
+	build = func(todo models.Todo) models.TodoTree {
+		tree := models.TodoTree{Todo: todo, Children: make([]models.TodoTree, 0, len(children[todo.ID]))}
+		for _, child := range children[todo.ID] {
+			tree.Children = append(tree.Children, build(child))
+		}
+		return tree
+	}
+	tree := build(*root)
+	return &tree
+}
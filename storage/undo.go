@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/cmgchess/gotodo/models"
+)
+
+// UndoDepth is how many changes the undo stack keeps. Older ones can no
+// longer be undone.
+const UndoDepth = 50
+
+// undoFields lists, for each action that can be undone, the todo fields
+// undoing or redoing it restores. Other fields the change touched, such as
+// the completion time, follow from them. Undoing a completion keeps the next
+// occurrence of a recurring todo, which redoing it does not create again.
+var undoFields = map[string][]string{
+	models.EventUpdated:   {"list_id", "parent_id", "name", "description", "priority", "due_at", "auto_complete", "rrule"},
+	models.EventEnabled:   {"enabled"},
+	models.EventDisabled:  {"enabled"},
+	models.EventCompleted: {"completed"},
+	models.EventReopened:  {"completed"},
+	models.EventTrashed:   {"deleted_at"},
+}
+
+// undoable reports whether changes recorded as action go on the undo stack.
+func undoable(action string) bool {
+	_, ok := undoFields[action]
+	return ok
+}
+
+type undoContextKey struct{}
+
+// withoutUndo marks changes made with ctx as undoing or redoing another one,
+// so that they are recorded in the history but leave the undo stack alone.
+func withoutUndo(ctx context.Context) context.Context {
+	return context.WithValue(ctx, undoContextKey{}, true)
+}
+
+// undoing reports whether ctx was marked by withoutUndo.
+func undoing(ctx context.Context) bool {
+	v, _ := ctx.Value(undoContextKey{}).(bool)
+	return v
+}
+
+// undoStack is the undo stack a backend keeps of the changes recorded for
+// undoable actions. Recording a new one drops the changes undone so far,
+// which can then no longer be redone.
+type undoStack interface {
+	// nextChange returns the change the next undo reverts, or the next redo
+	// applies again if undone is set. ok is false if there is none.
+	nextChange(ctx context.Context, undone bool) (entry int, event models.TodoEvent, ok bool, err error)
+	// markChange moves a change to the undone part of the stack or back.
+	markChange(ctx context.Context, entry int, undone bool) error
+	// dropChange removes a change that can no longer be undone or redone.
+	dropChange(ctx context.Context, entry int) error
+	// anyTodo returns a todo whether it is in the trash or not.
+	anyTodo(ctx context.Context, id int) (*models.Todo, error)
+	// TodoAccess is ShareStorage.TodoAccess.
+	TodoAccess(ctx context.Context, todoID int) (models.Access, error)
+	// undoStep runs fn as one atomic step of an undo or redo, on a storage
+	// and stack no other step of the user ctx acts for can change
+	// meanwhile. Nothing fn did is kept if it fails.
+	undoStep(ctx context.Context, fn func(s Storage, stack undoStack) error) error
+}
+
+// undoChanges undoes, or redoes if redo is set, the last n changes on the
+// stack and returns them in the order they were reverted. It stops at the
+// first change that fails, dropping it from the stack if the todo changed
+// since so that the next attempt moves past it.
+func undoChanges(ctx context.Context, stack undoStack, n int, redo bool) ([]models.TodoEvent, error) {
+	done := make([]models.TodoEvent, 0, n)
+	for len(done) < n {
+		event, ok, err := undoChange(ctx, stack, redo)
+		if err != nil {
+			if len(done) > 0 {
+				return done, fmt.Errorf("%d of %d changes reverted: %w", len(done), n, err)
+			}
+			return done, err
+		}
+		if !ok {
+			if len(done) == 0 {
+				return done, nothingToUndo(redo)
+			}
+			break
+		}
+		done = append(done, event)
+	}
+	return done, nil
+}
+
+// undoChange undoes, or redoes if redo is set, the change on top of the
+// stack in one undo step. ok is false if there is none. A change that fails
+// because the todo changed since, or is no longer shared with its actor, is
+// dropped from the stack.
+func undoChange(ctx context.Context, stack undoStack, redo bool) (event models.TodoEvent, ok bool, err error) {
+	var revertErr error
+	err = stack.undoStep(ctx, func(s Storage, stack undoStack) error {
+		var entry int
+		entry, event, ok, err = stack.nextChange(ctx, redo)
+		if err != nil || !ok {
+			return err
+		}
+		revertErr = revertShared(ctx, s, stack, event, redo)
+		if revertErr == nil {
+			return stack.markChange(ctx, entry, !redo)
+		}
+		if errors.Is(revertErr, ErrConflict) || errors.Is(revertErr, ErrNotFound) || errors.Is(revertErr, ErrAlreadyInState) || errors.Is(revertErr, ErrBlocked) || errors.Is(revertErr, ErrForbidden) {
+			return stack.dropChange(ctx, entry)
+		}
+		return revertErr
+	})
+	if err != nil {
+		return event, ok, err
+	}
+	return event, ok, revertErr
+}
+
+// revertShared reverts a change its actor made with ctx as revertChange
+// does, acting for the owner of the todo if it was shared with them. That
+// takes the editor role on the todo still.
+func revertShared(ctx context.Context, s Storage, stack undoStack, event models.TodoEvent, redo bool) error {
+	actorID := actor(ctx)
+	if event.OwnerID != actorID {
+		access, err := stack.TodoAccess(WithOwner(ctx, actorID), event.TodoID)
+		if err != nil {
+			return err
+		}
+		if !access.Allows(models.RoleEditor) {
+			return revertForbidden(event.TodoID)
+		}
+	}
+	ctx = WithOwner(WithActor(ctx, actorID), event.OwnerID)
+	return revertChange(withoutUndo(ctx), s, stack, event, redo)
+}
+
+// revertChange sets the fields of the todo event touched back to how they
+// were before it, or forward to how it left them if redo is set. The todo
+// must still hold the values the other side of the change gave it.
+func revertChange(ctx context.Context, s Storage, stack undoStack, event models.TodoEvent, redo bool) error {
+	from, to := event.After, event.Before
+	if redo {
+		from, to = to, from
+	}
+	current, err := stack.anyTodo(ctx, event.TodoID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return changedSince(event.TodoID, event.Action)
+		}
+		return err
+	}
+	var fromFields, toFields map[string]json.RawMessage
+	if err := json.Unmarshal(from, &fromFields); err != nil {
+		return fmt.Errorf("failed to decode todo event %d: %w", event.ID, err)
+	}
+	if err := json.Unmarshal(to, &toFields); err != nil {
+		return fmt.Errorf("failed to decode todo event %d: %w", event.ID, err)
+	}
+	currentFields := todoFields(current)
+	restored := make(map[string]json.RawMessage)
+	for _, key := range undoFields[event.Action] {
+		value, ok := toFields[key]
+		if !ok {
+			continue
+		}
+		if !jsonEqual(currentFields[key], fromFields[key]) {
+			return changedSince(event.TodoID, event.Action)
+		}
+		restored[key] = value
+	}
+	target := *current
+	maps.Copy(currentFields, restored)
+	b, _ := json.Marshal(currentFields)
+	if err := json.Unmarshal(b, &target); err != nil {
+		return fmt.Errorf("failed to decode todo event %d: %w", event.ID, err)
+	}
+
+	pre := Precondition{IfMatch: []int{current.Version}}
+	switch event.Action {
+	case models.EventUpdated:
+		_, err = s.PatchTodo(ctx, current.ID, func(models.TodoRequest) (models.TodoRequest, error) {
+			return target.Request(), nil
+		}, pre)
+	case models.EventEnabled, models.EventDisabled:
+		_, err = s.ChangeEnableStatus(ctx, current.ID, target.Enabled, pre)
+	case models.EventCompleted, models.EventReopened:
+		_, err = s.ChangeCompleteStatus(ctx, current.ID, target.Completed, true, pre)
+	case models.EventTrashed:
+		if target.DeletedAt == nil {
+			_, err = s.RestoreTodo(ctx, current.ID, pre)
+		} else {
+			err = s.DeleteTodo(ctx, current.ID, false, pre)
+		}
+	}
+	if errors.Is(err, ErrPreconditionFailed) {
+		return changedSince(event.TodoID, event.Action)
+	}
+	return err
+}
+
+// jsonEqual reports whether two JSON values are equal, whatever their
+// formatting.
+func jsonEqual(a, b json.RawMessage) bool {
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return slices.Equal(a, b)
+	}
+	xb, _ := json.Marshal(x)
+	yb, _ := json.Marshal(y)
+	return slices.Equal(xb, yb)
+}
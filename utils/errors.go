@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/cmgchess/gotodo/storage"
+)
+
+// StatusFromError maps an error returned by storage to an HTTP status code.
+func StatusFromError(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrConflict), errors.Is(err, storage.ErrAlreadyInState), errors.Is(err, storage.ErrBlocked):
+		return http.StatusConflict
+	case errors.Is(err, storage.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, storage.ErrInvalidCursor):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, storage.ErrForbidden):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// StorageError writes err with the status from StatusFromError. Unexpected
+// errors are logged and replaced with a generic message so that database
+// details never reach the client.
+func StorageError(w http.ResponseWriter, r *http.Request, err error) {
+	status := StatusFromError(err)
+	if status == http.StatusInternalServerError {
+		log.Printf("storage error: %v", err)
+		err = errors.New("internal server error")
+	}
+	Error(w, r, status, err)
+}
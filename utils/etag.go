@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cmgchess/gotodo/storage"
+)
+
+// ETag returns the strong entity tag for a todo at version.
+func ETag(version int) string {
+	return fmt.Sprintf("%q", strconv.Itoa(version))
+}
+
+// ParsePrecondition reads the If-Match and If-None-Match headers of r.
+// Entity tags that were not produced by ETag never match.
+func ParsePrecondition(r *http.Request) storage.Precondition {
+	var pre storage.Precondition
+
+	if tags := entityTags(r.Header.Values("If-Match")); tags != nil {
+		if !(len(tags) == 1 && tags[0] == "*") {
+			pre.IfMatch = make([]int, 0, len(tags))
+			for _, tag := range tags {
+				// If-Match uses the strong comparison, so weak tags never match.
+				if version, ok := parseETag(tag); ok {
+					pre.IfMatch = append(pre.IfMatch, version)
+				}
+			}
+		}
+	}
+
+	for _, tag := range entityTags(r.Header.Values("If-None-Match")) {
+		if tag == "*" {
+			pre.IfNoneMatchAny = true
+			continue
+		}
+		if version, ok := parseETag(strings.TrimPrefix(tag, "W/")); ok {
+			pre.IfNoneMatch = append(pre.IfNoneMatch, version)
+		}
+	}
+
+	return pre
+}
+
+func entityTags(values []string) []string {
+	var tags []string
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+func parseETag(tag string) (int, bool) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+	return version, err == nil
+}
@@ -8,6 +8,11 @@ import (
 )
 
 func ParseIDFromRequest(r *http.Request) (int, error) {
+	return ParseIntVarFromRequest(r, "id")
+}
+
+// ParseIntVarFromRequest parses the named route variable as an int.
+func ParseIntVarFromRequest(r *http.Request, name string) (int, error) {
 	vars := mux.Vars(r)
-	return strconv.Atoi(vars["id"])
+	return strconv.Atoi(vars[name])
 }
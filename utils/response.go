@@ -5,12 +5,41 @@ import (
 	"net/http"
 )
 
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
 func JSON(w http.ResponseWriter, status int, data any) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(data)
+	writeJSON(w, status, "application/json", data)
+}
+
+// Error writes err as an application/problem+json response about r.
+func Error(w http.ResponseWriter, r *http.Request, status int, err error) {
+	WriteProblem(w, NewProblem(r, status, err.Error()))
 }
 
-func Error(w http.ResponseWriter, status int, err error) {
-	JSON(w, status, map[string]string{"error": err.Error()})
+func NewProblem(r *http.Request, status int, detail string) Problem {
+	return Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.RequestURI(),
+	}
+}
+
+func WriteProblem(w http.ResponseWriter, p Problem) {
+	writeJSON(w, p.Status, "application/problem+json", p)
+}
+
+func writeJSON(w http.ResponseWriter, status int, contentType string, data any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
 }
@@ -1,13 +1,109 @@
 package utils
 
-import "github.com/go-playground/validator/v10"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/cmgchess/gotodo/models"
+	"github.com/go-playground/validator/v10"
+)
 
 var validate *validator.Validate
 
 func init() {
 	validate = validator.New()
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	validate.RegisterValidation("rrule", func(fl validator.FieldLevel) bool {
+		_, err := models.ParseRRule(fl.Field().String())
+		return err == nil
+	})
+	validate.RegisterValidation("maxbytes", func(fl validator.FieldLevel) bool {
+		n, err := strconv.Atoi(fl.Param())
+		return err == nil && len(fl.Field().String()) <= n
+	})
+}
+
+// FieldError describes one failed validation rule of a request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Tag     string `json:"tag"`
+	Limit   string `json:"limit,omitempty"`
+	Message string `json:"message"`
 }
 
 func ValidateStruct(s any) error {
 	return validate.Struct(s)
 }
+
+// ValidationError writes a 400 problem listing every field of err, which
+// is expected to come from ValidateStruct.
+func ValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		Error(w, r, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", err))
+		return
+	}
+
+	p := NewProblem(r, http.StatusBadRequest, "invalid payload")
+	for _, fe := range validationErrors {
+		p.Errors = append(p.Errors, FieldError{
+			Field:   fe.Field(),
+			Tag:     fe.Tag(),
+			Limit:   fe.Param(),
+			Message: fieldMessage(fe),
+		})
+	}
+	WriteProblem(w, p)
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", fe.Field())
+	case "min":
+		return fmt.Sprintf("%s must %s", fe.Field(), sizeLimit(fe, "at least"))
+	case "max":
+		return fmt.Sprintf("%s must %s", fe.Field(), sizeLimit(fe, "at most"))
+	case "maxbytes":
+		return fmt.Sprintf("%s must be at most %s long", fe.Field(), count(fe.Param(), "byte"))
+	case "datetime":
+		return fmt.Sprintf("%s must be an RFC 3339 timestamp", fe.Field())
+	case "rrule":
+		return fmt.Sprintf("%s must be an RFC 5545 recurrence rule", fe.Field())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", fe.Field(), strings.ReplaceAll(fe.Param(), " ", ", "))
+	default:
+		return fmt.Sprintf("%s failed the %s rule", fe.Field(), fe.Tag())
+	}
+}
+
+// sizeLimit describes the limit of a min or max rule, which is the length
+// of strings and collections but the value of numbers.
+func sizeLimit(fe validator.FieldError, bound string) string {
+	switch fe.Kind() {
+	case reflect.String:
+		return fmt.Sprintf("be %s %s long", bound, count(fe.Param(), "character"))
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return fmt.Sprintf("have %s %s", bound, count(fe.Param(), "item"))
+	default:
+		return fmt.Sprintf("be %s %s", bound, fe.Param())
+	}
+}
+
+// count returns n followed by noun, in the plural unless n is 1.
+func count(n, noun string) string {
+	if n == "1" {
+		return n + " " + noun
+	}
+	return n + " " + noun + "s"
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func TestFieldMessage(t *testing.T) {
+	type request struct {
+		Name   string   `json:"name" validate:"min=3"`
+		ListID int      `json:"list_id" validate:"omitempty,min=1"`
+		Parent *int     `json:"parent_id" validate:"omitempty,max=10"`
+		Tags   []string `json:"tags" validate:"max=1"`
+		Secret string   `json:"secret" validate:"maxbytes=4"`
+		Code   string   `json:"code" validate:"max=1"`
+	}
+	parent := 11
+	err := ValidateStruct(request{Name: "a", ListID: -1, Parent: &parent, Tags: []string{"a", "b"}, Secret: "ééé", Code: "ab"})
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		t.Fatalf("expected validation errors, got %v", err)
+	}
+	want := map[string]string{
+		"name":      "name must be at least 3 characters long",
+		"list_id":   "list_id must be at least 1",
+		"parent_id": "parent_id must be at most 10",
+		"tags":      "tags must have at most 1 item",
+		"secret":    "secret must be at most 4 bytes long",
+		"code":      "code must be at most 1 character long",
+	}
+	for _, fe := range validationErrors {
+		if got := fieldMessage(fe); got != want[fe.Field()] {
+			t.Errorf("expected %q, got %q", want[fe.Field()], got)
+		}
+	}
+	if len(validationErrors) != len(want) {
+		t.Errorf("expected %d errors, got %d", len(want), len(validationErrors))
+	}
+}